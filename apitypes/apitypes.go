@@ -25,10 +25,20 @@ type LivenessRsp struct {
 }
 
 type StateLog struct {
-	State   string    `json:"state"`
-	Time    time.Time `json:"time"`
-	Comment string    `json:"comment"`
-	Result  string    `json:"result"`
+	State   string         `json:"state"`
+	Time    time.Time      `json:"time"`
+	Comment string         `json:"comment"`
+	Result  string         `json:"result"`
+	Receipt *OutputReceipt `json:"receipt,omitempty"`
+}
+
+// OutputReceipt is the final status of the output transaction, only present in the confirmed or reverted state
+type OutputReceipt struct {
+	TxHash       string `json:"txHash"`
+	BlockNumber  uint64 `json:"blockNumber"`
+	GasUsed      uint64 `json:"gasUsed"`
+	Reverted     bool   `json:"reverted"`
+	RevertReason string `json:"revertReason,omitempty"`
 }
 
 type QueryTaskStateLogRsp struct {
@@ -42,6 +52,16 @@ type QueryMessageStateLogRsp struct {
 	States    []*StateLog `json:"states"`
 }
 
+// ProjectStateRsp is the dispatching state of the project, no new task is dispatched while it's paused
+type ProjectStateRsp struct {
+	ProjectID             uint64 `json:"projectID"`
+	Uri                   string `json:"uri"`
+	Hash                  string `json:"hash"`
+	Paused                bool   `json:"paused"`
+	RequestedProverAmount uint64 `json:"requestedProverAmount"`
+	InflightTasks         int    `json:"inflightTasks"`
+}
+
 type CoordinatorConfigRsp struct {
 	ProjectContractAddress string `json:"projectContractAddress"`
 	OperatorETHAddress     string `json:"OperatorETHAddress,omitempty"`
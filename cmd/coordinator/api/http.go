@@ -1,11 +1,13 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
 	solanatypes "github.com/blocto/solana-go-sdk/types"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -13,6 +15,8 @@ import (
 	"github.com/machinefi/sprout/apitypes"
 	"github.com/machinefi/sprout/cmd/coordinator/config"
 	"github.com/machinefi/sprout/persistence"
+	"github.com/machinefi/sprout/task"
+	"github.com/machinefi/sprout/types"
 )
 
 type HttpServer struct {
@@ -20,13 +24,15 @@ type HttpServer struct {
 	persistence     *persistence.Postgres
 	conf            *config.Config
 	coordinatorConf *apitypes.CoordinatorConfigRsp
+	getProjectState task.GetProjectState
 }
 
-func NewHttpServer(persistence *persistence.Postgres, conf *config.Config) *HttpServer {
+func NewHttpServer(persistence *persistence.Postgres, conf *config.Config, getProjectState task.GetProjectState) *HttpServer {
 	s := &HttpServer{
-		engine:      gin.Default(),
-		persistence: persistence,
-		conf:        conf,
+		engine:          gin.Default(),
+		persistence:     persistence,
+		conf:            conf,
+		getProjectState: getProjectState,
 	}
 
 	s.coordinatorConf = &apitypes.CoordinatorConfigRsp{
@@ -50,6 +56,7 @@ func NewHttpServer(persistence *persistence.Postgres, conf *config.Config) *Http
 	s.engine.GET("/live", s.liveness)
 	s.engine.GET("/task/:project_id/:task_id", s.getTaskStateLog)
 	s.engine.GET("/coordinator_config", s.getCoordinatorConfigInfo)
+	s.engine.GET("/project/:project_id", s.getProjectStateInfo)
 
 	return s
 }
@@ -93,12 +100,19 @@ func (s *HttpServer) getTaskStateLog(c *gin.Context) {
 
 	ss := []*apitypes.StateLog{}
 	for _, l := range ls {
-		ss = append(ss, &apitypes.StateLog{
+		sl := &apitypes.StateLog{
 			State:   l.State.String(),
 			Time:    l.CreatedAt,
 			Comment: l.Comment,
 			Result:  string(l.Result),
-		})
+		}
+		if l.State == types.TaskStateConfirmed || l.State == types.TaskStateReverted {
+			receipt := &apitypes.OutputReceipt{}
+			if err := json.Unmarshal(l.Result, receipt); err == nil {
+				sl.Receipt = receipt
+			}
+		}
+		ss = append(ss, sl)
 	}
 
 	c.JSON(http.StatusOK, &apitypes.QueryTaskStateLogRsp{
@@ -111,3 +125,25 @@ func (s *HttpServer) getTaskStateLog(c *gin.Context) {
 func (s *HttpServer) getCoordinatorConfigInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, s.coordinatorConf)
 }
+
+func (s *HttpServer) getProjectStateInfo(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("project_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.NewErrRsp(err))
+		return
+	}
+
+	ps, err := s.getProjectState(projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, apitypes.NewErrRsp(err))
+		return
+	}
+	c.JSON(http.StatusOK, &apitypes.ProjectStateRsp{
+		ProjectID:             ps.ProjectID,
+		Uri:                   ps.Uri,
+		Hash:                  hexutil.Encode(ps.Hash[:]),
+		Paused:                ps.Paused,
+		RequestedProverAmount: ps.RequestedProverAmount,
+		InflightTasks:         ps.InflightTasks,
+	})
+}
@@ -14,12 +14,17 @@ type Config struct {
 	BootNodeMultiAddr         string `env:"BOOTNODE_MULTIADDR"`
 	IoTeXChainID              int    `env:"IOTEX_CHAINID"`
 	ProjectContractAddress    string `env:"PROJECT_CONTRACT_ADDRESS,optional"`
+	ProverContractAddress     string `env:"PROVER_CONTRACT_ADDRESS,optional"`
 	IPFSEndpoint              string `env:"IPFS_ENDPOINT"`
+	IPFSGateways              string `env:"IPFS_GATEWAYS,optional"`
+	ArweaveGateways           string `env:"ARWEAVE_GATEWAYS,optional"`
+	ContentGateways           string `env:"CONTENT_GATEWAYS,optional"`
 	DIDAuthServerEndpoint     string `env:"DIDAUTH_SERVER_ENDPOINT"`
 	OperatorPrivateKey        string `env:"OPERATOR_PRIVATE_KEY,optional"`
 	OperatorPrivateKeyED25519 string `env:"OPERATOR_PRIVATE_KEY_ED25519,optional"`
 	ProjectFileDirectory      string `env:"PROJECT_FILE_DIRECTORY,optional"`
 	ProjectCacheDirectory     string `env:"PROJECT_CACHE_DIRECTORY,optional"`
+	ProjectCacheMaxSize       int    `env:"PROJECT_CACHE_MAX_SIZE,optional"`
 	LogLevel                  int    `env:"LOG_LEVEL,optional"`
 	SequencerPubKey           string `env:"SEQUENCER_PUBKEY,optional"`
 	env                       string `env:"-"`
@@ -34,6 +39,7 @@ var (
 		BootNodeMultiAddr:      "/dns4/bootnode-0.testnet.iotex.one/tcp/4689/ipfs/12D3KooWFnaTYuLo8Mkbm3wzaWHtUuaxBRe24Uiopu15Wr5EhD3o",
 		IoTeXChainID:           2,
 		ProjectContractAddress: "0x2339644f65c371Ca36b335A7eC3EB8AD8CBd5F51",
+		ProverContractAddress:  "0x2B9BC8eC74E7F2526045eb13fFa37b10e0d40464",
 		IPFSEndpoint:           "ipfs.mainnet.iotex.io",
 		DIDAuthServerEndpoint:  "didkit:9999",
 		SequencerPubKey:        "0x04df6acbc5b355aabfb2145b36b20b7942c831c245c423a20b189fab4cf3a3dba3d564080841f2eb4890c118ca5e0b80b25f81269621c5e28273a962996c109afa",
@@ -47,6 +53,7 @@ var (
 		BootNodeMultiAddr:      "/dns4/bootnode-0.testnet.iotex.one/tcp/4689/ipfs/12D3KooWFnaTYuLo8Mkbm3wzaWHtUuaxBRe24Uiopu15Wr5EhD3o",
 		IoTeXChainID:           2,
 		ProjectContractAddress: "0x2339644f65c371Ca36b335A7eC3EB8AD8CBd5F51",
+		ProverContractAddress:  "0x2B9BC8eC74E7F2526045eb13fFa37b10e0d40464",
 		IPFSEndpoint:           "ipfs.mainnet.iotex.io",
 		DIDAuthServerEndpoint:  "localhost:9999",
 		ProjectCacheDirectory:  "./project_cache",
@@ -61,6 +68,7 @@ var (
 		BootNodeMultiAddr:      "/dns4/bootnode-0.testnet.iotex.one/tcp/4689/ipfs/12D3KooWFnaTYuLo8Mkbm3wzaWHtUuaxBRe24Uiopu15Wr5EhD3o",
 		IoTeXChainID:           2,
 		ProjectContractAddress: "", //"0x02feBE78F3A740b3e9a1CaFAA1b23a2ac0793D26",
+		ProverContractAddress:  "",
 		IPFSEndpoint:           "ipfs.mainnet.iotex.io",
 		DIDAuthServerEndpoint:  "localhost:19999",
 		ProjectFileDirectory:   "./testdata",
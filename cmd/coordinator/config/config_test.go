@@ -22,6 +22,7 @@ func TestConfig_Init(t *testing.T) {
 			BootNodeMultiAddr:         "/dns4/a.b.com/tcp/1000/ipfs/123123123",
 			IoTeXChainID:              100,
 			ProjectContractAddress:    "0x02feBE78F3A740b3e9a1CaFAA1b23a2ac0793D26",
+			ProverContractAddress:     "0x456",
 			IPFSEndpoint:              "a.b.com",
 			DIDAuthServerEndpoint:     "didkit.com:10001",
 			OperatorPrivateKey:        "",
@@ -35,6 +36,7 @@ func TestConfig_Init(t *testing.T) {
 		_ = os.Setenv("BOOTNODE_MULTIADDR", expected.BootNodeMultiAddr)
 		_ = os.Setenv("IOTEX_CHAINID", strconv.Itoa(expected.IoTeXChainID))
 		_ = os.Setenv("PROJECT_CONTRACT_ADDRESS", expected.ProjectContractAddress)
+		_ = os.Setenv("PROVER_CONTRACT_ADDRESS", expected.ProverContractAddress)
 		_ = os.Setenv("IPFS_ENDPOINT", expected.IPFSEndpoint)
 		_ = os.Setenv("DIDAUTH_SERVER_ENDPOINT", expected.DIDAuthServerEndpoint)
 		// missing some env
@@ -11,13 +11,22 @@ import (
 
 	"github.com/machinefi/sprout/cmd/coordinator/api"
 	"github.com/machinefi/sprout/cmd/coordinator/config"
+	"github.com/machinefi/sprout/cmd/internal"
 	"github.com/machinefi/sprout/datasource"
+	"github.com/machinefi/sprout/output"
 	"github.com/machinefi/sprout/persistence"
 	"github.com/machinefi/sprout/project"
 	"github.com/machinefi/sprout/task"
 )
 
 func main() {
+	if ok, err := internal.RunCommand(os.Args, os.Stdout); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	conf, err := config.Get()
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "failed to get config"))
@@ -30,12 +39,26 @@ func main() {
 		log.Fatal(errors.Wrap(err, "failed to new postgres persistence"))
 	}
 
-	projectConfigManager, err := project.NewManager(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectCacheDirectory, conf.IPFSEndpoint)
+	projectRegistry, err := project.NewRegistry(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectFileDirectory)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "failed to new project config manager"))
+		log.Fatal(errors.Wrap(err, "failed to new project registry"))
+	}
+	fetcher := project.NewFetcher(append([]string{conf.IPFSEndpoint}, project.ParseGateways(conf.IPFSGateways)...)...)
+	if gs := project.ParseGateways(conf.ArweaveGateways); len(gs) > 0 {
+		fetcher.ArweaveGateways = gs
 	}
+	fetcher.ContentGateways = project.ParseGateways(conf.ContentGateways)
+	var projectCache *project.Cache
+	if conf.ProjectCacheDirectory != "" {
+		projectCache, err = project.NewCache(conf.ProjectCacheDirectory, int64(conf.ProjectCacheMaxSize))
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "failed to new project cache"))
+		}
+	}
+	projectConfigManager := project.NewManager(projectRegistry, projectCache, fetcher)
 
-	if err := task.RunDispatcher(persistence, datasource.NewPostgres, projectConfigManager.Get, conf.BootNodeMultiAddr, conf.OperatorPrivateKey, conf.OperatorPrivateKeyED25519, conf.ChainEndpoint, conf.ProjectContractAddress, conf.IoTeXChainID); err != nil {
+	getProjectState, err := task.RunDispatcher(persistence, datasource.NewPostgres, projectConfigManager.Get, projectConfigManager.Load, projectRegistry, conf.BootNodeMultiAddr, conf.OperatorPrivateKey, conf.OperatorPrivateKeyED25519, conf.ChainEndpoint, conf.ProverContractAddress, conf.IoTeXChainID)
+	if err != nil {
 		log.Fatal(errors.Wrap(err, "failed to run dispatcher"))
 	}
 
@@ -47,7 +70,7 @@ func main() {
 	//go dispatcher.Dispatch(nextTaskID, sequencerPubKey)
 
 	go func() {
-		if err := api.NewHttpServer(persistence, conf).Run(conf.ServiceEndpoint); err != nil {
+		if err := api.NewHttpServer(persistence, conf, getProjectState).Run(conf.ServiceEndpoint); err != nil {
 			log.Fatal(errors.Wrap(err, "failed to run http server"))
 		}
 	}()
@@ -55,4 +78,6 @@ func main() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
 	<-done
+
+	output.CloseEthSenders()
 }
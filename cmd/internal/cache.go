@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/project"
+)
+
+const cacheUsage = `usage: %s cache <command> [flags]
+
+commands:
+  list   list the cached project files, the most recently used first
+  prune  evict the cached project files
+
+`
+
+// RunCacheCommand runs the project cache subcommand, e.g. `prover cache list -dir ./project_cache`
+func RunCacheCommand(name string, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintf(out, cacheUsage, name)
+		return errors.New("missing cache command")
+	}
+
+	fs := flag.NewFlagSet(name+" cache "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	dir := fs.String("dir", os.Getenv("PROJECT_CACHE_DIRECTORY"), "project cache directory")
+
+	switch args[0] {
+	case "list":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		c, err := openCache(*dir)
+		if err != nil {
+			return err
+		}
+		es, err := c.List()
+		if err != nil {
+			return err
+		}
+		printCacheEntries(out, es)
+		return nil
+
+	case "prune":
+		maxSize := fs.Int64("max-size", project.DefaultCacheMaxSize, "evict the least recently used files until the cache is not larger than it")
+		projectID := fs.Uint64("project", 0, "evict all files of the project instead")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		c, err := openCache(*dir)
+		if err != nil {
+			return err
+		}
+		var es []*project.CacheEntry
+		if *projectID != 0 {
+			es, err = c.Remove(*projectID)
+		} else {
+			es, err = c.Prune(*maxSize)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "evicted %d files\n", len(es))
+		printCacheEntries(out, es)
+		return nil
+
+	default:
+		fmt.Fprintf(out, cacheUsage, name)
+		return errors.Errorf("unknown cache command %s", args[0])
+	}
+}
+
+func openCache(dir string) (*project.Cache, error) {
+	if dir == "" {
+		return nil, errors.New("project cache directory is required, set -dir or PROJECT_CACHE_DIRECTORY")
+	}
+	return project.OpenCache(dir, -1)
+}
+
+func printCacheEntries(out io.Writer, es []*project.CacheEntry) {
+	if len(es) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tHASH\tSIZE\tUSED AT")
+	for _, e := range es {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", e.ProjectID, hex.EncodeToString(e.Hash[:]), e.Size, e.UsedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
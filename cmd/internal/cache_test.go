@@ -0,0 +1,62 @@
+package internal_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/cmd/internal"
+	"github.com/machinefi/sprout/project"
+)
+
+func TestRunCacheCommand(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	c, err := project.NewCache(dir, -1)
+	r.NoError(err)
+	r.NoError(c.Set(1, []byte("v1")))
+	r.NoError(c.Set(2, []byte("v2")))
+	legacy := filepath.Join(dir, "3")
+	r.NoError(os.WriteFile(legacy, []byte("legacy"), 0666))
+
+	out := &bytes.Buffer{}
+	t.Run("MissingCommand", func(t *testing.T) {
+		r.ErrorContains(internal.RunCacheCommand("prover", nil, out), "missing cache command")
+		r.ErrorContains(internal.RunCacheCommand("prover", []string{"any"}, out), "unknown cache command")
+	})
+	t.Run("MissingDirectory", func(t *testing.T) {
+		t.Setenv("PROJECT_CACHE_DIRECTORY", "")
+		r.ErrorContains(internal.RunCacheCommand("prover", []string{"list"}, out), "directory is required")
+		r.Error(internal.RunCacheCommand("prover", []string{"list", "-dir", filepath.Join(dir, "any")}, out))
+	})
+	t.Run("List", func(t *testing.T) {
+		out.Reset()
+		r.NoError(internal.RunCacheCommand("prover", []string{"list", "-dir", dir}, out))
+		r.Contains(out.String(), "PROJECT")
+		r.Equal(3, bytes.Count(out.Bytes(), []byte("\n")))
+		r.FileExists(legacy)
+	})
+	t.Run("PruneProject", func(t *testing.T) {
+		out.Reset()
+		r.NoError(internal.RunCacheCommand("prover", []string{"prune", "-dir", dir, "-project", "1"}, out))
+		r.Contains(out.String(), "evicted 1 files")
+	})
+	t.Run("Prune", func(t *testing.T) {
+		t.Setenv("PROJECT_CACHE_DIRECTORY", dir)
+		out.Reset()
+		r.NoError(internal.RunCacheCommand("prover", []string{"prune"}, out))
+		r.Contains(out.String(), "evicted 0 files")
+
+		out.Reset()
+		r.NoError(internal.RunCacheCommand("prover", []string{"prune", "-max-size", "0"}, out))
+		r.Contains(out.String(), "evicted 1 files")
+
+		es, err := c.List()
+		r.NoError(err)
+		r.Empty(es)
+	})
+}
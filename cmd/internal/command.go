@@ -0,0 +1,19 @@
+package internal
+
+import "io"
+
+// RunCommand runs the subcommand of os.Args, e.g. `prover cache list`; it reports false if there is no
+// subcommand, so the service should be started
+func RunCommand(args []string, out io.Writer) (bool, error) {
+	if len(args) < 2 {
+		return false, nil
+	}
+	switch args[1] {
+	case "cache":
+		return true, RunCacheCommand(args[0], args[2:], out)
+	case "validate":
+		return true, RunValidateCommand(args[0], args[2:], out)
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/project"
+)
+
+// RunValidateCommand validates the project files, e.g. `prover validate ./projects/1`; every problem found is
+// printed, the outputs are created in dry run mode without connecting to any service
+func RunValidateCommand(name string, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintf(out, "usage: %s validate <project file>...\n", name)
+		return errors.New("missing project file")
+	}
+
+	invalid := 0
+	for _, path := range args {
+		problems := validateProjectFile(path)
+		if len(problems) == 0 {
+			fmt.Fprintf(out, "%s: ok\n", path)
+			continue
+		}
+		invalid++
+		fmt.Fprintf(out, "%s: %d problems\n", path, len(problems))
+		for _, p := range problems {
+			fmt.Fprintf(out, "  - %v\n", p)
+		}
+	}
+	if invalid > 0 {
+		return errors.Errorf("%d of %d project files invalid", invalid, len(args))
+	}
+	return nil
+}
+
+func validateProjectFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{errors.Wrap(err, "failed to read project file")}
+	}
+	p := &project.Project{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return []error{errors.Wrap(err, "failed to unmarshal project")}
+	}
+	err = p.Validate()
+	if err == nil {
+		return nil
+	}
+	var es project.ValidationErrors
+	if errors.As(err, &es) {
+		return es
+	}
+	return []error{err}
+}
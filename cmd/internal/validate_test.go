@@ -0,0 +1,62 @@
+package internal_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/cmd/internal"
+)
+
+func TestRunValidateCommand(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "1")
+	r.NoError(os.WriteFile(valid, []byte(`{"defaultVersion":"0.1","versions":[{"version":"0.1","vmType":"risc0","code":"code"}]}`), 0666))
+	invalid := filepath.Join(dir, "2")
+	r.NoError(os.WriteFile(invalid, []byte(`{"defaultVersion":"0.2","versions":[{"version":"0.1","vmType":"risc0","output":{"type":"webhook"}}]}`), 0666))
+
+	out := &bytes.Buffer{}
+	t.Run("MissingFile", func(t *testing.T) {
+		r.ErrorContains(internal.RunValidateCommand("prover", nil, out), "missing project file")
+	})
+	t.Run("Valid", func(t *testing.T) {
+		out.Reset()
+		r.NoError(internal.RunValidateCommand("prover", []string{valid}, out))
+		r.Equal(valid+": ok\n", out.String())
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		out.Reset()
+		err := internal.RunValidateCommand("prover", []string{valid, invalid, filepath.Join(dir, "3")}, out)
+		r.ErrorContains(err, "2 of 3 project files invalid")
+		r.Contains(out.String(), invalid+": 3 problems\n")
+		r.Contains(out.String(), "  - versions[0] 0.1: code is empty\n")
+		r.Contains(out.String(), "  - versions[0] 0.1: outputs[0] webhook: webhook url is empty\n")
+		r.Contains(out.String(), "  - default version 0.2: project version not exist\n")
+		r.Contains(out.String(), "failed to read project file")
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	r := require.New(t)
+
+	out := &bytes.Buffer{}
+	ok, err := internal.RunCommand([]string{"prover"}, out)
+	r.False(ok)
+	r.NoError(err)
+
+	ok, _ = internal.RunCommand([]string{"prover", "any"}, out)
+	r.False(ok)
+
+	ok, err = internal.RunCommand([]string{"prover", "validate"}, out)
+	r.True(ok)
+	r.ErrorContains(err, "missing project file")
+
+	ok, err = internal.RunCommand([]string{"prover", "cache"}, out)
+	r.True(ok)
+	r.ErrorContains(err, "missing cache command")
+}
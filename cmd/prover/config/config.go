@@ -21,8 +21,17 @@ type Config struct {
 	IoTeXChainID           int    `env:"IOTEX_CHAINID"`
 	SchedulerEpoch         uint64 `env:"SCHEDULER_EPOCH"`
 	IPFSEndpoint           string `env:"IPFS_ENDPOINT"`
+	IPFSGateways           string `env:"IPFS_GATEWAYS,optional"`
+	ArweaveGateways        string `env:"ARWEAVE_GATEWAYS,optional"`
+	ContentGateways        string `env:"CONTENT_GATEWAYS,optional"`
 	ProjectFileDirectory   string `env:"PROJECT_FILE_DIRECTORY,optional"`
 	ProjectCacheDirectory  string `env:"PROJECT_CACHE_DIRECTORY,optional"`
+	ProjectCacheMaxSize    int    `env:"PROJECT_CACHE_MAX_SIZE,optional"`
+	VMPoolMinIdle          int    `env:"VM_POOL_MIN_IDLE,optional"`
+	VMPoolMaxProject       int    `env:"VM_POOL_MAX_PROJECT,optional"`
+	VMPoolMaxServer        int    `env:"VM_POOL_MAX_SERVER,optional"`
+	VMPoolIdleTimeout      int    `env:"VM_POOL_IDLE_TIMEOUT,optional"`
+	VMPoolAcquireTimeout   int    `env:"VM_POOL_ACQUIRE_TIMEOUT,optional"`
 	LogLevel               int    `env:"LOG_LEVEL,optional"`
 	SequencerPubKey        string `env:"SEQUENCER_PUBKEY,optional"`
 	env                    string `env:"-"`
@@ -43,6 +52,11 @@ var (
 		IoTeXChainID:           2,
 		SchedulerEpoch:         20,
 		IPFSEndpoint:           "ipfs.mainnet.iotex.io",
+		VMPoolMinIdle:          1,
+		VMPoolMaxProject:       4,
+		VMPoolMaxServer:        16,
+		VMPoolIdleTimeout:      600,
+		VMPoolAcquireTimeout:   300,
 		LogLevel:               int(slog.LevelDebug),
 		SequencerPubKey:        "0x04df6acbc5b355aabfb2145b36b20b7942c831c245c423a20b189fab4cf3a3dba3d564080841f2eb4890c118ca5e0b80b25f81269621c5e28273a962996c109afa",
 	}
@@ -62,6 +76,11 @@ var (
 		SchedulerEpoch:         20,
 		IPFSEndpoint:           "ipfs.mainnet.iotex.io",
 		ProjectCacheDirectory:  "./project_cache",
+		VMPoolMinIdle:          1,
+		VMPoolMaxProject:       4,
+		VMPoolMaxServer:        16,
+		VMPoolIdleTimeout:      600,
+		VMPoolAcquireTimeout:   300,
 		LogLevel:               int(slog.LevelDebug),
 		SequencerPubKey:        "0x04df6acbc5b355aabfb2145b36b20b7942c831c245c423a20b189fab4cf3a3dba3d564080841f2eb4890c118ca5e0b80b25f81269621c5e28273a962996c109afa",
 	}
@@ -81,6 +100,11 @@ var (
 		SchedulerEpoch:         20,
 		IPFSEndpoint:           "ipfs.mainnet.iotex.io",
 		ProjectFileDirectory:   "./testdata",
+		VMPoolMinIdle:          1,
+		VMPoolMaxProject:       4,
+		VMPoolMaxServer:        16,
+		VMPoolIdleTimeout:      600,
+		VMPoolAcquireTimeout:   300,
 		LogLevel:               int(slog.LevelDebug),
 		SequencerPubKey:        "0x04df6acbc5b355aabfb2145b36b20b7942c831c245c423a20b189fab4cf3a3dba3d564080841f2eb4890c118ca5e0b80b25f81269621c5e28273a962996c109afa",
 	}
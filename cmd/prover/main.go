@@ -6,20 +6,30 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/pkg/errors"
 
+	"github.com/machinefi/sprout/cmd/internal"
 	"github.com/machinefi/sprout/cmd/prover/config"
 	"github.com/machinefi/sprout/p2p"
 	"github.com/machinefi/sprout/project"
 	"github.com/machinefi/sprout/scheduler"
 	"github.com/machinefi/sprout/task"
 	"github.com/machinefi/sprout/vm"
+	"github.com/machinefi/sprout/vm/server"
 )
 
 func main() {
+	if ok, err := internal.RunCommand(os.Args, os.Stdout); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	conf, err := config.Get()
 	if err != nil {
 		log.Fatal(err)
@@ -38,12 +48,53 @@ func main() {
 			vm.ZKwasm: conf.ZKWasmServerEndpoint,
 			vm.Wasm:   conf.WasmServerEndpoint,
 		},
+		&server.PoolConfig{
+			MinIdle:        conf.VMPoolMinIdle,
+			MaxProject:     conf.VMPoolMaxProject,
+			MaxServer:      conf.VMPoolMaxServer,
+			IdleTimeout:    time.Duration(conf.VMPoolIdleTimeout) * time.Second,
+			AcquireTimeout: time.Duration(conf.VMPoolAcquireTimeout) * time.Second,
+		},
 	)
 
-	projectConfigManager, err := project.NewManager(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectCacheDirectory, conf.IPFSEndpoint)
+	projectRegistry, err := project.NewRegistry(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectFileDirectory)
 	if err != nil {
 		log.Fatal(err)
 	}
+	fetcher := project.NewFetcher(append([]string{conf.IPFSEndpoint}, project.ParseGateways(conf.IPFSGateways)...)...)
+	if gs := project.ParseGateways(conf.ArweaveGateways); len(gs) > 0 {
+		fetcher.ArweaveGateways = gs
+	}
+	fetcher.ContentGateways = project.ParseGateways(conf.ContentGateways)
+	var projectCache *project.Cache
+	if conf.ProjectCacheDirectory != "" {
+		projectCache, err = project.NewCache(conf.ProjectCacheDirectory, int64(conf.ProjectCacheMaxSize))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	projectConfigManager := project.NewManager(projectRegistry, projectCache, fetcher)
+
+	projectConfigManager.OnUpdate(func(projectID uint64, p *project.Project) {
+		codes := make([][32]byte, 0, len(p.Versions))
+		for _, c := range p.Versions {
+			codes = append(codes, server.CodeHash(c.Code, c.CodeExpParam))
+		}
+		if n := vmHandler.Invalidate(projectID, codes...); n > 0 {
+			slog.Info("stale vm instances closed", "project_id", projectID, "count", n)
+		}
+
+		c, err := p.GetDefaultConfig()
+		if err != nil {
+			slog.Error("failed to get project config", "error", err, "project_id", projectID)
+			return
+		}
+		if err := vmHandler.Prewarm(projectID, c.VMType, c.Code, c.CodeExpParam); err != nil {
+			slog.Error("failed to prewarm vm instance", "error", err, "project_id", projectID)
+			return
+		}
+		slog.Info("vm instance prewarmed", "project_id", projectID, "project_version", c.Version)
+	})
 
 	sk, err := crypto.HexToECDSA(conf.ProverPrivateKey)
 	if err != nil {
@@ -65,7 +116,9 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := scheduler.Run(conf.SchedulerEpoch, conf.ChainEndpoint, conf.ProverContractAddress, conf.ProjectContractAddress, proverID, pubSubs, taskProcessor.HandleProjectProvers); err != nil {
+	if conf.ProjectFileDirectory != "" {
+		scheduler.RunLocal(projectRegistry, proverID, pubSubs, taskProcessor.HandleProjectProvers)
+	} else if err := scheduler.Run(conf.SchedulerEpoch, conf.ChainEndpoint, conf.ProverContractAddress, projectRegistry, proverID, pubSubs, taskProcessor.HandleProjectProvers); err != nil {
 		log.Fatal(err)
 	}
 
@@ -115,12 +115,14 @@ func runProver(conf *proverconfig.Config) {
 			vm.ZKwasm: conf.ZKWasmServerEndpoint,
 			vm.Wasm:   conf.WasmServerEndpoint,
 		},
+		nil,
 	)
 
-	projectConfigManager, err := project.NewManager(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectCacheDirectory, conf.IPFSEndpoint)
+	projectRegistry, err := project.NewRegistry(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectFileDirectory)
 	if err != nil {
 		log.Fatal(err)
 	}
+	projectConfigManager := project.NewManager(projectRegistry, nil, project.NewFetcher(conf.IPFSEndpoint))
 
 	sk, err := crypto.HexToECDSA(conf.ProverPrivateKey)
 	if err != nil {
@@ -145,7 +147,9 @@ func runProver(conf *proverconfig.Config) {
 		log.Fatal(err)
 	}
 
-	if err := scheduler.Run(conf.SchedulerEpoch, conf.ChainEndpoint, conf.ProverContractAddress, conf.ProjectContractAddress, pubKeyHex, pubSubs, taskProcessor.HandleProjectProvers); err != nil {
+	if conf.ProjectFileDirectory != "" {
+		scheduler.RunLocal(projectRegistry, pubKeyHex, pubSubs, taskProcessor.HandleProjectProvers)
+	} else if err := scheduler.Run(conf.SchedulerEpoch, conf.ChainEndpoint, conf.ProverContractAddress, projectRegistry, pubKeyHex, pubSubs, taskProcessor.HandleProjectProvers); err != nil {
 		log.Fatal(err)
 	}
 
@@ -160,17 +164,19 @@ func runCoordinator(conf *coordinatorconfig.Config) {
 
 	_ = clients.NewManager()
 
-	projectConfigManager, err := project.NewManager(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectCacheDirectory, conf.IPFSEndpoint)
+	projectRegistry, err := project.NewRegistry(conf.ChainEndpoint, conf.ProjectContractAddress, conf.ProjectFileDirectory)
 	if err != nil {
 		log.Fatal(err)
 	}
+	projectConfigManager := project.NewManager(projectRegistry, nil, project.NewFetcher(conf.IPFSEndpoint))
 
-	if err := task.RunDispatcher(pg, datasource.NewPostgres, projectConfigManager.Get, conf.BootNodeMultiAddr, conf.OperatorPrivateKey, conf.OperatorPrivateKeyED25519, conf.ChainEndpoint, conf.ProjectContractAddress, conf.IoTeXChainID); err != nil {
+	getProjectState, err := task.RunDispatcher(pg, datasource.NewPostgres, projectConfigManager.Get, projectConfigManager.Load, projectRegistry, conf.BootNodeMultiAddr, conf.OperatorPrivateKey, conf.OperatorPrivateKeyED25519, conf.ChainEndpoint, conf.ProverContractAddress, conf.IoTeXChainID)
+	if err != nil {
 		log.Fatal(errors.Wrap(err, "failed to run dispatcher"))
 	}
 
 	go func() {
-		if err := api.NewHttpServer(pg, conf).Run(conf.ServiceEndpoint); err != nil {
+		if err := api.NewHttpServer(pg, conf, getProjectState).Run(conf.ServiceEndpoint); err != nil {
 			log.Fatal(err)
 		}
 	}()
@@ -0,0 +1,170 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/types"
+)
+
+const defaultDatabaseKey = "{{.ProjectID}}/{{.TaskID}}"
+
+// KVStore persists the values outputted by the database output
+type KVStore interface {
+	// Put inserts the value, or replaces the one stored by the same key
+	Put(ctx context.Context, key string, value []byte) error
+}
+
+// KVStoreFactory opens the store of the database config, in dry run it only validates the config and returns a nil
+// store
+type KVStoreFactory func(conf *DatabaseConfig, dryRun bool) (KVStore, error)
+
+var (
+	kvStoresMux sync.RWMutex
+	kvStores    = map[string]KVStoreFactory{}
+)
+
+func init() {
+	RegisterKVStore("postgres", newPostgresKVStore)
+	RegisterKVStore("postgresql", newPostgresKVStore)
+}
+
+// RegisterKVStore makes the store of the dsn scheme available to the database output,
+// it panics if the factory is nil or the scheme is registered twice
+func RegisterKVStore(scheme string, f KVStoreFactory) {
+	kvStoresMux.Lock()
+	defer kvStoresMux.Unlock()
+
+	if f == nil {
+		panic("output: register nil kv store factory of scheme " + scheme)
+	}
+	if _, ok := kvStores[scheme]; ok {
+		panic("output: register kv store scheme twice " + scheme)
+	}
+	kvStores[scheme] = f
+}
+
+type databaseKey struct {
+	ProjectID      uint64
+	ProjectVersion string
+	TaskID         uint64
+	ClientID       string
+}
+
+type database struct {
+	store  KVStore
+	key    *template.Template
+	values []ValueMapping
+}
+
+func (d *database) Output(task *types.Task, proof []byte) (string, error) {
+	slog.Debug("outputing to database")
+	key, err := d.renderKey(task)
+	if err != nil {
+		return "", err
+	}
+	value, err := d.extractValue(task, proof)
+	if err != nil {
+		return "", err
+	}
+	if err := d.store.Put(context.Background(), key, value); err != nil {
+		return "", errors.Wrapf(err, "failed to put value of key %s", key)
+	}
+	return key, nil
+}
+
+func (d *database) renderKey(task *types.Task) (string, error) {
+	buf := bytes.Buffer{}
+	if err := d.key.Execute(&buf, &databaseKey{
+		ProjectID:      task.ProjectID,
+		ProjectVersion: task.ProjectVersion,
+		TaskID:         task.ID,
+		ClientID:       task.ClientID,
+	}); err != nil {
+		return "", errors.Wrap(err, "failed to render key")
+	}
+	if buf.Len() == 0 {
+		return "", errors.New("rendered key is empty")
+	}
+	return buf.String(), nil
+}
+
+// extractValue returns the JSON object of the mapped values, or the proof if no value mapped
+func (d *database) extractValue(task *types.Task, proof []byte) ([]byte, error) {
+	if len(d.values) == 0 {
+		v, err := (&ValueMapping{Name: "proof", Source: ValueSourceProof}).resolve(task, proof)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(v.Raw), nil
+	}
+	fields := make(map[string]json.RawMessage, len(d.values))
+	for i := range d.values {
+		m := &d.values[i]
+		v, err := m.resolve(task, proof)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve value %s", m.Name)
+		}
+		fields[m.Name] = json.RawMessage(v.Raw)
+	}
+	value, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal value")
+	}
+	return value, nil
+}
+
+// newDatabase opens the kv store of the dsn scheme, the store is only validated in dry run mode
+func newDatabase(conf *DatabaseConfig, dryRun bool) (Output, error) {
+	u, err := url.Parse(conf.DSN)
+	if err != nil || u.Scheme == "" {
+		return nil, errors.New("invalid database dsn")
+	}
+	kvStoresMux.RLock()
+	f, ok := kvStores[u.Scheme]
+	kvStoresMux.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unsupported database scheme %s", u.Scheme)
+	}
+
+	keyTemplate := conf.Key
+	if keyTemplate == "" {
+		keyTemplate = defaultDatabaseKey
+	}
+	key, err := template.New("key").Option("missingkey=error").Parse(keyTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse key template")
+	}
+
+	names := map[string]bool{}
+	for i := range conf.Values {
+		m := &conf.Values[i]
+		if m.Name == "" {
+			return nil, errors.Errorf("value %v has no name", i)
+		}
+		if names[m.Name] {
+			return nil, errors.Errorf("duplicated value %s", m.Name)
+		}
+		names[m.Name] = true
+		if err := m.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid value mapping")
+		}
+	}
+
+	store, err := f(conf, dryRun)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open kv store")
+	}
+	return &database{
+		store:  store,
+		key:    key,
+		values: conf.Values,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package output
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"gorm.io/datatypes"
+	pgdriver "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+const defaultPostgresTable = "sprout_outputs"
+
+var postgresTableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type kvRecord struct {
+	Key       string         `gorm:"primaryKey"`
+	Value     datatypes.JSON `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+type postgresKVStore struct {
+	db    *gorm.DB
+	table string
+}
+
+func (s *postgresKVStore) Put(ctx context.Context, key string, value []byte) error {
+	r := &kvRecord{Key: key, Value: value, UpdatedAt: time.Now()}
+	return s.db.WithContext(ctx).Table(s.table).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(r).Error
+}
+
+var (
+	postgresDBsMux sync.Mutex
+	postgresDBs    = map[string]*gorm.DB{} // dsn -> db
+	postgresTables = map[string]bool{}     // dsn/table -> migrated
+)
+
+// newPostgresKVStore shares the connection of the same dsn, the table is created if not exist
+func newPostgresKVStore(conf *DatabaseConfig, dryRun bool) (KVStore, error) {
+	table := conf.Table
+	if table == "" {
+		table = defaultPostgresTable
+	}
+	if !postgresTableName.MatchString(table) {
+		return nil, errors.Errorf("invalid table name %s", table)
+	}
+	if _, err := pgx.ParseConfig(conf.DSN); err != nil {
+		return nil, errors.Wrap(err, "invalid postgres dsn")
+	}
+	if dryRun {
+		return nil, nil
+	}
+
+	postgresDBsMux.Lock()
+	defer postgresDBsMux.Unlock()
+
+	db, ok := postgresDBs[conf.DSN]
+	if !ok {
+		var err error
+		db, err = gorm.Open(pgdriver.Open(conf.DSN), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to connect postgres")
+		}
+		postgresDBs[conf.DSN] = db
+	}
+	if id := conf.DSN + "/" + table; !postgresTables[id] {
+		if err := db.Table(table).AutoMigrate(&kvRecord{}); err != nil {
+			return nil, errors.Wrap(err, "failed to migrate table")
+		}
+		postgresTables[id] = true
+	}
+	return &postgresKVStore{db: db, table: table}, nil
+}
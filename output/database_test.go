@@ -0,0 +1,155 @@
+package output
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/machinefi/sprout/types"
+)
+
+type testKVStore struct {
+	values map[string]string
+	err    error
+}
+
+func (s *testKVStore) Put(_ context.Context, key string, value []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.values[key] = string(value)
+	return nil
+}
+
+var testKV = &testKVStore{values: map[string]string{}}
+
+func init() {
+	RegisterKVStore("testkv", func(*DatabaseConfig, bool) (KVStore, error) {
+		return testKV, nil
+	})
+}
+
+func TestNewDatabase(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("InvalidDSN", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "any"}, false)
+		r.ErrorContains(err, "invalid database dsn")
+	})
+	t.Run("UnsupportedScheme", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "any://localhost"}, false)
+		r.ErrorContains(err, "unsupported database scheme")
+	})
+	t.Run("InvalidKeyTemplate", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "testkv://", Key: "{{.ProjectID"}, false)
+		r.ErrorContains(err, "failed to parse key template")
+	})
+	t.Run("DuplicatedValue", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "testkv://", Values: []ValueMapping{{Name: "a", Source: ValueSourceProof}, {Name: "a", Source: ValueSourceProof}}}, false)
+		r.ErrorContains(err, "duplicated value")
+	})
+	t.Run("InvalidValue", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "testkv://", Values: []ValueMapping{{Name: "a", Source: "any"}}}, false)
+		r.ErrorContains(err, "unsupported source")
+	})
+	t.Run("DryRunInvalidTable", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "postgres://localhost/sprout", Table: "outputs;drop"}, true)
+		r.ErrorContains(err, "invalid table name")
+	})
+	t.Run("DryRunInvalidPostgresDSN", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "postgres://localhost/sprout?sslmode=any"}, true)
+		r.ErrorContains(err, "invalid postgres dsn")
+	})
+	t.Run("DryRun", func(t *testing.T) {
+		_, err := newDatabase(&DatabaseConfig{DSN: "postgres://localhost/sprout"}, true)
+		r.NoError(err)
+	})
+	t.Run("DuplicatedScheme", func(t *testing.T) {
+		r.Panics(func() {
+			RegisterKVStore("testkv", func(*DatabaseConfig, bool) (KVStore, error) { return nil, nil })
+		})
+	})
+}
+
+func TestDatabase_Output(t *testing.T) {
+	r := require.New(t)
+
+	task := &types.Task{ID: 2, ProjectID: 1, ProjectVersion: "0.1", ClientID: "client", Data: [][]byte{[]byte(`{"device":"d1"}`)}}
+	proof := []byte(hex.EncodeToString([]byte(`{"Stark":{"journal":{"bytes":[1,2]}}}`)))
+
+	t.Run("DefaultKeyAndProof", func(t *testing.T) {
+		o, err := New(&Config{Type: Database, Database: DatabaseConfig{DSN: "testkv://"}}, "", "")
+		r.NoError(err)
+		key, err := o.Output(task, proof)
+		r.NoError(err)
+		r.Equal("1/2", key)
+		r.JSONEq(`{"Stark":{"journal":{"bytes":[1,2]}}}`, testKV.values[key])
+	})
+	t.Run("PlainProof", func(t *testing.T) {
+		o, err := newDatabase(&DatabaseConfig{DSN: "testkv://", Key: "plain/{{.TaskID}}"}, false)
+		r.NoError(err)
+		key, err := o.Output(task, []byte("proof"))
+		r.NoError(err)
+		r.Equal(`"proof"`, testKV.values[key])
+	})
+	t.Run("MappedValues", func(t *testing.T) {
+		o, err := newDatabase(&DatabaseConfig{
+			DSN: "testkv://",
+			Key: "{{.ClientID}}/{{.ProjectID}}-{{.ProjectVersion}}/{{.TaskID}}",
+			Values: []ValueMapping{
+				{Name: "device", Source: ValueSourceTaskData, Path: "device"},
+				{Name: "journal", Source: ValueSourceProof, Path: "Stark.journal.bytes"},
+				{Name: "task", Source: ValueSourceTask, Path: "id"},
+				{Name: "tag", Source: ValueSourceConst, Value: []byte(`"v1"`)},
+			},
+		}, false)
+		r.NoError(err)
+		key, err := o.Output(task, proof)
+		r.NoError(err)
+		r.Equal("client/1-0.1/2", key)
+		r.JSONEq(`{"device":"d1","journal":[1,2],"task":2,"tag":"v1"}`, testKV.values[key])
+	})
+	t.Run("MissingPath", func(t *testing.T) {
+		o, err := newDatabase(&DatabaseConfig{DSN: "testkv://", Values: []ValueMapping{{Name: "a", Source: ValueSourceTaskData, Path: "notExist"}}}, false)
+		r.NoError(err)
+		_, err = o.Output(task, proof)
+		r.ErrorContains(err, "failed to resolve value a")
+	})
+	t.Run("EmptyKey", func(t *testing.T) {
+		o, err := newDatabase(&DatabaseConfig{DSN: "testkv://", Key: "{{if false}}x{{end}}"}, false)
+		r.NoError(err)
+		_, err = o.Output(task, proof)
+		r.ErrorContains(err, "rendered key is empty")
+	})
+	t.Run("FailedToPut", func(t *testing.T) {
+		testKV.err = errors.New(t.Name())
+		defer func() { testKV.err = nil }()
+
+		o, err := newDatabase(&DatabaseConfig{DSN: "testkv://"}, false)
+		r.NoError(err)
+		_, err = o.Output(task, proof)
+		r.ErrorContains(err, t.Name())
+	})
+}
+
+func Test_newPostgresKVStore(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("InvalidTable", func(t *testing.T) {
+		_, err := newPostgresKVStore(&DatabaseConfig{DSN: "postgres://localhost", Table: "a;drop"}, false)
+		r.ErrorContains(err, "invalid table name")
+	})
+	t.Run("FailedToConnect", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+		p = p.ApplyFuncReturn(gorm.Open, nil, errors.New(t.Name()))
+
+		_, err := newPostgresKVStore(&DatabaseConfig{DSN: "postgres://localhost"}, false)
+		r.ErrorContains(err, t.Name())
+	})
+}
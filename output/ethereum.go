@@ -5,25 +5,23 @@ import (
 	"log/slog"
 	"math/big"
 	"strings"
+	"time"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/pkg/errors"
 	"github.com/tidwall/gjson"
 
+	"github.com/machinefi/sprout/proof"
 	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/vm"
 )
 
-var (
-	errSnarkProofDataMissingFieldSnark           = errors.New("missing field `Snark.snark`")
-	errSnarkProofDataMissingFieldPostStateDigest = errors.New("missing field `Snark.post_state_digest`")
-	errSnarkProofDataMissingFieldJournal         = errors.New("missing field `Snark.journal`")
-	errMissingReceiverParam                      = errors.New("missing receiver param")
-)
+var errMissingReceiverParam = errors.New("missing receiver param")
+
+const ethReceiptPollInterval = 3 * time.Second
 
 type ethereumContract struct {
 	chainEndpoint   string
@@ -32,78 +30,23 @@ type ethereumContract struct {
 	secretKey       string
 	contractABI     abi.ABI
 	contractMethod  abi.Method
+	argMappings     map[string]*ValueMapping // argument name -> mapping
+	feeCaps         ethFeeCaps
+	confirmations   uint64
+	batchMode       EthereumBatchMode
+	multicallMethod abi.Method
+	vmType          vm.Type
 }
 
 func (e *ethereumContract) Output(task *types.Task, proof []byte) (string, error) {
+	if e.batchMode != "" {
+		return e.OutputBatch([]*types.Task{task}, [][]byte{proof})
+	}
 	slog.Debug("outputing to ethereum contract", "chain endpoint", e.chainEndpoint)
 
-	params := []interface{}{}
-	for _, a := range e.contractMethod.Inputs {
-		switch a.Name {
-		case "proof", "_proof":
-			params = append(params, proof)
-
-		case "projectId", "_projectId":
-			i := new(big.Int).SetUint64(task.ProjectID)
-			params = append(params, i)
-
-		case "receiver", "_receiver":
-			if e.receiverAddress == "" {
-				return "", errMissingReceiverParam
-			}
-			params = append(params, common.HexToAddress(e.receiverAddress))
-
-		case "data_snark", "_data_snark":
-			valueSeal := gjson.GetBytes(proof, "Snark.snark").String()
-			if valueSeal == "" {
-				return "", errSnarkProofDataMissingFieldSnark
-			}
-			valueDigest := gjson.GetBytes(proof, "Snark.post_state_digest").String()
-			if valueDigest == "" {
-				return "", errSnarkProofDataMissingFieldPostStateDigest
-			}
-			valueJournal := gjson.GetBytes(proof, "Snark.journal").String()
-			if valueJournal == "" {
-				return "", errSnarkProofDataMissingFieldJournal
-			}
-
-			abiBytes, err := abi.NewType("bytes", "", nil)
-			if err != nil {
-				return "", errors.Wrap(err, "new ethereum accounts abi pack failed")
-			}
-			args := abi.Arguments{
-				{Type: abiBytes, Name: "proof_snark_seal"},
-				{Type: abiBytes, Name: "proof_snark_post_state_digest"},
-				{Type: abiBytes, Name: "proof_snark_journal"},
-			}
-
-			packed, err := args.Pack([]byte(valueSeal), []byte(valueDigest), []byte(valueJournal))
-			if err != nil {
-				return "", errors.Wrap(err, "ethereum accounts abi pack failed")
-			}
-			params = append(params, packed)
-
-		default:
-			value := gjson.GetBytes(task.Data[0], a.Name)
-			param := value.String()
-			if param == "" {
-				return "", errors.Errorf("miss param %s for contract abi", a.Name)
-			}
-			switch a.Type.String() {
-			case "address":
-				params = append(params, common.HexToAddress(param))
-			case "uint256":
-				i := new(big.Int)
-				i.SetString(strings.TrimPrefix(param, "0x"), 16)
-				params = append(params, i)
-			default:
-				params = append(params, param)
-			}
-		}
-	}
-	calldata, err := e.contractABI.Pack(e.contractMethod.Name, params...)
+	calldata, err := e.calldata(task, proof)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to pack by contract abi")
+		return "", err
 	}
 
 	txHash, err := e.sendTX(context.Background(), calldata)
@@ -114,81 +57,218 @@ func (e *ethereumContract) Output(task *types.Task, proof []byte) (string, error
 	return txHash, nil
 }
 
-func (e *ethereumContract) sendTX(ctx context.Context, data []byte) (string, error) {
-	cli, err := ethclient.Dial(e.chainEndpoint)
+// calldata packs the contract method call of a single task
+func (e *ethereumContract) calldata(task *types.Task, proof []byte) ([]byte, error) {
+	params := []interface{}{}
+	for _, a := range e.contractMethod.Inputs {
+		param, err := e.param(a, task, proof)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+	}
+	calldata, err := e.contractABI.Pack(e.contractMethod.Name, params...)
 	if err != nil {
-		return "", errors.Wrapf(err, "dial eth endpoint %s failed", e.chainEndpoint)
+		return nil, errors.Wrap(err, "failed to pack by contract abi")
 	}
+	return calldata, nil
+}
 
-	pk := crypto.ToECDSAUnsafe(common.FromHex(e.secretKey))
-	sender := crypto.PubkeyToAddress(pk.PublicKey)
-	to := common.HexToAddress(e.contractAddress)
-
-	gasPrice, err := cli.SuggestGasPrice(ctx)
-	if err != nil {
-		return "", errors.Wrap(err, "get suggest gas price failed")
+// param returns the value of the contract method argument for the task
+func (e *ethereumContract) param(a abi.Argument, task *types.Task, proofData []byte) (interface{}, error) {
+	if m, ok := e.argMappings[a.Name]; ok {
+		value, err := m.resolve(task, proofData)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve param %s", a.Name)
+		}
+		param, err := convertABIValue(a.Type, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert param %s", a.Name)
+		}
+		return param, nil
 	}
 
-	chainid, err := cli.ChainID(ctx)
-	if err != nil {
-		return "", errors.Wrap(err, "get chain id failed")
+	switch a.Name {
+	case "proof", "_proof":
+		return proofData, nil
+
+	case "projectId", "_projectId":
+		return new(big.Int).SetUint64(task.ProjectID), nil
+
+	case "receiver", "_receiver":
+		if e.receiverAddress == "" {
+			return nil, errMissingReceiverParam
+		}
+		return common.HexToAddress(e.receiverAddress), nil
+
+	case "data_snark", "_data_snark":
+		seal, digest, journal, err := e.snarkData(proofData)
+		if err != nil {
+			return nil, err
+		}
+
+		abiBytes, err := abi.NewType("bytes", "", nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "new ethereum accounts abi pack failed")
+		}
+		args := abi.Arguments{
+			{Type: abiBytes, Name: "proof_snark_seal"},
+			{Type: abiBytes, Name: "proof_snark_post_state_digest"},
+			{Type: abiBytes, Name: "proof_snark_journal"},
+		}
+
+		packed, err := args.Pack(seal, digest, journal)
+		if err != nil {
+			return nil, errors.Wrap(err, "ethereum accounts abi pack failed")
+		}
+		return packed, nil
+
+	default:
+		if len(task.Data) == 0 {
+			return nil, errors.Errorf("miss param %s for contract abi", a.Name)
+		}
+		value := gjson.GetBytes(task.Data[0], a.Name)
+		if !value.Exists() || value.String() == "" {
+			return nil, errors.Errorf("miss param %s for contract abi", a.Name)
+		}
+		if a.Type.T == abi.UintTy && a.Type.Size == 256 {
+			param, err := convertLegacyUint256(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to convert param %s", a.Name)
+			}
+			return param, nil
+		}
+		param, err := convertABIValue(a.Type, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert param %s", a.Name)
+		}
+		return param, nil
 	}
+}
 
-	nonce, err := cli.PendingNonceAt(ctx, sender)
+// snarkData returns the seal, post state digest and journal of the snark proof; the risc0 fields are kept as the
+// JSON text of the receipt, e.g. "[1,2]", which is what the verifier contracts expect
+func (e *ethereumContract) snarkData(proofData []byte) ([]byte, []byte, []byte, error) {
+	p, err := proof.Decode(e.vmType, proofData)
 	if err != nil {
-		return "", errors.Wrap(err, "get pending nonce failed")
+		return nil, nil, nil, err
+	}
+	if e.vmType != vm.Risc0 {
+		if len(p.Seal) == 0 {
+			return nil, nil, nil, proof.ErrMissingSeal
+		}
+		return p.Seal, p.PostStateDigest, p.PublicInputs, nil
 	}
 
-	msg := ethereum.CallMsg{
-		From:     sender,
-		To:       &to,
-		GasPrice: gasPrice,
-		Data:     data,
+	seal := gjson.GetBytes(p.Raw, "Snark.snark").String()
+	if seal == "" {
+		return nil, nil, nil, proof.ErrMissingSeal
 	}
-	gasLimit, err := cli.EstimateGas(ctx, msg)
-	if err != nil {
-		return "", errors.Wrap(err, "estimate gas failed")
+	digest := gjson.GetBytes(p.Raw, "Snark.post_state_digest").String()
+	if digest == "" {
+		return nil, nil, nil, proof.ErrMissingPostStateDigest
 	}
+	journal := gjson.GetBytes(p.Raw, "Snark.journal").String()
+	if journal == "" {
+		return nil, nil, nil, proof.ErrMissingJournal
+	}
+	return []byte(seal), []byte(digest), []byte(journal), nil
+}
 
-	tx := ethtypes.NewTx(
-		&ethtypes.LegacyTx{
-			Nonce:    nonce,
-			GasPrice: gasPrice,
-			Gas:      gasLimit,
-			To:       &to,
-			Data:     data,
-		})
-
-	signedTx, err := ethtypes.SignTx(tx, ethtypes.NewLondonSigner(chainid), pk)
+func (e *ethereumContract) sendTX(ctx context.Context, data []byte) (string, error) {
+	sender, err := getEthSender(ctx, e.chainEndpoint, crypto.ToECDSAUnsafe(common.FromHex(e.secretKey)))
 	if err != nil {
-		return "", errors.Wrap(err, "sign tx failed")
+		return "", err
 	}
-
-	if err = cli.SendTransaction(ctx, signedTx); err != nil {
-		return "", errors.Wrap(err, "send transaction failed")
+	tx, err := sender.send(ctx, common.HexToAddress(e.contractAddress), data, e.feeCaps)
+	if err != nil {
+		return "", err
 	}
-
-	return signedTx.Hash().Hex(), nil
+	return tx.Hash().Hex(), nil
 }
 
-func newEthereum(chainEndpoint, secretKey, contractAddress, receiverAddress, contractAbiJSON, contractMethod string) (Output, error) {
+func newEthereum(conf *EthereumConfig, vmType vm.Type, secretKey string) (Output, error) {
 	if secretKey == "" {
 		return nil, errors.New("secret key is empty")
 	}
-	contractABI, err := abi.JSON(strings.NewReader(contractAbiJSON))
+	var (
+		feeCaps ethFeeCaps
+		err     error
+	)
+	if feeCaps.maxFeePerGas, err = parseWei(conf.MaxFeePerGas); err != nil {
+		return nil, errors.Wrap(err, "invalid max fee per gas")
+	}
+	if feeCaps.maxPriorityFeePerGas, err = parseWei(conf.MaxPriorityFeePerGas); err != nil {
+		return nil, errors.Wrap(err, "invalid max priority fee per gas")
+	}
+	contractABI, err := abi.JSON(strings.NewReader(conf.ContractAbiJSON))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decode contract abi")
 	}
-	method, ok := contractABI.Methods[contractMethod]
+	method, ok := contractABI.Methods[conf.ContractMethod]
 	if !ok {
 		return nil, errors.New("the contract method not exist in abi")
 	}
+	argMappings := make(map[string]*ValueMapping, len(conf.ContractArgs))
+	for i := range conf.ContractArgs {
+		m := &conf.ContractArgs[i]
+		if err := validateArgMapping(m, method); err != nil {
+			return nil, errors.Wrap(err, "invalid contract argument mapping")
+		}
+		if _, ok := argMappings[m.Name]; ok {
+			return nil, errors.Errorf("duplicated contract argument mapping %s", m.Name)
+		}
+		argMappings[m.Name] = m
+	}
+	multicallMethod, err := validateBatch(conf, contractABI, method)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid batch config")
+	}
 	return &ethereumContract{
-		chainEndpoint:   chainEndpoint,
+		chainEndpoint:   conf.ChainEndpoint,
 		secretKey:       secretKey,
-		contractAddress: contractAddress,
-		receiverAddress: receiverAddress,
+		contractAddress: conf.ContractAddress,
+		receiverAddress: conf.ReceiverAddress,
 		contractABI:     contractABI,
 		contractMethod:  method,
+		argMappings:     argMappings,
+		feeCaps:         feeCaps,
+		confirmations:   conf.Confirmations,
+		batchMode:       conf.BatchMode,
+		multicallMethod: multicallMethod,
+		vmType:          vmType,
 	}, nil
 }
+
+func (e *ethereumContract) WaitConfirmed(ctx context.Context, txHash string) (*Receipt, error) {
+	sender, err := getEthSender(ctx, e.chainEndpoint, crypto.ToECDSAUnsafe(common.FromHex(e.secretKey)))
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := sender.waitReceipt(ctx, common.HexToHash(txHash), e.confirmations, ethReceiptPollInterval)
+	if err != nil {
+		return nil, err
+	}
+	r := &Receipt{
+		TxHash:      receipt.TxHash.Hex(),
+		BlockNumber: receipt.BlockNumber.Uint64(),
+		GasUsed:     receipt.GasUsed,
+		Reverted:    receipt.Status == ethtypes.ReceiptStatusFailed,
+	}
+	if r.Reverted {
+		r.RevertReason = sender.revertReason(ctx, receipt)
+	}
+	return r, nil
+}
+
+// parseWei parses a decimal wei amount, nil if empty
+func parseWei(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() <= 0 {
+		return nil, errors.Errorf("invalid wei amount %s", s)
+	}
+	return v, nil
+}
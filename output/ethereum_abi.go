@@ -0,0 +1,227 @@
+package output
+
+import (
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+func validateArgMapping(m *ValueMapping, method abi.Method) error {
+	found := false
+	for _, a := range method.Inputs {
+		if a.Name == m.Name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("argument %s not exist in contract method %s", m.Name, method.Name)
+	}
+	return m.validate()
+}
+
+// convertABIValue converts the JSON value to the go value abi packing expects for the type
+func convertABIValue(t abi.Type, v gjson.Result) (interface{}, error) {
+	switch t.T {
+	case abi.BoolTy:
+		switch v.Type {
+		case gjson.True, gjson.False:
+			return v.Bool(), nil
+		case gjson.String:
+			switch strings.ToLower(v.Str) {
+			case "true", "1":
+				return true, nil
+			case "false", "0":
+				return false, nil
+			}
+		case gjson.Number:
+			switch v.Raw {
+			case "1":
+				return true, nil
+			case "0":
+				return false, nil
+			}
+		}
+		return nil, errors.Errorf("invalid bool value %s", v.Raw)
+
+	case abi.IntTy, abi.UintTy:
+		return convertABIInt(t, v)
+
+	case abi.AddressTy:
+		if v.Type != gjson.String || !common.IsHexAddress(v.Str) {
+			return nil, errors.Errorf("invalid address value %s", v.Raw)
+		}
+		return common.HexToAddress(v.Str), nil
+
+	case abi.StringTy:
+		if v.Type == gjson.String {
+			return v.Str, nil
+		}
+		return v.Raw, nil
+
+	case abi.BytesTy:
+		return convertABIBytes(v)
+
+	case abi.FixedBytesTy, abi.FunctionTy:
+		b, err := convertABIBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		size := t.Size
+		if t.T == abi.FunctionTy {
+			size = 24
+		}
+		if len(b) > size {
+			return nil, errors.Errorf("bytes%v value too long, length %v", size, len(b))
+		}
+		arr := reflect.New(t.GetType()).Elem()
+		reflect.Copy(arr, reflect.ValueOf(b))
+		return arr.Interface(), nil
+
+	case abi.SliceTy, abi.ArrayTy:
+		if !v.IsArray() {
+			return nil, errors.Errorf("invalid array value %s", v.Raw)
+		}
+		elems := v.Array()
+		var rv reflect.Value
+		if t.T == abi.SliceTy {
+			rv = reflect.MakeSlice(t.GetType(), len(elems), len(elems))
+		} else {
+			if len(elems) != t.Size {
+				return nil, errors.Errorf("array length unmatched, expect %v, got %v", t.Size, len(elems))
+			}
+			rv = reflect.New(t.GetType()).Elem()
+		}
+		for i, e := range elems {
+			ev, err := convertABIValue(*t.Elem, e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid array element %v", i)
+			}
+			rv.Index(i).Set(reflect.ValueOf(ev))
+		}
+		return rv.Interface(), nil
+
+	case abi.TupleTy:
+		rv := reflect.New(t.GetType()).Elem()
+		for i, et := range t.TupleElems {
+			var e gjson.Result
+			switch {
+			case v.IsObject():
+				e = v.Get(t.TupleRawNames[i])
+			case v.IsArray():
+				e = v.Get(strconv.Itoa(i))
+			default:
+				return nil, errors.Errorf("invalid tuple value %s", v.Raw)
+			}
+			if !e.Exists() {
+				return nil, errors.Errorf("missing tuple field %s", t.TupleRawNames[i])
+			}
+			ev, err := convertABIValue(*et, e)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid tuple field %s", t.TupleRawNames[i])
+			}
+			rv.Field(i).Set(reflect.ValueOf(ev))
+		}
+		return rv.Interface(), nil
+
+	default:
+		return nil, errors.Errorf("unsupported abi type %s", t.String())
+	}
+}
+
+// convertABIInt accepts JSON numbers and strings, the values are decimal unless they are 0x prefixed hex strings
+func convertABIInt(t abi.Type, v gjson.Result) (interface{}, error) {
+	var s string
+	switch v.Type {
+	case gjson.Number:
+		s = v.Raw
+	case gjson.String:
+		s = strings.TrimSpace(v.Str)
+	default:
+		return nil, errors.Errorf("invalid integer value %s", v.Raw)
+	}
+
+	base := 10
+	if v.Type == gjson.String {
+		neg, isNeg := strings.CutPrefix(s, "-")
+		if hexStr, isHex := strings.CutPrefix(neg, "0x"); isHex {
+			base = 16
+			s = hexStr
+			if isNeg {
+				s = "-" + hexStr
+			}
+		}
+	}
+	i, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, errors.Errorf("invalid integer value %s", v.Raw)
+	}
+
+	if t.T == abi.UintTy {
+		if i.Sign() < 0 || i.BitLen() > t.Size {
+			return nil, errors.Errorf("value %s overflows uint%v", s, t.Size)
+		}
+	} else {
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+		if i.Cmp(limit) >= 0 || i.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, errors.Errorf("value %s overflows int%v", s, t.Size)
+		}
+	}
+
+	// abi packs the integers no larger than 64 bits from the go types of the same size
+	switch t.GetType().Kind() {
+	case reflect.Ptr:
+		return i, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.ValueOf(i.Int64()).Convert(t.GetType()).Interface(), nil
+	default:
+		return reflect.ValueOf(i.Uint64()).Convert(t.GetType()).Interface(), nil
+	}
+}
+
+// convertLegacyUint256 parses the value as hex with optional 0x prefix, which is how the uint256 arguments without
+// mapping have been read from the task data
+func convertLegacyUint256(v gjson.Result) (*big.Int, error) {
+	i, ok := new(big.Int).SetString(strings.TrimPrefix(v.String(), "0x"), 16)
+	if !ok {
+		return nil, errors.Errorf("invalid integer value %s", v.Raw)
+	}
+	if i.Sign() < 0 || i.BitLen() > 256 {
+		return nil, errors.Errorf("value %s overflows uint256", v.Raw)
+	}
+	return i, nil
+}
+
+// convertABIBytes accepts 0x prefixed hex strings, plain strings and arrays of byte numbers
+func convertABIBytes(v gjson.Result) ([]byte, error) {
+	switch {
+	case v.Type == gjson.String:
+		if hexStr, isHex := strings.CutPrefix(v.Str, "0x"); isHex {
+			b, err := hex.DecodeString(hexStr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid hex bytes %s", v.Str)
+			}
+			return b, nil
+		}
+		return []byte(v.Str), nil
+	case v.IsArray():
+		elems := v.Array()
+		b := make([]byte, 0, len(elems))
+		for _, e := range elems {
+			if e.Type != gjson.Number || e.Int() < 0 || e.Int() > 255 {
+				return nil, errors.Errorf("invalid byte value %s", e.Raw)
+			}
+			b = append(b, byte(e.Int()))
+		}
+		return b, nil
+	default:
+		return nil, errors.Errorf("invalid bytes value %s", v.Raw)
+	}
+}
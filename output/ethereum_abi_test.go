@@ -0,0 +1,213 @@
+package output
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/machinefi/sprout/types"
+)
+
+func Test_convertABIValue(t *testing.T) {
+	r := require.New(t)
+
+	newType := func(typ string, components ...abi.ArgumentMarshaling) abi.Type {
+		ty, err := abi.NewType(typ, "", components)
+		r.NoError(err)
+		return ty
+	}
+
+	cases := []struct {
+		name     string
+		typ      abi.Type
+		value    string
+		expected interface{}
+	}{
+		{"Bool", newType("bool"), `true`, true},
+		{"BoolString", newType("bool"), `"false"`, false},
+		{"Uint8", newType("uint8"), `255`, uint8(255)},
+		{"Uint64Hex", newType("uint64"), `"0xff"`, uint64(255)},
+		{"Uint256Max", newType("uint256"), `"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"`, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))},
+		{"Int32Negative", newType("int32"), `-5`, int32(-5)},
+		{"Int256Negative", newType("int256"), `"-5"`, big.NewInt(-5)},
+		{"Int256NegativeHex", newType("int256"), `"-0x10"`, big.NewInt(-16)},
+		{"Uint64StringDecimal", newType("uint64"), `"10"`, uint64(10)},
+		{"Uint256StringDecimal", newType("uint256"), `"1000000000000000000000"`, new(big.Int).Exp(big.NewInt(10), big.NewInt(21), nil)},
+		{"Uint256NumberDecimal", newType("uint256"), `10`, big.NewInt(10)},
+		{"Uint128NumberDecimal", newType("uint128"), `10`, big.NewInt(10)},
+		{"Address", newType("address"), `"0x0000000000000000000000000000000000000001"`, common.HexToAddress("0x1")},
+		{"String", newType("string"), `"any"`, "any"},
+		{"Bytes", newType("bytes"), `"0x0102"`, []byte{1, 2}},
+		{"BytesArray", newType("bytes"), `[1,2]`, []byte{1, 2}},
+		{"Bytes4", newType("bytes4"), `"0x01020304"`, [4]byte{1, 2, 3, 4}},
+		{"Bytes32Padded", newType("bytes32"), `"0x01"`, [32]byte{1}},
+		{"Uint256Slice", newType("uint256[]"), `[1,"0x2"]`, []*big.Int{big.NewInt(1), big.NewInt(2)}},
+		{"BoolArray", newType("bool[2]"), `[true,false]`, [2]bool{true, false}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := convertABIValue(c.typ, gjson.Parse(c.value))
+			r.NoError(err)
+			r.Equal(c.expected, v)
+			_, err = abi.Arguments{{Type: c.typ}}.Pack(v)
+			r.NoError(err)
+		})
+	}
+
+	t.Run("Tuple", func(t *testing.T) {
+		typ := newType("tuple", abi.ArgumentMarshaling{Name: "id", Type: "uint64"}, abi.ArgumentMarshaling{Name: "values", Type: "int16[]"})
+		for _, value := range []string{`{"id":1,"values":[-1,2]}`, `[1,[-1,2]]`} {
+			v, err := convertABIValue(typ, gjson.Parse(value))
+			r.NoError(err)
+			_, err = abi.Arguments{{Type: typ}}.Pack(v)
+			r.NoError(err)
+		}
+		_, err := convertABIValue(typ, gjson.Parse(`{"id":1}`))
+		r.ErrorContains(err, "missing tuple field values")
+	})
+
+	failures := []struct {
+		name  string
+		typ   abi.Type
+		value string
+	}{
+		{"InvalidBool", newType("bool"), `"yes"`},
+		{"Uint8Overflow", newType("uint8"), `256`},
+		{"UintNegative", newType("uint256"), `-1`},
+		{"Int8Overflow", newType("int8"), `128`},
+		{"InvalidInteger", newType("uint256"), `"zz"`},
+		{"UnprefixedHex", newType("uint256"), `"ff"`},
+		{"InvalidNumber", newType("uint64"), `1.5`},
+		{"InvalidAddress", newType("address"), `"any"`},
+		{"InvalidHexBytes", newType("bytes"), `"0xzz"`},
+		{"InvalidByte", newType("bytes"), `[256]`},
+		{"Bytes4TooLong", newType("bytes4"), `"0x0102030405"`},
+		{"NotArray", newType("uint256[]"), `1`},
+		{"ArrayLengthUnmatched", newType("bool[2]"), `[true]`},
+	}
+	for _, c := range failures {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := convertABIValue(c.typ, gjson.Parse(c.value))
+			r.Error(err)
+		})
+	}
+}
+
+func Test_convertLegacyUint256(t *testing.T) {
+	r := require.New(t)
+
+	for _, value := range []string{`"10"`, `"0x10"`, `10`} {
+		i, err := convertLegacyUint256(gjson.Parse(value))
+		r.NoError(err)
+		r.Equal(big.NewInt(16), i)
+	}
+	_, err := convertLegacyUint256(gjson.Parse(`"zz"`))
+	r.ErrorContains(err, "invalid integer value")
+	_, err = convertLegacyUint256(gjson.Parse(`"-1"`))
+	r.ErrorContains(err, "overflows")
+}
+
+func Test_ethereumContract_OutputWithArgMappings(t *testing.T) {
+	r := require.New(t)
+
+	abiJSON := `[{"inputs":[{"name":"flag","type":"bool"},{"name":"key","type":"bytes32"},{"name":"amounts","type":"uint256[]"},{"name":"taskId","type":"uint64"},{"name":"journal","type":"bytes"},{"name":"tag","type":"string"}],"name":"testMethod","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+	c := &Config{
+		Type: EthereumContract,
+		Ethereum: EthereumConfig{
+			ContractAbiJSON: abiJSON,
+			ContractMethod:  testMethodName,
+			ContractArgs: []ValueMapping{
+				{Name: "flag", Source: ValueSourceTaskData, DataIndex: 1, Path: "enabled"},
+				{Name: "key", Source: ValueSourceTaskData, Path: "key"},
+				{Name: "amounts", Source: ValueSourceTaskData, Path: "amounts"},
+				{Name: "taskId", Source: ValueSourceTask, Path: "id"},
+				{Name: "journal", Source: ValueSourceProof, Path: "Stark.journal.bytes"},
+				{Name: "tag", Source: ValueSourceConst, Value: []byte(`"v1"`)},
+			},
+		},
+	}
+
+	t.Run("InvalidMappings", func(t *testing.T) {
+		invalid := *c
+		invalid.Ethereum.ContractArgs = []ValueMapping{{Name: "notExist", Source: ValueSourceProof}}
+		_, err := New(&invalid, "1", "")
+		r.ErrorContains(err, "not exist")
+
+		invalid.Ethereum.ContractArgs = []ValueMapping{{Name: "flag", Source: "any"}}
+		_, err = New(&invalid, "1", "")
+		r.ErrorContains(err, "unsupported source")
+
+		invalid.Ethereum.ContractArgs = []ValueMapping{{Name: "tag", Source: ValueSourceConst}}
+		_, err = New(&invalid, "1", "")
+		r.ErrorContains(err, "invalid const value")
+
+		invalid.Ethereum.ContractArgs = []ValueMapping{{Name: "flag", Source: ValueSourceProof}, {Name: "flag", Source: ValueSourceProof}}
+		_, err = New(&invalid, "1", "")
+		r.ErrorContains(err, "duplicated")
+	})
+
+	o, err := New(c, "1", "")
+	r.NoError(err)
+
+	task := &types.Task{
+		ID:        7,
+		ProjectID: 1,
+		Data: [][]byte{
+			[]byte(`{"key":"0x01","amounts":["1000000000000000000000","0x2"]}`),
+			[]byte(`{"enabled":true}`),
+		},
+	}
+	proof := []byte(`{"Stark":{"journal":{"bytes":[1,2,3]}}}`)
+
+	t.Run("Success", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+
+		var calldata []byte
+		p = p.ApplyPrivateMethod(&ethereumContract{}, "sendTX", func(_ *ethereumContract, _ context.Context, data []byte) (string, error) {
+			calldata = data
+			return "anyTxHash", nil
+		})
+
+		_, err := o.Output(task, proof)
+		r.NoError(err)
+
+		parsed, err := abi.JSON(strings.NewReader(abiJSON))
+		r.NoError(err)
+		args, err := parsed.Methods[testMethodName].Inputs.Unpack(calldata[4:])
+		r.NoError(err)
+		amount, _ := new(big.Int).SetString("1000000000000000000000", 10)
+		r.Equal(true, args[0])
+		r.Equal([32]byte{1}, args[1])
+		r.Equal([]*big.Int{amount, big.NewInt(2)}, args[2])
+		r.Equal(uint64(7), args[3])
+		r.Equal([]byte{1, 2, 3}, args[4])
+		r.Equal("v1", args[5])
+	})
+
+	t.Run("HexProof", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+		p = patchEthereumContractSendTX(p, "anyTxHash", nil)
+
+		_, err := o.Output(task, []byte(common.Bytes2Hex(proof)))
+		r.NoError(err)
+	})
+
+	t.Run("PathNotExist", func(t *testing.T) {
+		_, err := o.Output(task, []byte(`{}`))
+		r.ErrorContains(err, "path Stark.journal.bytes not exist")
+	})
+
+	t.Run("DataIndexOutOfRange", func(t *testing.T) {
+		_, err := o.Output(&types.Task{Data: [][]byte{task.Data[0]}}, proof)
+		r.ErrorContains(err, "out of range")
+	})
+}
@@ -0,0 +1,117 @@
+package output
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/types"
+)
+
+const defaultMulticallMethod = "multicall"
+
+// validateBatch checks the contract method or the multicall method fits the batch mode
+func validateBatch(conf *EthereumConfig, contractABI abi.ABI, method abi.Method) (abi.Method, error) {
+	switch conf.BatchMode {
+	case "":
+		return abi.Method{}, nil
+	case EthereumBatchArray:
+		for _, a := range method.Inputs {
+			if a.Type.T != abi.SliceTy {
+				return abi.Method{}, errors.Errorf("argument %s of contract method %s is not a dynamic array", a.Name, method.Name)
+			}
+		}
+		return abi.Method{}, nil
+	case EthereumBatchMulticall:
+		name := conf.MulticallMethod
+		if name == "" {
+			name = defaultMulticallMethod
+		}
+		m, ok := contractABI.Methods[name]
+		if !ok {
+			return abi.Method{}, errors.Errorf("the multicall method %s not exist in abi", name)
+		}
+		if len(m.Inputs) != 1 || m.Inputs[0].Type.T != abi.SliceTy || m.Inputs[0].Type.Elem.T != abi.BytesTy {
+			return abi.Method{}, errors.Errorf("the multicall method %s should only accept bytes[]", name)
+		}
+		return m, nil
+	default:
+		return abi.Method{}, errors.Errorf("unsupported batch mode %s", conf.BatchMode)
+	}
+}
+
+func (e *ethereumContract) OutputBatch(tasks []*types.Task, proofs [][]byte) (string, error) {
+	slog.Debug("outputing batch to ethereum contract", "chain endpoint", e.chainEndpoint, "batch size", len(tasks))
+
+	if len(tasks) == 0 || len(tasks) != len(proofs) {
+		return "", errors.Errorf("invalid batch, %v tasks with %v proofs", len(tasks), len(proofs))
+	}
+
+	var (
+		calldata []byte
+		err      error
+	)
+	switch e.batchMode {
+	case EthereumBatchArray:
+		calldata, err = e.arrayCalldata(tasks, proofs)
+	case EthereumBatchMulticall:
+		calldata, err = e.multicallCalldata(tasks, proofs)
+	default:
+		return "", errors.New("ethereum batch mode not configured")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	txHash, err := e.sendTX(context.Background(), calldata)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to send transaction")
+	}
+	return txHash, nil
+}
+
+// arrayCalldata packs a single contract method call, each argument is the array of the values of all tasks
+func (e *ethereumContract) arrayCalldata(tasks []*types.Task, proofs [][]byte) ([]byte, error) {
+	params := []interface{}{}
+	for _, a := range e.contractMethod.Inputs {
+		elem := abi.Argument{Name: a.Name, Type: *a.Type.Elem}
+		values := reflect.MakeSlice(a.Type.GetType(), 0, len(tasks))
+		for i, t := range tasks {
+			v, err := e.param(elem, t, proofs[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to build param of task %v", t.ID)
+			}
+			rv := reflect.ValueOf(v)
+			if rv.Type() != values.Type().Elem() {
+				return nil, errors.Errorf("param %s of task %v is %s, expect %s", a.Name, t.ID, rv.Type(), values.Type().Elem())
+			}
+			values = reflect.Append(values, rv)
+		}
+		params = append(params, values.Interface())
+	}
+	calldata, err := e.contractABI.Pack(e.contractMethod.Name, params...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack by contract abi")
+	}
+	return calldata, nil
+}
+
+// multicallCalldata packs the contract method call of each task into the multicall method
+func (e *ethereumContract) multicallCalldata(tasks []*types.Task, proofs [][]byte) ([]byte, error) {
+	calls := make([][]byte, 0, len(tasks))
+	for i, t := range tasks {
+		c, err := e.calldata(t, proofs[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to build calldata of task %v", t.ID)
+		}
+		calls = append(calls, c)
+	}
+	calldata, err := e.contractABI.Pack(e.multicallMethod.Name, calls)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack multicall")
+	}
+	return calldata, nil
+}
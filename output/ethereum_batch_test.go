@@ -0,0 +1,177 @@
+package output
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/vm"
+)
+
+const testBatchABI = `[
+	{"inputs":[{"internalType":"uint256[]","name":"projectId","type":"uint256[]"},{"internalType":"bytes[]","name":"proof","type":"bytes[]"}],"name":"submitBatch","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"internalType":"uint256","name":"projectId","type":"uint256"},{"internalType":"bytes","name":"proof","type":"bytes"}],"name":"submit","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"internalType":"bytes[]","name":"data","type":"bytes[]"}],"name":"multicall","outputs":[{"internalType":"bytes[]","name":"results","type":"bytes[]"}],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"internalType":"bytes","name":"data","type":"bytes"}],"name":"badMulticall","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+const testBatchSecretKey = "c47bbade736b0f82788aa6eaa06140cdf41a544707edef944299642e0d708cab"
+
+func TestNew_Batch(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("NotSupported", func(t *testing.T) {
+		_, err := New(&Config{Type: Stdout, Batch: &BatchConfig{Size: 2}}, "", "")
+		r.ErrorContains(err, "not support batch")
+	})
+	t.Run("InvalidBatchConfig", func(t *testing.T) {
+		c := &Config{
+			Type:     EthereumContract,
+			Ethereum: EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submitBatch", BatchMode: EthereumBatchArray},
+			Batch:    &BatchConfig{Size: 0},
+		}
+		_, err := New(c, testBatchSecretKey, "")
+		r.ErrorContains(err, "batch size is zero")
+
+		c.Batch = &BatchConfig{Size: 2, Window: "-1s"}
+		_, err = New(c, testBatchSecretKey, "")
+		r.ErrorContains(err, "non-positive batch window")
+	})
+	t.Run("MissingBatchMode", func(t *testing.T) {
+		c := &Config{
+			Type:     EthereumContract,
+			Ethereum: EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submitBatch"},
+			Batch:    &BatchConfig{Size: 2},
+		}
+		_, err := New(c, testBatchSecretKey, "")
+		r.ErrorContains(err, "batch mode is required")
+	})
+	t.Run("Success", func(t *testing.T) {
+		c := &Config{
+			Type:     EthereumContract,
+			Ethereum: EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submitBatch", BatchMode: EthereumBatchArray},
+			Batch:    &BatchConfig{Size: 2},
+		}
+		o, err := New(c, testBatchSecretKey, "")
+		r.NoError(err)
+		_, ok := o.(BatchOutput)
+		r.True(ok)
+	})
+}
+
+func Test_newEthereum_batch(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("UnsupportedMode", func(t *testing.T) {
+		_, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submit", BatchMode: "any"}, vm.Risc0, testBatchSecretKey)
+		r.ErrorContains(err, "unsupported batch mode")
+	})
+	t.Run("ArrayModeWithScalarArgument", func(t *testing.T) {
+		_, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submit", BatchMode: EthereumBatchArray}, vm.Risc0, testBatchSecretKey)
+		r.ErrorContains(err, "not a dynamic array")
+	})
+	t.Run("MulticallMethodNotExist", func(t *testing.T) {
+		_, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submit", BatchMode: EthereumBatchMulticall, MulticallMethod: "notExist"}, vm.Risc0, testBatchSecretKey)
+		r.ErrorContains(err, "not exist in abi")
+	})
+	t.Run("InvalidMulticallMethod", func(t *testing.T) {
+		_, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submit", BatchMode: EthereumBatchMulticall, MulticallMethod: "badMulticall"}, vm.Risc0, testBatchSecretKey)
+		r.ErrorContains(err, "should only accept bytes[]")
+	})
+}
+
+func Test_ethereumContract_OutputBatch(t *testing.T) {
+	r := require.New(t)
+
+	tasks := []*types.Task{{ID: 1, ProjectID: 10}, {ID: 2, ProjectID: 10}}
+	proofs := [][]byte{[]byte("proof1"), []byte("proof2")}
+
+	patchSendTX := func(p *Patches, calldata *[]byte) *Patches {
+		return p.ApplyPrivateMethod(&ethereumContract{}, "sendTX", func(_ *ethereumContract, _ context.Context, data []byte) (string, error) {
+			*calldata = data
+			return "0xhash", nil
+		})
+	}
+
+	t.Run("InvalidBatch", func(t *testing.T) {
+		o, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submitBatch", BatchMode: EthereumBatchArray}, vm.Risc0, testBatchSecretKey)
+		r.NoError(err)
+		_, err = o.(BatchOutput).OutputBatch(tasks, proofs[:1])
+		r.ErrorContains(err, "invalid batch")
+	})
+	t.Run("BatchModeNotConfigured", func(t *testing.T) {
+		o, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submit"}, vm.Risc0, testBatchSecretKey)
+		r.NoError(err)
+		_, err = o.(BatchOutput).OutputBatch(tasks, proofs)
+		r.ErrorContains(err, "batch mode not configured")
+	})
+	t.Run("Array", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+
+		var calldata []byte
+		p = patchSendTX(p, &calldata)
+
+		o, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submitBatch", BatchMode: EthereumBatchArray}, vm.Risc0, testBatchSecretKey)
+		r.NoError(err)
+		res, err := o.(BatchOutput).OutputBatch(tasks, proofs)
+		r.NoError(err)
+		r.Equal("0xhash", res)
+
+		e := o.(*ethereumContract)
+		args, err := e.contractMethod.Inputs.Unpack(calldata[4:])
+		r.NoError(err)
+		r.Equal([]*big.Int{big.NewInt(10), big.NewInt(10)}, args[0])
+		r.Equal(proofs, args[1])
+	})
+	t.Run("ArrayElementTypeUnmatched", func(t *testing.T) {
+		abiJSON := `[{"inputs":[{"internalType":"uint64[]","name":"projectId","type":"uint64[]"}],"name":"submitBatch","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+		o, err := newEthereum(&EthereumConfig{ContractAbiJSON: abiJSON, ContractMethod: "submitBatch", BatchMode: EthereumBatchArray}, vm.Risc0, testBatchSecretKey)
+		r.NoError(err)
+		_, err = o.(BatchOutput).OutputBatch(tasks, proofs)
+		r.ErrorContains(err, "expect uint64")
+	})
+	t.Run("Multicall", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+
+		var calldata []byte
+		p = patchSendTX(p, &calldata)
+
+		o, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submit", BatchMode: EthereumBatchMulticall}, vm.Risc0, testBatchSecretKey)
+		r.NoError(err)
+		_, err = o.(BatchOutput).OutputBatch(tasks, proofs)
+		r.NoError(err)
+
+		e := o.(*ethereumContract)
+		args, err := e.multicallMethod.Inputs.Unpack(calldata[4:])
+		r.NoError(err)
+		calls := args[0].([][]byte)
+		r.Len(calls, 2)
+		for i, c := range calls {
+			expect, err := e.calldata(tasks[i], proofs[i])
+			r.NoError(err)
+			r.Equal(expect, c)
+		}
+	})
+	t.Run("SingleOutputInBatchMode", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+
+		var calldata []byte
+		p = patchSendTX(p, &calldata)
+
+		o, err := newEthereum(&EthereumConfig{ContractAbiJSON: testBatchABI, ContractMethod: "submitBatch", BatchMode: EthereumBatchArray}, vm.Risc0, testBatchSecretKey)
+		r.NoError(err)
+		_, err = o.Output(tasks[0], proofs[0])
+		r.NoError(err)
+
+		args, err := o.(*ethereumContract).contractMethod.Inputs.Unpack(calldata[4:])
+		r.NoError(err)
+		r.Equal([][]byte{proofs[0]}, args[1])
+	})
+}
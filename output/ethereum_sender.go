@@ -0,0 +1,431 @@
+package output
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"log/slog"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the minimum fee bump of a replacement transaction accepted by geth's txpool is 10%
+	ethFeeBumpPercent    = 20
+	ethStuckTxTimeout    = 2 * time.Minute
+	ethStuckTxCheckEvery = 30 * time.Second
+	// mined transactions are kept for a while, so the receipt waiters can find the replaced ones
+	ethMinedTxRetention = time.Hour
+)
+
+// ethSenderClient is the part of ethclient.Client used by the sender
+type ethSenderClient interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*ethtypes.Header, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	SendTransaction(ctx context.Context, tx *ethtypes.Transaction) error
+	BlockNumber(ctx context.Context) (uint64, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*ethtypes.Transaction, bool, error)
+	TransactionReceipt(ctx context.Context, hash common.Hash) (*ethtypes.Receipt, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// ethFeeCaps limits the fees of transactions, nil means no limit
+type ethFeeCaps struct {
+	maxFeePerGas         *big.Int
+	maxPriorityFeePerGas *big.Int
+}
+
+type ethPendingTx struct {
+	tx     *ethtypes.Transaction
+	hashes []common.Hash // hashes of the tx and all its replacements
+	caps   ethFeeCaps
+	sentAt time.Time
+	mined  bool
+}
+
+// ethSender submits the transactions of one operator account on one chain;
+// submissions are serialised, nonces are tracked locally and stuck transactions are replaced with bumped fees
+type ethSender struct {
+	mux         sync.Mutex
+	client      ethSenderClient
+	chainID     *big.Int
+	key         *ecdsa.PrivateKey
+	from        common.Address
+	nonce       uint64
+	nonceLoaded bool
+	pending     map[uint64]*ethPendingTx // nonce -> latest submitted tx
+	stuckAfter  time.Duration
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+var ethSenders = struct {
+	mux     sync.Mutex
+	senders map[string]*ethSender // chainEndpoint/operatorAddress -> sender
+}{senders: map[string]*ethSender{}}
+
+// getEthSender returns the shared sender of the operator account on the chain, the sender is created at first use
+func getEthSender(ctx context.Context, chainEndpoint string, key *ecdsa.PrivateKey) (*ethSender, error) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	id := chainEndpoint + "/" + from.Hex()
+
+	ethSenders.mux.Lock()
+	s, ok := ethSenders.senders[id]
+	ethSenders.mux.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	// dial without holding the lock, a slow endpoint doesn't block the outputs of other chains
+	cli, err := ethclient.Dial(chainEndpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial eth endpoint %s failed", chainEndpoint)
+	}
+	s, err = newEthSender(ctx, cli, key)
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	ethSenders.mux.Lock()
+	defer ethSenders.mux.Unlock()
+
+	if exist, ok := ethSenders.senders[id]; ok {
+		cli.Close()
+		return exist, nil
+	}
+	go s.watchStuckTx(ethStuckTxCheckEvery)
+	ethSenders.senders[id] = s
+	return s, nil
+}
+
+// CloseEthSenders stops the stuck transaction watchers of the shared senders and closes their connections
+func CloseEthSenders() {
+	ethSenders.mux.Lock()
+	defer ethSenders.mux.Unlock()
+
+	for id, s := range ethSenders.senders {
+		s.close()
+		if c, ok := s.client.(interface{ Close() }); ok {
+			c.Close()
+		}
+		delete(ethSenders.senders, id)
+	}
+}
+
+func newEthSender(ctx context.Context, client ethSenderClient, key *ecdsa.PrivateKey) (*ethSender, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get chain id failed")
+	}
+	return &ethSender{
+		client:     client,
+		chainID:    chainID,
+		key:        key,
+		from:       crypto.PubkeyToAddress(key.PublicKey),
+		pending:    map[uint64]*ethPendingTx{},
+		stuckAfter: ethStuckTxTimeout,
+		stop:       make(chan struct{}),
+	}, nil
+}
+
+// send signs and submits a transaction calling `to` with data, it returns the submitted transaction
+func (s *ethSender) send(ctx context.Context, to common.Address, data []byte, caps ethFeeCaps) (*ethtypes.Transaction, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.nonceLoaded {
+		nonce, err := s.client.PendingNonceAt(ctx, s.from)
+		if err != nil {
+			return nil, errors.Wrap(err, "get pending nonce failed")
+		}
+		s.nonce = nonce
+		s.nonceLoaded = true
+	}
+
+	gasLimit, err := s.client.EstimateGas(ctx, ethereum.CallMsg{
+		From: s.from,
+		To:   &to,
+		Data: data,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "estimate gas failed")
+	}
+
+	txData, err := s.newTxData(ctx, s.nonce, gasLimit, to, data, caps)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.signAndSend(ctx, txData)
+	if err != nil {
+		// the tx may reach the mempool even though the broadcast failed, the nonce is resynced from the
+		// pending nonce at next sending so it's not reused
+		s.nonceLoaded = false
+		return nil, err
+	}
+	s.pending[s.nonce] = &ethPendingTx{tx: tx, hashes: []common.Hash{tx.Hash()}, caps: caps, sentAt: time.Now()}
+	s.nonce++
+	return tx, nil
+}
+
+// newTxData builds a dynamic fee tx, or a legacy tx if the chain hasn't activated london
+func (s *ethSender) newTxData(ctx context.Context, nonce, gasLimit uint64, to common.Address, data []byte, caps ethFeeCaps) (ethtypes.TxData, error) {
+	head, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "get latest header failed")
+	}
+	if head.BaseFee == nil {
+		gasPrice, err := s.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "get suggest gas price failed")
+		}
+		gasPrice = minBig(gasPrice, caps.maxFeePerGas)
+		return &ethtypes.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: gasPrice,
+			Gas:      gasLimit,
+			To:       &to,
+			Data:     data,
+		}, nil
+	}
+
+	tip, err := s.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get suggest gas tip cap failed")
+	}
+	tip = minBig(tip, caps.maxPriorityFeePerGas)
+	// leave room for the base fee doubling in the following blocks
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	feeCap = minBig(feeCap, caps.maxFeePerGas)
+	if feeCap.Cmp(tip) < 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+	return &ethtypes.DynamicFeeTx{
+		ChainID:   s.chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gasLimit,
+		To:        &to,
+		Data:      data,
+	}, nil
+}
+
+func (s *ethSender) signAndSend(ctx context.Context, txData ethtypes.TxData) (*ethtypes.Transaction, error) {
+	tx, err := ethtypes.SignNewTx(s.key, ethtypes.NewLondonSigner(s.chainID), txData)
+	if err != nil {
+		return nil, errors.Wrap(err, "sign tx failed")
+	}
+	if err := s.client.SendTransaction(ctx, tx); err != nil {
+		if isNonceError(err) {
+			// the account is used by others, reload the nonce at next sending
+			s.nonceLoaded = false
+		}
+		return nil, errors.Wrap(err, "send transaction failed")
+	}
+	return tx, nil
+}
+
+func (s *ethSender) watchStuckTx(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.replaceStuckTx(context.Background()); err != nil {
+				slog.Error("failed to replace stuck transactions", "error", err, "account", s.from.Hex())
+			}
+		}
+	}
+}
+
+// close stops watching the stuck transactions
+func (s *ethSender) close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// replaceStuckTx drops transactions mined long ago, and resends the ones pending too long with bumped fees
+func (s *ethSender) replaceStuckTx(ctx context.Context) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+	minedNonce, err := s.client.NonceAt(ctx, s.from, nil)
+	if err != nil {
+		return errors.Wrap(err, "get nonce failed")
+	}
+	for nonce, p := range s.pending {
+		if nonce < minedNonce {
+			p.mined = true
+		}
+		if p.mined {
+			if time.Since(p.sentAt) > ethMinedTxRetention {
+				delete(s.pending, nonce)
+			}
+			continue
+		}
+		if time.Since(p.sentAt) < s.stuckAfter {
+			continue
+		}
+		txData, ok := bumpTxFee(p.tx, p.caps)
+		if !ok {
+			slog.Warn("transaction stuck but fee reached the cap", "tx_hash", p.tx.Hash().Hex(), "nonce", nonce)
+			continue
+		}
+		tx, err := s.signAndSend(ctx, txData)
+		if err != nil {
+			slog.Error("failed to replace stuck transaction", "error", err, "tx_hash", p.tx.Hash().Hex(), "nonce", nonce)
+			continue
+		}
+		slog.Info("replaced stuck transaction", "old_tx_hash", p.tx.Hash().Hex(), "new_tx_hash", tx.Hash().Hex(), "nonce", nonce)
+		p.tx = tx
+		p.hashes = append(p.hashes, tx.Hash())
+		p.sentAt = time.Now()
+	}
+	return nil
+}
+
+// txHashes returns the hashes of the tx and its replacements
+func (s *ethSender) txHashes(hash common.Hash) []common.Hash {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, p := range s.pending {
+		for _, h := range p.hashes {
+			if h == hash {
+				return append([]common.Hash{}, p.hashes...)
+			}
+		}
+	}
+	return []common.Hash{hash}
+}
+
+// waitReceipt polls the receipt of the tx or its replacement until it has enough confirmations
+func (s *ethSender) waitReceipt(ctx context.Context, hash common.Hash, confirmations uint64, interval time.Duration) (*ethtypes.Receipt, error) {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	for {
+		for _, h := range s.txHashes(hash) {
+			receipt, err := s.client.TransactionReceipt(ctx, h)
+			if err != nil {
+				if !errors.Is(err, ethereum.NotFound) {
+					slog.Warn("failed to get transaction receipt", "error", err, "tx_hash", h.Hex())
+				}
+				continue
+			}
+			head, err := s.client.BlockNumber(ctx)
+			if err != nil {
+				slog.Warn("failed to get block number", "error", err)
+				continue
+			}
+			if head+1 >= receipt.BlockNumber.Uint64()+confirmations {
+				return receipt, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "failed to wait for transaction receipt, tx_hash %s", hash.Hex())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// revertReason replays the reverted tx at its block, and returns the reason of the revert
+func (s *ethSender) revertReason(ctx context.Context, receipt *ethtypes.Receipt) string {
+	tx, _, err := s.client.TransactionByHash(ctx, receipt.TxHash)
+	if err != nil {
+		return "unknown, failed to get transaction: " + err.Error()
+	}
+	_, err = s.client.CallContract(ctx, ethereum.CallMsg{
+		From:  s.from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}, receipt.BlockNumber)
+	if err == nil {
+		return "unknown"
+	}
+	var de rpc.DataError
+	if errors.As(err, &de) {
+		if data, ok := de.ErrorData().(string); ok {
+			if reason, uerr := abi.UnpackRevert(common.FromHex(data)); uerr == nil {
+				return reason
+			}
+		}
+	}
+	return err.Error()
+}
+
+// bumpTxFee returns a copy of tx with fees raised by ethFeeBumpPercent, false if the bumped fee exceeds the caps
+func bumpTxFee(tx *ethtypes.Transaction, caps ethFeeCaps) (ethtypes.TxData, bool) {
+	bump := func(v *big.Int) *big.Int {
+		n := new(big.Int).Mul(v, big.NewInt(100+ethFeeBumpPercent))
+		return n.Div(n, big.NewInt(100))
+	}
+	exceeds := func(v, limit *big.Int) bool {
+		return limit != nil && v.Cmp(limit) > 0
+	}
+
+	if tx.Type() == ethtypes.LegacyTxType {
+		gasPrice := bump(tx.GasPrice())
+		if exceeds(gasPrice, caps.maxFeePerGas) {
+			return nil, false
+		}
+		return &ethtypes.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: gasPrice,
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Data:     tx.Data(),
+		}, true
+	}
+
+	tip, feeCap := bump(tx.GasTipCap()), bump(tx.GasFeeCap())
+	if exceeds(tip, caps.maxPriorityFeePerGas) || exceeds(feeCap, caps.maxFeePerGas) {
+		return nil, false
+	}
+	return &ethtypes.DynamicFeeTx{
+		ChainID:   tx.ChainId(),
+		Nonce:     tx.Nonce(),
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       tx.Gas(),
+		To:        tx.To(),
+		Data:      tx.Data(),
+	}, true
+}
+
+func isNonceError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "nonce too low") || strings.Contains(msg, "nonce too high") || strings.Contains(msg, "already known")
+}
+
+func minBig(v, limit *big.Int) *big.Int {
+	if limit != nil && v.Cmp(limit) > 0 {
+		return new(big.Int).Set(limit)
+	}
+	return v
+}
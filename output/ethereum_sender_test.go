@@ -0,0 +1,306 @@
+package output
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testEthClient struct {
+	mux          sync.Mutex
+	baseFee      *big.Int
+	gasPrice     *big.Int
+	tip          *big.Int
+	pendingNonce uint64
+	minedNonce   uint64
+	sendErr      error
+	sent         []*ethtypes.Transaction
+	head         uint64
+	receipts     map[common.Hash]*ethtypes.Receipt
+	callErr      error
+}
+
+func (c *testEthClient) ChainID(context.Context) (*big.Int, error) { return big.NewInt(1), nil }
+
+func (c *testEthClient) HeaderByNumber(context.Context, *big.Int) (*ethtypes.Header, error) {
+	return &ethtypes.Header{BaseFee: c.baseFee}, nil
+}
+
+func (c *testEthClient) SuggestGasPrice(context.Context) (*big.Int, error) { return c.gasPrice, nil }
+
+func (c *testEthClient) SuggestGasTipCap(context.Context) (*big.Int, error) { return c.tip, nil }
+
+func (c *testEthClient) EstimateGas(context.Context, ethereum.CallMsg) (uint64, error) {
+	return 21000, nil
+}
+
+func (c *testEthClient) PendingNonceAt(context.Context, common.Address) (uint64, error) {
+	return c.pendingNonce, nil
+}
+
+func (c *testEthClient) NonceAt(context.Context, common.Address, *big.Int) (uint64, error) {
+	return c.minedNonce, nil
+}
+
+func (c *testEthClient) SendTransaction(_ context.Context, tx *ethtypes.Transaction) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+	c.sent = append(c.sent, tx)
+	return nil
+}
+
+func (c *testEthClient) BlockNumber(context.Context) (uint64, error) { return c.head, nil }
+
+func (c *testEthClient) TransactionByHash(_ context.Context, hash common.Hash) (*ethtypes.Transaction, bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, tx := range c.sent {
+		if tx.Hash() == hash {
+			return tx, false, nil
+		}
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func (c *testEthClient) TransactionReceipt(_ context.Context, hash common.Hash) (*ethtypes.Receipt, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if r, ok := c.receipts[hash]; ok {
+		return r, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (c *testEthClient) CallContract(context.Context, ethereum.CallMsg, *big.Int) ([]byte, error) {
+	return nil, c.callErr
+}
+
+type testRevertError struct{}
+
+func (testRevertError) Error() string { return "execution reverted" }
+
+// ErrorData returns the abi encoded Error(string) with reason "not allowed"
+func (testRevertError) ErrorData() interface{} {
+	return "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000000b" +
+		"6e6f7420616c6c6f776564000000000000000000000000000000000000000000"
+}
+
+func TestEthSender(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	to := common.HexToAddress("0x1")
+
+	newSender := func(cli *testEthClient) *ethSender {
+		key, err := crypto.GenerateKey()
+		r.NoError(err)
+		s, err := newEthSender(ctx, cli, key)
+		r.NoError(err)
+		return s
+	}
+
+	t.Run("DynamicFeeTx", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10), pendingNonce: 5}
+		s := newSender(cli)
+
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		r.Equal(uint8(ethtypes.DynamicFeeTxType), tx.Type())
+		r.Equal(uint64(5), tx.Nonce())
+		r.Equal(big.NewInt(10), tx.GasTipCap())
+		r.Equal(big.NewInt(210), tx.GasFeeCap())
+
+		signer := ethtypes.NewLondonSigner(big.NewInt(1))
+		from, err := ethtypes.Sender(signer, tx)
+		r.NoError(err)
+		r.Equal(s.from, from)
+	})
+
+	t.Run("FeeCaps", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10)}
+		s := newSender(cli)
+
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{maxFeePerGas: big.NewInt(150), maxPriorityFeePerGas: big.NewInt(5)})
+		r.NoError(err)
+		r.Equal(big.NewInt(5), tx.GasTipCap())
+		r.Equal(big.NewInt(150), tx.GasFeeCap())
+	})
+
+	t.Run("LegacyTxBeforeLondon", func(t *testing.T) {
+		cli := &testEthClient{gasPrice: big.NewInt(50)}
+		s := newSender(cli)
+
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		r.Equal(uint8(ethtypes.LegacyTxType), tx.Type())
+		r.Equal(big.NewInt(50), tx.GasPrice())
+	})
+
+	t.Run("LocalNonce", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10), pendingNonce: 3}
+		s := newSender(cli)
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.send(ctx, to, nil, ethFeeCaps{})
+				r.NoError(err)
+			}()
+		}
+		wg.Wait()
+
+		nonces := map[uint64]bool{}
+		for _, tx := range cli.sent {
+			nonces[tx.Nonce()] = true
+		}
+		r.Equal(map[uint64]bool{3: true, 4: true, 5: true, 6: true, 7: true}, nonces)
+	})
+
+	t.Run("ReloadNonceAfterNonceError", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10), pendingNonce: 1}
+		s := newSender(cli)
+
+		cli.sendErr = errors.New("nonce too low")
+		_, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.Error(err)
+		r.False(s.nonceLoaded)
+
+		cli.sendErr = nil
+		cli.pendingNonce = 9
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		r.Equal(uint64(9), tx.Nonce())
+	})
+
+	t.Run("ResyncNonceAfterBroadcastError", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10), pendingNonce: 1}
+		s := newSender(cli)
+
+		// the tx reaches the mempool but the broadcast times out
+		cli.sendErr = context.DeadlineExceeded
+		_, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.Error(err)
+		r.False(s.nonceLoaded)
+
+		cli.sendErr = nil
+		cli.pendingNonce = 2
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		r.Equal(uint64(2), tx.Nonce())
+	})
+
+	t.Run("StopWatchingStuckTx", func(t *testing.T) {
+		s := newSender(&testEthClient{})
+		done := make(chan struct{})
+		go func() {
+			s.watchStuckTx(time.Millisecond)
+			close(done)
+		}()
+		s.close()
+		s.close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			r.Fail("stuck tx watcher not stopped")
+		}
+	})
+
+	t.Run("ReplaceStuckTx", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10)}
+		s := newSender(cli)
+		s.stuckAfter = time.Millisecond
+
+		mined, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		stuck, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		cli.minedNonce = mined.Nonce() + 1
+		time.Sleep(2 * time.Millisecond)
+
+		r.NoError(s.replaceStuckTx(ctx))
+		r.True(s.pending[mined.Nonce()].mined)
+		r.False(s.pending[stuck.Nonce()].mined)
+		r.Len(cli.sent, 3)
+		replaced := cli.sent[2]
+		r.Equal(stuck.Nonce(), replaced.Nonce())
+		r.Equal(big.NewInt(12), replaced.GasTipCap())
+		r.Equal(big.NewInt(252), replaced.GasFeeCap())
+		r.Equal(replaced.Hash(), s.pending[stuck.Nonce()].tx.Hash())
+	})
+
+	t.Run("StuckTxFeeReachCap", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10)}
+		s := newSender(cli)
+		s.stuckAfter = time.Millisecond
+
+		_, err := s.send(ctx, to, nil, ethFeeCaps{maxFeePerGas: big.NewInt(210)})
+		r.NoError(err)
+		time.Sleep(2 * time.Millisecond)
+
+		r.NoError(s.replaceStuckTx(ctx))
+		r.Len(cli.sent, 1)
+	})
+
+	t.Run("WaitReceiptOfReplacedTx", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10), receipts: map[common.Hash]*ethtypes.Receipt{}}
+		s := newSender(cli)
+		s.stuckAfter = time.Millisecond
+
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		time.Sleep(2 * time.Millisecond)
+		r.NoError(s.replaceStuckTx(ctx))
+		replaced := cli.sent[1]
+
+		cli.mux.Lock()
+		cli.receipts[replaced.Hash()] = &ethtypes.Receipt{TxHash: replaced.Hash(), BlockNumber: big.NewInt(10), Status: ethtypes.ReceiptStatusSuccessful}
+		cli.mux.Unlock()
+
+		cli.head = 10
+		waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err = s.waitReceipt(waitCtx, tx.Hash(), 3, time.Millisecond)
+		r.Error(err)
+
+		cli.head = 12
+		receipt, err := s.waitReceipt(ctx, tx.Hash(), 3, time.Millisecond)
+		r.NoError(err)
+		r.Equal(replaced.Hash(), receipt.TxHash)
+	})
+
+	t.Run("RevertReason", func(t *testing.T) {
+		cli := &testEthClient{baseFee: big.NewInt(100), tip: big.NewInt(10)}
+		s := newSender(cli)
+
+		tx, err := s.send(ctx, to, nil, ethFeeCaps{})
+		r.NoError(err)
+		receipt := &ethtypes.Receipt{TxHash: tx.Hash(), BlockNumber: big.NewInt(1), Status: ethtypes.ReceiptStatusFailed}
+
+		cli.callErr = testRevertError{}
+		r.Equal("not allowed", s.revertReason(ctx, receipt))
+
+		cli.callErr = errors.New("out of gas")
+		r.Equal("out of gas", s.revertReason(ctx, receipt))
+
+		cli.callErr = nil
+		r.Equal("unknown", s.revertReason(ctx, receipt))
+	})
+}
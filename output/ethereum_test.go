@@ -2,22 +2,21 @@ package output
 
 import (
 	"context"
-	"crypto/ecdsa"
 	_ "embed"
 	"encoding/hex"
 	"encoding/json"
 	"math/big"
 	"testing"
+	"time"
 
 	. "github.com/agiledragon/gomonkey/v2"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
+	"github.com/machinefi/sprout/proof"
 	"github.com/machinefi/sprout/types"
 )
 
@@ -134,19 +133,47 @@ func Test_ethereumContract_Output(t *testing.T) {
 				r.Equal(txHash, "")
 				r.Error(err)
 			})
-			proof := &struct {
+			receipt := &struct {
 				Snark map[string]string `json:"Snark"`
 			}{
-				Snark: make(map[string]string),
+				Snark: map[string]string{"journal": "any"},
 			}
 			t.Run("MissingSnarkField", func(t *testing.T) {
-				data, err := json.Marshal(proof)
+				data, err := json.Marshal(receipt)
 				r.NoError(err)
 				hexdata := hex.EncodeToString(data)
 
 				txHash, err := o.Output(&types.Task{}, []byte(hexdata))
 				r.Equal(txHash, "")
-				r.Equal(err, errSnarkProofDataMissingFieldSnark)
+				r.ErrorIs(err, proof.ErrMissingSeal)
+			})
+			t.Run("ReceiptJSONText", func(t *testing.T) {
+				p := NewPatches()
+				defer p.Reset()
+
+				var calldata []byte
+				p = p.ApplyPrivateMethod(&ethereumContract{}, "sendTX",
+					func(contract *ethereumContract, ctx context.Context, data []byte) (string, error) {
+						calldata = data
+						return txHashRet, nil
+					},
+				)
+
+				data := []byte(`{"Snark":{"snark":[1,2],"post_state_digest":[3],"journal":[4,5]}}`)
+				txHash, err := o.Output(&types.Task{}, []byte(hex.EncodeToString(data)))
+				r.NoError(err)
+				r.Equal(txHash, txHashRet)
+
+				ec := o.(*ethereumContract)
+				args, err := ec.contractMethod.Inputs.Unpack(calldata[4:])
+				r.NoError(err)
+				r.Len(args, 2)
+
+				abiBytes, err := abi.NewType("bytes", "", nil)
+				r.NoError(err)
+				snark, err := abi.Arguments{{Type: abiBytes}, {Type: abiBytes}, {Type: abiBytes}}.Unpack(args[0].([]byte))
+				r.NoError(err)
+				r.Equal([]interface{}{[]byte("[1,2]"), []byte("[3]"), []byte("[4,5]")}, snark)
 			})
 		})
 		t.Run("Default", func(t *testing.T) {
@@ -181,6 +208,13 @@ func Test_ethereumContract_Output(t *testing.T) {
 						ProjectID: 1,
 						Data:      [][]byte{[]byte(`{"other":"any"}`)},
 					}, nil)
+					r.Equal(txHash, "")
+					r.ErrorContains(err, "invalid address value")
+
+					txHash, err = o.Output(&types.Task{
+						ProjectID: 1,
+						Data:      [][]byte{[]byte(`{"other":"0x0000000000000000000000000000000000000001"}`)},
+					}, nil)
 					r.Equal(txHash, txHashRet)
 					r.NoError(err)
 				})
@@ -195,8 +229,17 @@ func Test_ethereumContract_Output(t *testing.T) {
 						ProjectID: 1,
 						Data:      [][]byte{[]byte(`{"other":"any"}`)},
 					}, nil)
-					r.Equal(txHash, txHashRet)
-					r.NoError(err)
+					r.Equal(txHash, "")
+					r.ErrorContains(err, "invalid integer value")
+
+					for _, v := range []string{`"0x10"`, `"16"`, `16`} {
+						txHash, err = o.Output(&types.Task{
+							ProjectID: 1,
+							Data:      [][]byte{[]byte(`{"other":` + v + `}`)},
+						}, nil)
+						r.Equal(txHash, txHashRet)
+						r.NoError(err)
+					}
 				})
 				t.Run("Other", func(t *testing.T) {
 					conf.Ethereum.ContractAbiJSON = testABIOtherInputOnlyMethod
@@ -282,127 +325,108 @@ func Test_ethereumContract_sendTX(t *testing.T) {
 
 	ctx := context.Background()
 
-	t.Run("DialEthFailed", func(t *testing.T) {
+	t.Run("GetSenderFailed", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, errors.New(t.Name()))
+		p = p.ApplyFuncReturn(getEthSender, nil, errors.New(t.Name()))
 
 		_, err := contract.sendTX(ctx, nil)
 		r.ErrorContains(err, t.Name())
 	})
 
-	t.Run("SuggestGasFailed", func(t *testing.T) {
+	t.Run("SendFailed", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", nil, errors.New(t.Name()))
+		p = p.ApplyFuncReturn(getEthSender, &ethSender{}, nil)
+		p = p.ApplyPrivateMethod(&ethSender{}, "send", func(*ethSender, context.Context, common.Address, []byte, ethFeeCaps) (*ethtypes.Transaction, error) {
+			return nil, errors.New(t.Name())
+		})
 
 		_, err := contract.sendTX(ctx, nil)
 		r.ErrorContains(err, t.Name())
 	})
 
-	t.Run("GetChainIdFailed", func(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "ChainID", nil, errors.New(t.Name()))
-		_, err := contract.sendTX(ctx, nil)
-		r.ErrorContains(err, t.Name())
-	})
-
-	t.Run("GetNonceFailed", func(t *testing.T) {
-		p := NewPatches()
-		defer p.Reset()
+		tx := ethtypes.NewTx(&ethtypes.DynamicFeeTx{})
+		p = p.ApplyFuncReturn(getEthSender, &ethSender{}, nil)
+		p = p.ApplyPrivateMethod(&ethSender{}, "send", func(*ethSender, context.Context, common.Address, []byte, ethFeeCaps) (*ethtypes.Transaction, error) {
+			return tx, nil
+		})
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "ChainID", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "PendingNonceAt", nil, errors.New(t.Name()))
-		_, err := contract.sendTX(ctx, nil)
-		r.ErrorContains(err, t.Name())
+		txHash, err := contract.sendTX(ctx, nil)
+		r.NoError(err)
+		r.Equal(tx.Hash().Hex(), txHash)
 	})
+}
 
-	t.Run("EstimateGasFailed", func(t *testing.T) {
-		p := NewPatches()
-		defer p.Reset()
+func Test_newEthereum_feeCaps(t *testing.T) {
+	r := require.New(t)
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "ChainID", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "PendingNonceAt", uint64(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "EstimateGas", nil, errors.New(t.Name()))
-		_, err := contract.sendTX(ctx, nil)
-		r.ErrorContains(err, t.Name())
+	c := *conf
+	c.Ethereum.ContractAbiJSON = testABIOtherInputOnlyMethod
+
+	t.Run("InvalidMaxFeePerGas", func(t *testing.T) {
+		c.Ethereum.MaxFeePerGas = "0x1"
+		_, err := New(&c, "1", "")
+		r.ErrorContains(err, "invalid max fee per gas")
+	})
+	t.Run("Success", func(t *testing.T) {
+		c.Ethereum.MaxFeePerGas = "100"
+		c.Ethereum.MaxPriorityFeePerGas = "10"
+		o, err := New(&c, "1", "")
+		r.NoError(err)
+		e := o.(*ethereumContract)
+		r.Equal(big.NewInt(100), e.feeCaps.maxFeePerGas)
+		r.Equal(big.NewInt(10), e.feeCaps.maxPriorityFeePerGas)
 	})
+}
 
-	t.Run("SignTxFailed", func(t *testing.T) {
-		p := NewPatches()
-		defer p.Reset()
+func Test_ethereumContract_WaitConfirmed(t *testing.T) {
+	r := require.New(t)
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "ChainID", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "PendingNonceAt", uint64(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "EstimateGas", uint64(1), nil)
-		p = p.ApplyFuncReturn(ethtypes.SignTx, nil, errors.New(t.Name()))
-		_, err := contract.sendTX(ctx, nil)
-		r.ErrorContains(err, t.Name())
-	})
+	conf.Ethereum.ContractAbiJSON = testABIOtherInputOnlyMethod
+	o, err := New(conf, "1", "")
+	r.NoError(err)
+	contract, ok := o.(*ethereumContract)
+	r.True(ok)
+
+	ctx := context.Background()
 
-	t.Run("TransactionFailed", func(t *testing.T) {
+	t.Run("WaitReceiptFailed", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "ChainID", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "PendingNonceAt", uint64(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "EstimateGas", uint64(1), nil)
-		p = p.ApplyFuncReturn(ethtypes.SignTx, nil, nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SendTransaction", errors.New(t.Name()))
-		_, err := contract.sendTX(ctx, nil)
+		p = p.ApplyFuncReturn(getEthSender, &ethSender{}, nil)
+		p = p.ApplyPrivateMethod(&ethSender{}, "waitReceipt", func(*ethSender, context.Context, common.Hash, uint64, time.Duration) (*ethtypes.Receipt, error) {
+			return nil, errors.New(t.Name())
+		})
+
+		_, err := contract.WaitConfirmed(ctx, "0x1")
 		r.ErrorContains(err, t.Name())
 	})
 
-	t.Run("TransactionSuccess", func(t *testing.T) {
+	t.Run("Reverted", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, nil)
-		p = p.ApplyFuncReturn(crypto.ToECDSAUnsafe, &ecdsa.PrivateKey{})
-		p = p.ApplyFuncReturn(crypto.PubkeyToAddress, common.Address{})
-		p = p.ApplyFuncReturn(common.HexToAddress, common.Address{})
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SuggestGasPrice", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "ChainID", big.NewInt(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "PendingNonceAt", uint64(1), nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "EstimateGas", uint64(1), nil)
-		p = p.ApplyFuncReturn(ethtypes.SignTx, nil, nil)
-		p = p.ApplyMethodReturn(&ethclient.Client{}, "SendTransaction", nil)
-		p = p.ApplyMethodReturn(&ethtypes.Transaction{}, "Hash", common.Hash{})
-		tx, err := contract.sendTX(ctx, nil)
+		p = p.ApplyFuncReturn(getEthSender, &ethSender{}, nil)
+		p = p.ApplyPrivateMethod(&ethSender{}, "waitReceipt", func(*ethSender, context.Context, common.Hash, uint64, time.Duration) (*ethtypes.Receipt, error) {
+			return &ethtypes.Receipt{BlockNumber: big.NewInt(10), GasUsed: 100, Status: ethtypes.ReceiptStatusFailed}, nil
+		})
+		p = p.ApplyPrivateMethod(&ethSender{}, "revertReason", func(*ethSender, context.Context, *ethtypes.Receipt) string {
+			return t.Name()
+		})
+
+		receipt, err := contract.WaitConfirmed(ctx, "0x1")
 		r.NoError(err)
-		r.Equal(tx, "0x0000000000000000000000000000000000000000000000000000000000000000")
+		r.Equal(uint64(10), receipt.BlockNumber)
+		r.Equal(uint64(100), receipt.GasUsed)
+		r.True(receipt.Reverted)
+		r.Equal(t.Name(), receipt.RevertReason)
 	})
 }
@@ -1,6 +1,16 @@
 package output
 
-import "github.com/machinefi/sprout/types"
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/vm"
+)
 
 type Type string
 
@@ -9,6 +19,8 @@ const (
 	EthereumContract Type = "ethereumContract"
 	SolanaProgram    Type = "solanaProgram"
 	Textile          Type = "textile"
+	Webhook          Type = "webhook"
+	Database         Type = "database"
 )
 
 type Config struct {
@@ -16,6 +28,37 @@ type Config struct {
 	Ethereum EthereumConfig `json:"ethereum"`
 	Solana   SolanaConfig   `json:"solana"`
 	Textile  TextileConfig  `json:"textile"`
+	Webhook  WebhookConfig  `json:"webhook"`
+	Database DatabaseConfig `json:"database"`
+	// Optional output doesn't fail the task in the all output mode of project
+	Optional bool `json:"optional,omitempty"`
+	// Batch accumulates the proofs and outputs them together, only the outputs implementing BatchOutput support it
+	Batch *BatchConfig `json:"batch,omitempty"`
+	// ConfirmTimeout is how long the confirmation of the output result is waited for in go duration format,
+	// default 30m; the tasks are marked unconfirmed after it, and the confirmation is still polled
+	ConfirmTimeout string `json:"confirmTimeout,omitempty"`
+	// Options is the raw config of output types registered outside this package
+	Options json.RawMessage `json:"options,omitempty"`
+	// VMType is the vm type of the project generating the proofs, it's set by the project config
+	VMType vm.Type `json:"-"`
+	// DryRun creates the output without connecting to any service, it's set by Validate
+	DryRun bool `json:"-"`
+}
+
+const defaultConfirmTimeout = 30 * time.Minute
+
+// GetConfirmTimeout returns the timeout of waiting for the confirmation of ConfirmedOutput
+func (c *Config) GetConfirmTimeout() (time.Duration, error) {
+	return parseDuration(c.ConfirmTimeout, defaultConfirmTimeout)
+}
+
+// proofVMType returns the vm type the proofs are decoded by, risc0 if unset as the proof layouts
+// of ethereum and textile outputs were risc0 only
+func (c *Config) proofVMType() vm.Type {
+	if c.VMType == "" {
+		return vm.Risc0
+	}
+	return c.VMType
 }
 
 type EthereumConfig struct {
@@ -24,34 +67,300 @@ type EthereumConfig struct {
 	ReceiverAddress string `json:"receiverAddress,omitempty"`
 	ContractMethod  string `json:"contractMethod"`
 	ContractAbiJSON string `json:"contractAbiJSON"`
+	// ContractArgs maps the contract method arguments to values in task or proof, the unmapped ones are filled by name
+	ContractArgs []ValueMapping `json:"contractArgs,omitempty"`
+	// MaxFeePerGas and MaxPriorityFeePerGas cap the transaction fees in wei, no cap if empty
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+	// Confirmations is the number of blocks the transaction receipt is waited for, default 1
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	// BatchMode is how the proofs of a batch are packed into one transaction, required if batch is configured
+	BatchMode EthereumBatchMode `json:"batchMode,omitempty"`
+	// MulticallMethod receives the calldata of all tasks in multicall batch mode, default "multicall"
+	MulticallMethod string `json:"multicallMethod,omitempty"`
 }
 
+type EthereumBatchMode string
+
+const (
+	// EthereumBatchArray calls the contract method once, every input of which is an array holding a value per task
+	EthereumBatchArray EthereumBatchMode = "array"
+	// EthereumBatchMulticall packs the contract method call of each task and passes them to the multicall method as bytes[]
+	EthereumBatchMulticall EthereumBatchMode = "multicall"
+)
+
 type SolanaConfig struct {
-	ChainEndpoint  string `json:"chainEndpoint"`
-	ProgramID      string `json:"programID"`
+	ChainEndpoint string `json:"chainEndpoint"`
+	ProgramID     string `json:"programID"`
+	// StateAccountPK is the only writable account if Accounts is empty
 	StateAccountPK string `json:"stateAccountPK"`
+	// Accounts is the ordered account list of the instruction
+	Accounts    []SolanaAccount   `json:"accounts,omitempty"`
+	Instruction SolanaInstruction `json:"instruction,omitempty"`
+	// ComputeUnitLimit and ComputeUnitPrice (in micro lamports) prepend compute budget instructions if not zero
+	ComputeUnitLimit uint32 `json:"computeUnitLimit,omitempty"`
+	ComputeUnitPrice uint64 `json:"computeUnitPrice,omitempty"`
+}
+
+type SolanaAccount struct {
+	// PubKey is the base58 account address
+	PubKey string `json:"pubKey,omitempty"`
+	// Payer uses the operator account, which is the only signer of the transaction
+	Payer bool `json:"payer,omitempty"`
+	// Seeds derive the program address of SeedsProgramID, default the ProgramID, if PubKey is empty
+	Seeds          []SolanaValue `json:"seeds,omitempty"`
+	SeedsProgramID string        `json:"seedsProgramID,omitempty"`
+	IsSigner       bool          `json:"isSigner,omitempty"`
+	IsWritable     bool          `json:"isWritable,omitempty"`
+}
+
+type SolanaEncoding string
+
+const (
+	// SolanaEncodingLegacy encodes the instruction data as a byte of Index followed by the raw proof
+	SolanaEncodingLegacy SolanaEncoding = ""
+	// SolanaEncodingAnchor prefixes the borsh encoded Args with the 8 bytes discriminator of the anchor method Name
+	SolanaEncodingAnchor SolanaEncoding = "anchor"
+	// SolanaEncodingCustom prefixes the borsh encoded Args with the hex Prefix
+	SolanaEncodingCustom SolanaEncoding = "custom"
+)
+
+type SolanaInstruction struct {
+	Encoding SolanaEncoding `json:"encoding,omitempty"`
+	Index    uint8          `json:"index,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Prefix   string         `json:"prefix,omitempty"`
+	// Args are the instruction arguments, default the proof as bytes
+	Args []SolanaValue `json:"args,omitempty"`
+}
+
+type SolanaValueSource string
+
+const (
+	SolanaValueProof     SolanaValueSource = "proof"
+	SolanaValueProjectID SolanaValueSource = "projectID"
+	SolanaValueTaskID    SolanaValueSource = "taskID"
+	SolanaValueClientID  SolanaValueSource = "clientID"
+	// SolanaValueTaskData reads the gjson Path of task.Data[DataIndex]
+	SolanaValueTaskData SolanaValueSource = "taskData"
+	// SolanaValueConst uses Value
+	SolanaValueConst SolanaValueSource = "const"
+)
+
+type SolanaValueType string
+
+const (
+	// SolanaTypeBytes is borsh Vec<u8>, the u32 length followed by the bytes
+	SolanaTypeBytes SolanaValueType = "bytes"
+	// SolanaTypeRaw is the bytes without length prefix, it's the default type of seeds
+	SolanaTypeRaw    SolanaValueType = "raw"
+	SolanaTypeString SolanaValueType = "string"
+	SolanaTypeU8     SolanaValueType = "u8"
+	SolanaTypeU32    SolanaValueType = "u32"
+	SolanaTypeU64    SolanaValueType = "u64"
+	SolanaTypeBool   SolanaValueType = "bool"
+	SolanaTypePubKey SolanaValueType = "pubkey"
+)
+
+// SolanaValue is an instruction argument or a PDA seed
+type SolanaValue struct {
+	Source    SolanaValueSource `json:"source"`
+	Type      SolanaValueType   `json:"type,omitempty"`
+	DataIndex int               `json:"dataIndex,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Value     string            `json:"value,omitempty"`
 }
 
 type TextileConfig struct {
 	VaultID string `json:"vaultID"`
+	// Endpoint is the Basin API url, default https://basin.tableland.xyz
+	Endpoint string `json:"endpoint,omitempty"`
+	// Timeout of each request in go duration format, default 30s
+	Timeout    string `json:"timeout,omitempty"`
+	MaxRetries uint64 `json:"maxRetries,omitempty"`
+	// RetryInterval in go duration format, doubled after each retry, default 1s
+	RetryInterval string `json:"retryInterval,omitempty"`
+	// MaxRetryTime bounds the time spent in retries in go duration format, default 30s, since the task
+	// outputs wait for it
+	MaxRetryTime string `json:"maxRetryTime,omitempty"`
+}
+
+type DatabaseConfig struct {
+	// DSN locates the store, its scheme selects the KV store registered by RegisterKVStore, postgres is built in
+	DSN string `json:"dsn"`
+	// Table holds the key-values in postgres, default "sprout_outputs"
+	Table string `json:"table,omitempty"`
+	// Key is the go template of the stored key on .ProjectID, .ProjectVersion, .TaskID and .ClientID, default "{{.ProjectID}}/{{.TaskID}}"
+	Key string `json:"key,omitempty"`
+	// Values are the fields of the stored JSON object, the whole proof is stored if empty
+	Values []ValueMapping `json:"values,omitempty"`
+}
+
+type BatchConfig struct {
+	// Size is the max number of proofs in a batch, the batch is flushed once it's full
+	Size uint64 `json:"size"`
+	// Window is how long the first proof of a batch waits at most in go duration format, default 30s
+	Window string `json:"window,omitempty"`
+}
+
+const defaultBatchWindow = 30 * time.Second
+
+// GetWindow returns the batch window, the default one if not configured
+func (c *BatchConfig) GetWindow() (time.Duration, error) {
+	if c.Window == "" {
+		return defaultBatchWindow, nil
+	}
+	d, err := time.ParseDuration(c.Window)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse batch window")
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("non-positive batch window %s", c.Window)
+	}
+	return d, nil
+}
+
+func (c *BatchConfig) validate() error {
+	if c.Size == 0 {
+		return errors.New("batch size is zero")
+	}
+	_, err := c.GetWindow()
+	return err
+}
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Secret is the HMAC-SHA256 key used to sign the request, the request is unsigned if empty
+	Secret  string            `json:"secret,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout of each request in go duration format, default 10s
+	Timeout    string `json:"timeout,omitempty"`
+	MaxRetries uint64 `json:"maxRetries,omitempty"`
+	// RetryInterval in go duration format, doubled after each retry, default 1s
+	RetryInterval string `json:"retryInterval,omitempty"`
+	// MaxRetryTime bounds the time spent in retries in go duration format, default 30s, since the task
+	// outputs wait for it
+	MaxRetryTime string `json:"maxRetryTime,omitempty"`
 }
 
 type Output interface {
 	Output(task *types.Task, proof []byte) (string, error)
 }
 
-func New(conf *Config, privateKeyECDSA, privateKeyED25519 string) (Output, error) {
-	switch conf.Type {
-	case EthereumContract:
-		ethConf := conf.Ethereum
-		return newEthereum(ethConf.ChainEndpoint, privateKeyECDSA, ethConf.ContractAddress, ethConf.ReceiverAddress, ethConf.ContractAbiJSON, ethConf.ContractMethod)
-	case SolanaProgram:
-		solConf := conf.Solana
-		return newSolanaProgram(solConf.ChainEndpoint, solConf.ProgramID, privateKeyED25519, solConf.StateAccountPK)
-	case Textile:
-		textileConf := conf.Textile
-		return newTextileDBAdapter(textileConf.VaultID, privateKeyECDSA)
-	default:
+// SignedOutput is implemented by the outputs which deliver the prover's signature along with the proof
+type SignedOutput interface {
+	OutputSigned(task *types.Task, proof []byte, proverID, signature string) (string, error)
+}
+
+// BatchOutput is implemented by the outputs which can deliver the proofs of several tasks at once
+type BatchOutput interface {
+	// OutputBatch outputs the proofs, proofs[i] belongs to tasks[i], the result is shared by all tasks
+	OutputBatch(tasks []*types.Task, proofs [][]byte) (string, error)
+}
+
+// Receipt is the final status of an output result
+type Receipt struct {
+	TxHash       string `json:"txHash"`
+	BlockNumber  uint64 `json:"blockNumber"`
+	GasUsed      uint64 `json:"gasUsed"`
+	Reverted     bool   `json:"reverted"`
+	RevertReason string `json:"revertReason,omitempty"`
+}
+
+// ConfirmedOutput is implemented by the outputs whose result is final only after confirmation
+type ConfirmedOutput interface {
+	// WaitConfirmed blocks until the output result is confirmed or reverted
+	WaitConfirmed(ctx context.Context, result string) (*Receipt, error)
+}
+
+// Factory creates an output from the project output config and the operator keys
+type Factory func(conf *Config, privateKeyECDSA, privateKeyED25519 string) (Output, error)
+
+var (
+	factoriesMux sync.RWMutex
+	factories    = map[Type]Factory{}
+)
+
+func init() {
+	Register(Stdout, func(*Config, string, string) (Output, error) {
 		return newStdout(), nil
+	})
+	Register(EthereumContract, func(conf *Config, privateKeyECDSA, _ string) (Output, error) {
+		if conf.Batch != nil && conf.Ethereum.BatchMode == "" {
+			return nil, errors.New("ethereum batch mode is required by batch output")
+		}
+		return newEthereum(&conf.Ethereum, conf.proofVMType(), privateKeyECDSA)
+	})
+	Register(SolanaProgram, func(conf *Config, _, privateKeyED25519 string) (Output, error) {
+		return newSolanaProgram(&conf.Solana, privateKeyED25519)
+	})
+	Register(Textile, func(conf *Config, privateKeyECDSA, _ string) (Output, error) {
+		return newTextileDBAdapter(&conf.Textile, conf.proofVMType(), privateKeyECDSA)
+	})
+	Register(Webhook, func(conf *Config, _, _ string) (Output, error) {
+		return newWebhook(&conf.Webhook)
+	})
+	Register(Database, func(conf *Config, _, _ string) (Output, error) {
+		return newDatabase(&conf.Database, conf.DryRun)
+	})
+}
+
+// Register makes an output type available to New, it panics if the factory is nil or the type is registered twice
+func Register(t Type, f Factory) {
+	factoriesMux.Lock()
+	defer factoriesMux.Unlock()
+
+	if f == nil {
+		panic("output: register nil factory of type " + string(t))
+	}
+	if _, ok := factories[t]; ok {
+		panic("output: register type twice " + string(t))
+	}
+	factories[t] = f
+}
+
+// dry run keys stand for the operator keys while validating, they are never used to sign
+const (
+	dryRunKeyECDSA   = "0x0101010101010101010101010101010101010101010101010101010101010101"
+	dryRunKeyED25519 = "0x0202020202020202020202020202020202020202020202020202020202020202"
+)
+
+// Validate creates the output in dry run mode, so a broken config is found before the first proof is output
+func Validate(conf *Config) error {
+	c := *conf
+	c.DryRun = true
+	_, err := New(&c, dryRunKeyECDSA, dryRunKeyED25519)
+	return err
+}
+
+func New(conf *Config, privateKeyECDSA, privateKeyED25519 string) (Output, error) {
+	t := conf.Type
+	if t == "" {
+		t = Stdout
+	}
+
+	if _, err := conf.GetConfirmTimeout(); err != nil {
+		return nil, errors.Wrap(err, "invalid confirm timeout")
+	}
+
+	factoriesMux.RLock()
+	f, ok := factories[t]
+	factoriesMux.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("unsupported output type %s", t)
+	}
+	o, err := f(conf, privateKeyECDSA, privateKeyED25519)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Batch != nil {
+		if err := conf.Batch.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid batch config")
+		}
+		if _, ok := o.(BatchOutput); !ok {
+			return nil, errors.Errorf("output type %s not support batch", t)
+		}
 	}
+	return o, nil
 }
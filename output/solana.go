@@ -3,43 +3,56 @@ package output
 import (
 	"context"
 	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/blocto/solana-go-sdk/client"
 	solcommon "github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/program/compute_budget"
+	"github.com/blocto/solana-go-sdk/rpc"
 	soltypes "github.com/blocto/solana-go-sdk/types"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
 
 	"github.com/machinefi/sprout/types"
 )
 
+var solanaStatusPollInterval = 2 * time.Second
+
 type solanaProgram struct {
-	endpoint       string
-	programID      string
-	secretKey      string
-	stateAccountPK string
+	endpoint         string
+	programID        solcommon.PublicKey
+	account          soltypes.Account
+	accounts         []SolanaAccount
+	instruction      SolanaInstruction
+	computeUnitLimit uint32
+	computeUnitPrice uint64
 }
 
 func (e *solanaProgram) Output(task *types.Task, proof []byte) (string, error) {
 	slog.Debug("outputing to solana program", "chain endpoint", e.endpoint)
-	ins := e.packInstructions(proof)
-	txHash, err := e.sendTX(ins)
+	ins, err := e.packInstructions(task, proof)
 	if err != nil {
 		return "", err
 	}
+	return e.sendTX(ins)
+}
 
-	return txHash, nil
+// WaitConfirmed waits for the transaction to be finalized until ctx is done, a failed transaction is reported
+// as reverted
+func (e *solanaProgram) WaitConfirmed(ctx context.Context, txHash string) (*Receipt, error) {
+	return e.waitFinalized(ctx, txHash)
 }
 
 func (e *solanaProgram) sendTX(ins []soltypes.Instruction) (string, error) {
 	cli := client.NewClient(e.endpoint)
-	b := common.FromHex(e.secretKey)
-	pk := ed25519.PrivateKey(b)
-	account := soltypes.Account{
-		PublicKey:  solcommon.PublicKeyFromBytes(pk.Public().(ed25519.PublicKey)),
-		PrivateKey: pk,
-	}
 	if len(ins) == 0 {
 		return "", errors.New("missing instruction data")
 	}
@@ -50,11 +63,11 @@ func (e *solanaProgram) sendTX(ins []soltypes.Instruction) (string, error) {
 	}
 	tx, err := soltypes.NewTransaction(soltypes.NewTransactionParam{
 		Message: soltypes.NewMessage(soltypes.NewMessageParam{
-			FeePayer:        account.PublicKey,
+			FeePayer:        e.account.PublicKey,
 			RecentBlockhash: resp.Blockhash,
 			Instructions:    ins,
 		}),
-		Signers: []soltypes.Account{account},
+		Signers: []soltypes.Account{e.account},
 	})
 	if err != nil {
 		return "", errors.Wrap(err, "failed to build solana raw tx")
@@ -67,44 +80,315 @@ func (e *solanaProgram) sendTX(ins []soltypes.Instruction) (string, error) {
 	return hash, nil
 }
 
-// encodeData encodes the proof into the data field of the instruction
-// the first byte is the instruction, which is 0 for now;
-// the rest is the proof data.
-// e.g. assume proof is [0x01, 0x02, 0x03], then the encoded data is [0x00, 0x01, 0x02, 0x03]
-func (e *solanaProgram) encodeData(proof []byte) []byte {
+// waitFinalized polls the signature status until the transaction is finalized or failed
+func (e *solanaProgram) waitFinalized(ctx context.Context, signature string) (*Receipt, error) {
+	cli := client.NewClient(e.endpoint)
+	for {
+		status, err := cli.GetSignatureStatus(ctx, signature)
+		if err != nil {
+			slog.Warn("failed to get solana signature status", "signature", signature, "error", err)
+		} else if status != nil {
+			if status.Err != nil {
+				return &Receipt{
+					TxHash:       signature,
+					BlockNumber:  status.Slot,
+					Reverted:     true,
+					RevertReason: fmt.Sprintf("%v", status.Err),
+				}, nil
+			}
+			if status.ConfirmationStatus != nil && *status.ConfirmationStatus == rpc.CommitmentFinalized {
+				return &Receipt{TxHash: signature, BlockNumber: status.Slot}, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "solana tx %s not finalized", signature)
+		case <-time.After(solanaStatusPollInterval):
+		}
+	}
+}
+
+// encodeData encodes the instruction data
+// the legacy encoding is a byte of the instruction index followed by the proof,
+// e.g. assume proof is [0x01, 0x02, 0x03], then the encoded data is [0x00, 0x01, 0x02, 0x03];
+// the anchor and custom encodings are a prefix followed by the borsh encoded arguments
+func (e *solanaProgram) encodeData(task *types.Task, proof []byte) ([]byte, error) {
 	data := []byte{}
-	data = append(data, byte(0)) // 0 means submit proof
-	data = append(data, proof...)
-	return data
+	switch e.instruction.Encoding {
+	case SolanaEncodingLegacy:
+		data = append(data, e.instruction.Index)
+		return append(data, proof...), nil
+	case SolanaEncodingAnchor:
+		data = append(data, anchorDiscriminator(e.instruction.Name)...)
+	case SolanaEncodingCustom:
+		data = append(data, common.FromHex(e.instruction.Prefix)...)
+	}
+
+	args := e.instruction.Args
+	if len(args) == 0 {
+		args = []SolanaValue{{Source: SolanaValueProof, Type: SolanaTypeBytes}}
+	}
+	for i := range args {
+		b, err := args[i].encode(task, proof, SolanaTypeBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode instruction argument %v", i)
+		}
+		data = append(data, b...)
+	}
+	return data, nil
 }
 
-func (e *solanaProgram) packInstructions(proof []byte) []soltypes.Instruction {
-	accounts := []soltypes.AccountMeta{}
-	if e.stateAccountPK != "" {
-		accounts = append(accounts, soltypes.AccountMeta{
-			PubKey:     solcommon.PublicKeyFromString(e.stateAccountPK),
-			IsSigner:   false,
-			IsWritable: true,
-		})
-	}
-
-	return []soltypes.Instruction{
-		{
-			ProgramID: solcommon.PublicKeyFromString(e.programID),
-			Accounts:  accounts,
-			Data:      e.encodeData(proof),
-		},
+func (e *solanaProgram) packAccounts(task *types.Task, proof []byte) ([]soltypes.AccountMeta, error) {
+	accounts := make([]soltypes.AccountMeta, 0, len(e.accounts))
+	for i := range e.accounts {
+		a := &e.accounts[i]
+		meta := soltypes.AccountMeta{IsSigner: a.IsSigner, IsWritable: a.IsWritable}
+		switch {
+		case a.Payer:
+			meta.PubKey = e.account.PublicKey
+		case a.PubKey != "":
+			meta.PubKey = solcommon.PublicKeyFromString(a.PubKey)
+		default:
+			seeds := make([][]byte, 0, len(a.Seeds))
+			for j := range a.Seeds {
+				b, err := a.Seeds[j].encode(task, proof, SolanaTypeRaw)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to encode seed %v of account %v", j, i)
+				}
+				seeds = append(seeds, b)
+			}
+			programID := e.programID
+			if a.SeedsProgramID != "" {
+				programID = solcommon.PublicKeyFromString(a.SeedsProgramID)
+			}
+			pk, _, err := solcommon.FindProgramAddress(seeds, programID)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to derive program address of account %v", i)
+			}
+			meta.PubKey = pk
+		}
+		accounts = append(accounts, meta)
 	}
+	return accounts, nil
 }
 
-func newSolanaProgram(endpoint, programID, secretKey, stateAccountPK string) (Output, error) {
+func (e *solanaProgram) packInstructions(task *types.Task, proof []byte) ([]soltypes.Instruction, error) {
+	accounts, err := e.packAccounts(task, proof)
+	if err != nil {
+		return nil, err
+	}
+	data, err := e.encodeData(task, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	ins := []soltypes.Instruction{}
+	if e.computeUnitLimit > 0 {
+		ins = append(ins, compute_budget.SetComputeUnitLimit(compute_budget.SetComputeUnitLimitParam{Units: e.computeUnitLimit}))
+	}
+	if e.computeUnitPrice > 0 {
+		ins = append(ins, compute_budget.SetComputeUnitPrice(compute_budget.SetComputeUnitPriceParam{MicroLamports: e.computeUnitPrice}))
+	}
+	return append(ins, soltypes.Instruction{
+		ProgramID: e.programID,
+		Accounts:  accounts,
+		Data:      data,
+	}), nil
+}
+
+// anchorDiscriminator returns the first 8 bytes of sha256("global:<method name>")
+func anchorDiscriminator(name string) []byte {
+	h := sha256.Sum256([]byte("global:" + name))
+	return h[:8]
+}
+
+func (v *SolanaValue) validate() error {
+	switch v.Source {
+	case SolanaValueProof, SolanaValueProjectID, SolanaValueTaskID, SolanaValueClientID, SolanaValueConst:
+	case SolanaValueTaskData:
+		if v.DataIndex < 0 {
+			return errors.Errorf("invalid data index %v", v.DataIndex)
+		}
+	default:
+		return errors.Errorf("unsupported value source %s", v.Source)
+	}
+	switch v.Type {
+	case "", SolanaTypeBytes, SolanaTypeRaw, SolanaTypeString, SolanaTypeU8, SolanaTypeU32, SolanaTypeU64, SolanaTypeBool, SolanaTypePubKey:
+	default:
+		return errors.Errorf("unsupported value type %s", v.Type)
+	}
+	return nil
+}
+
+// encode returns the value in the borsh layout of its type, the ids are u64 by default, others are defaultType
+func (v *SolanaValue) encode(task *types.Task, proof []byte, defaultType SolanaValueType) ([]byte, error) {
+	var raw []byte
+	switch v.Source {
+	case SolanaValueProof:
+		raw = proof
+	case SolanaValueProjectID:
+		raw = []byte(strconv.FormatUint(task.ProjectID, 10))
+	case SolanaValueTaskID:
+		raw = []byte(strconv.FormatUint(task.ID, 10))
+	case SolanaValueClientID:
+		raw = []byte(task.ClientID)
+	case SolanaValueTaskData:
+		if v.DataIndex >= len(task.Data) {
+			return nil, errors.Errorf("task data index %v out of range", v.DataIndex)
+		}
+		if v.Path == "" {
+			raw = task.Data[v.DataIndex]
+			break
+		}
+		r := gjson.GetBytes(task.Data[v.DataIndex], v.Path)
+		if !r.Exists() {
+			return nil, errors.Errorf("path %s not exist in task data", v.Path)
+		}
+		raw = []byte(r.String())
+	case SolanaValueConst:
+		raw = []byte(v.Value)
+	}
+
+	typ := v.Type
+	if typ == "" {
+		typ = defaultType
+		if v.Source == SolanaValueProjectID || v.Source == SolanaValueTaskID {
+			typ = SolanaTypeU64
+		}
+	}
+
+	switch typ {
+	case SolanaTypeBytes, SolanaTypeRaw:
+		b := raw
+		if v.Source != SolanaValueProof {
+			if hexStr, isHex := strings.CutPrefix(string(raw), "0x"); isHex {
+				decoded, err := hex.DecodeString(hexStr)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid hex bytes %s", raw)
+				}
+				b = decoded
+			}
+		}
+		if typ == SolanaTypeRaw {
+			return b, nil
+		}
+		return append(binary.LittleEndian.AppendUint32(nil, uint32(len(b))), b...), nil
+	case SolanaTypeString:
+		return append(binary.LittleEndian.AppendUint32(nil, uint32(len(raw))), raw...), nil
+	case SolanaTypeU8, SolanaTypeU32, SolanaTypeU64:
+		bits := map[SolanaValueType]int{SolanaTypeU8: 8, SolanaTypeU32: 32, SolanaTypeU64: 64}[typ]
+		n, err := strconv.ParseUint(string(raw), 0, bits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s value %s", typ, raw)
+		}
+		return binary.LittleEndian.AppendUint64(nil, n)[:bits/8], nil
+	case SolanaTypeBool:
+		b, err := strconv.ParseBool(string(raw))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid bool value %s", raw)
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case SolanaTypePubKey:
+		pk, err := parseSolanaPubKey(string(raw))
+		if err != nil {
+			return nil, err
+		}
+		return pk.Bytes(), nil
+	}
+	return nil, errors.Errorf("unsupported value type %s", typ)
+}
+
+func parseSolanaPubKey(s string) (solcommon.PublicKey, error) {
+	pk := solcommon.PublicKeyFromString(s)
+	if s == "" || pk.ToBase58() != s {
+		return solcommon.PublicKey{}, errors.Errorf("invalid solana public key %s", s)
+	}
+	return pk, nil
+}
+
+func newSolanaProgram(conf *SolanaConfig, secretKey string) (Output, error) {
 	if secretKey == "" {
 		return nil, errors.New("secret key is empty")
 	}
+	var pk ed25519.PrivateKey
+	switch b := common.FromHex(secretKey); len(b) {
+	case ed25519.SeedSize:
+		pk = ed25519.NewKeyFromSeed(b)
+	case ed25519.PrivateKeySize:
+		pk = ed25519.PrivateKey(b)
+	default:
+		return nil, errors.New("invalid secret key length")
+	}
+	programID, err := parseSolanaPubKey(conf.ProgramID)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid program id")
+	}
+
+	accounts := conf.Accounts
+	if len(accounts) == 0 && conf.StateAccountPK != "" {
+		accounts = []SolanaAccount{{PubKey: conf.StateAccountPK, IsWritable: true}}
+	}
+	for i := range accounts {
+		a := &accounts[i]
+		if a.IsSigner && !a.Payer {
+			return nil, errors.Errorf("account %v is signer, only the payer can sign", i)
+		}
+		switch {
+		case a.Payer:
+		case a.PubKey != "":
+			if _, err := parseSolanaPubKey(a.PubKey); err != nil {
+				return nil, errors.Wrapf(err, "invalid account %v", i)
+			}
+		case len(a.Seeds) > 0:
+			if a.SeedsProgramID != "" {
+				if _, err := parseSolanaPubKey(a.SeedsProgramID); err != nil {
+					return nil, errors.Wrapf(err, "invalid seeds program id of account %v", i)
+				}
+			}
+			for j := range a.Seeds {
+				if err := a.Seeds[j].validate(); err != nil {
+					return nil, errors.Wrapf(err, "invalid seed %v of account %v", j, i)
+				}
+			}
+		default:
+			return nil, errors.Errorf("account %v has neither public key nor seeds", i)
+		}
+	}
+
+	ins := conf.Instruction
+	switch ins.Encoding {
+	case SolanaEncodingLegacy:
+	case SolanaEncodingAnchor:
+		if ins.Name == "" {
+			return nil, errors.New("anchor instruction name is empty")
+		}
+	case SolanaEncodingCustom:
+		if _, err := hex.DecodeString(strings.TrimPrefix(ins.Prefix, "0x")); err != nil {
+			return nil, errors.Wrap(err, "invalid custom instruction prefix")
+		}
+	default:
+		return nil, errors.Errorf("unsupported instruction encoding %s", ins.Encoding)
+	}
+	for i := range ins.Args {
+		if err := ins.Args[i].validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid instruction argument %v", i)
+		}
+	}
+
 	return &solanaProgram{
-		endpoint:       endpoint,
-		programID:      programID,
-		secretKey:      secretKey,
-		stateAccountPK: stateAccountPK,
+		endpoint:  conf.ChainEndpoint,
+		programID: programID,
+		account: soltypes.Account{
+			PublicKey:  solcommon.PublicKeyFromBytes(pk.Public().(ed25519.PublicKey)),
+			PrivateKey: pk,
+		},
+		accounts:         accounts,
+		instruction:      ins,
+		computeUnitLimit: conf.ComputeUnitLimit,
+		computeUnitPrice: conf.ComputeUnitPrice,
 	}, nil
 }
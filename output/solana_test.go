@@ -1,10 +1,16 @@
 package output
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"testing"
+	"time"
 
 	. "github.com/agiledragon/gomonkey/v2"
 	"github.com/blocto/solana-go-sdk/client"
+	solcommon "github.com/blocto/solana-go-sdk/common"
+	"github.com/blocto/solana-go-sdk/rpc"
 	soltypes "github.com/blocto/solana-go-sdk/types"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
@@ -12,42 +18,162 @@ import (
 	"github.com/machinefi/sprout/types"
 )
 
+const (
+	testSolanaSecretKey = "fd6ac80f1b9886a6d157cd8e71f842a63c52ebd237cf48fba03ae587e197d511f0b2439ae6da236d26f17f56c68f05d48513cd99b33143fa0b1aec7838ce4276"
+	testSolanaProgramID = "11111111111111111111111111111111"
+	testSolanaAccount   = "SysvarC1ock11111111111111111111111111111111"
+)
+
+func newTestSolanaProgram(r *require.Assertions, conf *SolanaConfig) *solanaProgram {
+	if conf.ProgramID == "" {
+		conf.ProgramID = testSolanaProgramID
+	}
+	o, err := newSolanaProgram(conf, testSolanaSecretKey)
+	r.NoError(err)
+	return o.(*solanaProgram)
+}
+
 func patchSolanaProgramSendTX(p *Patches, txhash string, err error) *Patches {
 	return p.ApplyPrivateMethod(&solanaProgram{}, "sendTX", func(*solanaProgram, []soltypes.Instruction) (string, error) {
 		return txhash, err
 	})
 }
 
+func Test_newSolanaProgram(t *testing.T) {
+	r := require.New(t)
+
+	cases := []struct {
+		name string
+		conf *SolanaConfig
+		err  string
+	}{
+		{"InvalidProgramID", &SolanaConfig{ProgramID: "any"}, "invalid program id"},
+		{"SignerNotPayer", &SolanaConfig{Accounts: []SolanaAccount{{PubKey: testSolanaAccount, IsSigner: true}}}, "only the payer can sign"},
+		{"InvalidAccount", &SolanaConfig{Accounts: []SolanaAccount{{PubKey: "any"}}}, "invalid account 0"},
+		{"EmptyAccount", &SolanaConfig{Accounts: []SolanaAccount{{}}}, "neither public key nor seeds"},
+		{"InvalidSeed", &SolanaConfig{Accounts: []SolanaAccount{{Seeds: []SolanaValue{{Source: "any"}}}}}, "unsupported value source"},
+		{"AnchorWithoutName", &SolanaConfig{Instruction: SolanaInstruction{Encoding: SolanaEncodingAnchor}}, "name is empty"},
+		{"InvalidPrefix", &SolanaConfig{Instruction: SolanaInstruction{Encoding: SolanaEncodingCustom, Prefix: "0xzz"}}, "invalid custom instruction prefix"},
+		{"InvalidArgType", &SolanaConfig{Instruction: SolanaInstruction{Encoding: SolanaEncodingCustom, Args: []SolanaValue{{Source: SolanaValueProof, Type: "any"}}}}, "unsupported value type"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.conf.ProgramID == "" {
+				c.conf.ProgramID = testSolanaProgramID
+			}
+			_, err := newSolanaProgram(c.conf, testSolanaSecretKey)
+			r.ErrorContains(err, c.err)
+		})
+	}
+	t.Run("InvalidSecretKey", func(t *testing.T) {
+		_, err := newSolanaProgram(&SolanaConfig{ProgramID: testSolanaProgramID}, "0x01")
+		r.ErrorContains(err, "invalid secret key length")
+	})
+}
+
+func Test_solanaProgram_packInstructions(t *testing.T) {
+	r := require.New(t)
+	task := &types.Task{ID: 2, ProjectID: 1, ClientID: "client", Data: [][]byte{[]byte(`{"owner":"` + testSolanaAccount + `","amount":"0x10"}`)}}
+	proof := []byte("proof")
+
+	t.Run("Legacy", func(t *testing.T) {
+		e := newTestSolanaProgram(r, &SolanaConfig{StateAccountPK: testSolanaAccount})
+		ins, err := e.packInstructions(task, proof)
+		r.NoError(err)
+		r.Len(ins, 1)
+		r.Equal(append([]byte{0}, proof...), ins[0].Data)
+		r.Equal([]soltypes.AccountMeta{{PubKey: solcommon.PublicKeyFromString(testSolanaAccount), IsWritable: true}}, ins[0].Accounts)
+	})
+	t.Run("Anchor", func(t *testing.T) {
+		e := newTestSolanaProgram(r, &SolanaConfig{
+			Accounts: []SolanaAccount{
+				{Payer: true, IsSigner: true, IsWritable: true},
+				{Seeds: []SolanaValue{{Source: SolanaValueConst, Value: "task"}, {Source: SolanaValueProjectID}, {Source: SolanaValueTaskID}}, IsWritable: true},
+			},
+			Instruction: SolanaInstruction{
+				Encoding: SolanaEncodingAnchor,
+				Name:     "submit_proof",
+				Args: []SolanaValue{
+					{Source: SolanaValueTaskID},
+					{Source: SolanaValueClientID, Type: SolanaTypeString},
+					{Source: SolanaValueTaskData, Path: "owner", Type: SolanaTypePubKey},
+					{Source: SolanaValueTaskData, Path: "amount", Type: SolanaTypeU8},
+					{Source: SolanaValueConst, Value: "true", Type: SolanaTypeBool},
+					{Source: SolanaValueProof},
+				},
+			},
+			ComputeUnitLimit: 400000,
+			ComputeUnitPrice: 1,
+		})
+		ins, err := e.packInstructions(task, proof)
+		r.NoError(err)
+		r.Len(ins, 3)
+		r.Equal(solcommon.ComputeBudgetProgramID, ins[0].ProgramID)
+		r.Equal(solcommon.ComputeBudgetProgramID, ins[1].ProgramID)
+
+		pda, _, err := solcommon.FindProgramAddress([][]byte{[]byte("task"), binary.LittleEndian.AppendUint64(nil, 1), binary.LittleEndian.AppendUint64(nil, 2)}, e.programID)
+		r.NoError(err)
+		r.Equal([]soltypes.AccountMeta{
+			{PubKey: e.account.PublicKey, IsSigner: true, IsWritable: true},
+			{PubKey: pda, IsWritable: true},
+		}, ins[2].Accounts)
+
+		h := sha256.Sum256([]byte("global:submit_proof"))
+		expect := append([]byte{}, h[:8]...)
+		expect = binary.LittleEndian.AppendUint64(expect, 2)
+		expect = append(binary.LittleEndian.AppendUint32(expect, 6), "client"...)
+		expect = append(expect, solcommon.PublicKeyFromString(testSolanaAccount).Bytes()...)
+		expect = append(expect, 0x10, 1)
+		expect = append(binary.LittleEndian.AppendUint32(expect, uint32(len(proof))), proof...)
+		r.Equal(expect, ins[2].Data)
+	})
+	t.Run("Custom", func(t *testing.T) {
+		e := newTestSolanaProgram(r, &SolanaConfig{Instruction: SolanaInstruction{Encoding: SolanaEncodingCustom, Prefix: "0x0a0b"}})
+		ins, err := e.packInstructions(task, proof)
+		r.NoError(err)
+		r.Equal(append([]byte{0x0a, 0x0b, byte(len(proof)), 0, 0, 0}, proof...), ins[0].Data)
+	})
+	t.Run("FailedToEncodeArgument", func(t *testing.T) {
+		e := newTestSolanaProgram(r, &SolanaConfig{Instruction: SolanaInstruction{Encoding: SolanaEncodingCustom, Args: []SolanaValue{{Source: SolanaValueTaskData, Path: "owner", Type: SolanaTypeU64}}}})
+		_, err := e.packInstructions(task, proof)
+		r.ErrorContains(err, "invalid u64 value")
+	})
+	t.Run("FailedToDeriveAccount", func(t *testing.T) {
+		e := newTestSolanaProgram(r, &SolanaConfig{Accounts: []SolanaAccount{{Seeds: []SolanaValue{{Source: SolanaValueProof}}}}})
+		_, err := e.packInstructions(task, make([]byte, 33))
+		r.ErrorContains(err, "failed to derive program address")
+	})
+}
+
 func Test_solanaProgram_Output(t *testing.T) {
 	r := require.New(t)
-	e1 := &solanaProgram{stateAccountPK: ""}
-	e2 := &solanaProgram{stateAccountPK: "any"}
+	e := newTestSolanaProgram(r, &SolanaConfig{})
 
+	t.Run("FailedToPackInstructions", func(t *testing.T) {
+		e := newTestSolanaProgram(r, &SolanaConfig{Instruction: SolanaInstruction{Encoding: SolanaEncodingCustom, Args: []SolanaValue{{Source: SolanaValueTaskData}}}})
+		_, err := e.Output(&types.Task{}, nil)
+		r.ErrorContains(err, "out of range")
+	})
 	t.Run("FailedToSendTX", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 		p = patchSolanaProgramSendTX(p, "", errors.New(t.Name()))
 
-		txHash, err := e1.Output(&types.Task{}, nil)
-		r.Equal(txHash, "")
-		r.ErrorContains(err, t.Name())
-
-		txHash, err = e2.Output(&types.Task{}, nil)
+		txHash, err := e.Output(&types.Task{}, nil)
 		r.Equal(txHash, "")
 		r.ErrorContains(err, t.Name())
 	})
-
 	t.Run("Success", func(t *testing.T) {
 		txHashRet := "anyTxHash"
 		p := NewPatches()
 		defer p.Reset()
 		p = patchSolanaProgramSendTX(p, txHashRet, nil)
+		p = p.ApplyFunc(client.NewClient, func(string) *client.Client {
+			r.Fail("output should not wait for the transaction")
+			return nil
+		})
 
-		txHash, err := e1.Output(&types.Task{}, nil)
-		r.Equal(txHash, txHashRet)
-		r.NoError(err)
-
-		txHash, err = e2.Output(&types.Task{}, nil)
+		txHash, err := e.Output(&types.Task{}, nil)
 		r.Equal(txHash, txHashRet)
 		r.NoError(err)
 	})
@@ -58,10 +184,9 @@ func Test_solanaProgram_sendTX(t *testing.T) {
 	p := NewPatches()
 	defer p.Reset()
 
-	contract := &solanaProgram{
-		secretKey: "fd6ac80f1b9886a6d157cd8e71f842a63c52ebd237cf48fba03ae587e197d511f0b2439ae6da236d26f17f56c68f05d48513cd99b33143fa0b1aec7838ce4276",
-	}
-	ins := contract.packInstructions([]byte("proof"))
+	contract := newTestSolanaProgram(r, &SolanaConfig{})
+	ins, err := contract.packInstructions(&types.Task{}, []byte("proof"))
+	r.NoError(err)
 
 	t.Run("MissingInstructionData", func(t *testing.T) {
 		p = p.ApplyFuncReturn(client.NewClient, &client.Client{})
@@ -97,3 +222,46 @@ func Test_solanaProgram_sendTX(t *testing.T) {
 		r.Equal(t.Name(), hash)
 	})
 }
+
+func Test_solanaProgram_WaitConfirmed(t *testing.T) {
+	r := require.New(t)
+	p := NewPatches()
+	defer p.Reset()
+
+	interval := solanaStatusPollInterval
+	solanaStatusPollInterval = time.Millisecond
+	defer func() { solanaStatusPollInterval = interval }()
+
+	contract := newTestSolanaProgram(r, &SolanaConfig{})
+	p = p.ApplyFuncReturn(client.NewClient, &client.Client{})
+
+	status := func(c rpc.Commitment, err any) *rpc.SignatureStatus {
+		return &rpc.SignatureStatus{Slot: 10, ConfirmationStatus: &c, Err: err}
+	}
+
+	t.Run("Failed", func(t *testing.T) {
+		p = p.ApplyMethodReturn(&client.Client{}, "GetSignatureStatus", status(rpc.CommitmentProcessed, "InstructionError"), nil)
+		receipt, err := contract.WaitConfirmed(context.Background(), "sig")
+		r.NoError(err)
+		r.True(receipt.Reverted)
+		r.Contains(receipt.RevertReason, "InstructionError")
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		p = p.ApplyMethodReturn(&client.Client{}, "GetSignatureStatus", status(rpc.CommitmentConfirmed, nil), nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := contract.WaitConfirmed(ctx, "sig")
+		r.ErrorContains(err, "not finalized")
+	})
+	t.Run("Finalized", func(t *testing.T) {
+		outputs := []OutputCell{
+			{Values: Params{nil, errors.New("rpc error")}},
+			{Values: Params{nil, nil}},
+			{Values: Params{status(rpc.CommitmentFinalized, nil), nil}},
+		}
+		p = p.ApplyMethodSeq(&client.Client{}, "GetSignatureStatus", outputs)
+		receipt, err := contract.WaitConfirmed(context.Background(), "sig")
+		r.NoError(err)
+		r.Equal(&Receipt{TxHash: "sig", BlockNumber: 10}, receipt)
+	})
+}
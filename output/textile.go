@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -19,12 +20,27 @@ import (
 	"github.com/tablelandnetwork/basin-cli/pkg/signing"
 	"github.com/tidwall/gjson"
 
+	"github.com/machinefi/sprout/proof"
 	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/vm"
+)
+
+const (
+	defaultTextileEndpoint      = "https://basin.tableland.xyz"
+	defaultTextileTimeout       = 30 * time.Second
+	defaultTextileRetryInterval = time.Second
+	defaultTextileMaxRetryTime  = 30 * time.Second
+	maxTextileResponseSize      = 1 << 16
 )
 
 type textileDB struct {
-	endpoint  string
-	secretKey *ecdsa.PrivateKey
+	endpoint      string
+	secretKey     *ecdsa.PrivateKey
+	client        *http.Client
+	maxRetries    uint64
+	retryInterval time.Duration
+	maxRetryTime  time.Duration
+	vmType        vm.Type
 }
 
 func (t *textileDB) Output(task *types.Task, proof []byte) (string, error) {
@@ -33,40 +49,32 @@ func (t *textileDB) Output(task *types.Task, proof []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	txHash, err := t.write(encodedData)
+	cid, err := t.write(encodedData)
 	if err != nil {
 		return "", err
 	}
-	return txHash, nil
+	return cid, nil
 }
 
-func (t *textileDB) packData(proof []byte) ([]byte, error) {
-	proof, err := hex.DecodeString(string(proof))
+// packData packs the public inputs and the proof document, the risc0 journal is formatted as the
+// concatenated decimal bytes
+func (t *textileDB) packData(proofData []byte) ([]byte, error) {
+	p, err := proof.Decode(t.vmType, proofData)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode proof")
-	}
-
-	var (
-		result string
-		values []gjson.Result
-	)
-
-	if valueJournal := gjson.GetBytes(proof, "Stark.journal.bytes"); valueJournal.Exists() {
-		values = valueJournal.Array()
-	} else if valueJournal = gjson.GetBytes(proof, "Snark.journal"); valueJournal.Exists() {
-		values = valueJournal.Array()
-	} else {
-		return nil, errors.New("proof does not contain journal")
+		return nil, err
 	}
 
-	// get result from proof
-	for _, value := range values {
-		result += fmt.Sprint(value.Int())
+	result := string(p.PublicInputs)
+	if p.VMType == vm.Risc0 {
+		result = ""
+		for _, b := range p.PublicInputs {
+			result += fmt.Sprint(b)
+		}
 	}
 
 	data := map[string]string{
 		"result": result,
-		"proof":  string(proof),
+		"proof":  string(p.Raw),
 	}
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -82,53 +90,92 @@ func (t *textileDB) write(data []byte) (string, error) {
 		return "", errors.Wrap(err, "failed to sign data")
 	}
 
-	txHash := hex.EncodeToString(signatureBytes)
-
 	url := fmt.Sprintf("%s?timestamp=%s&signature=%s",
 		t.endpoint,
 		strconv.FormatInt(time.Now().Unix(), 10),
-		txHash)
-	err = writeTextileEvent(url, data)
-	if err != nil {
-		return "", err
+		hex.EncodeToString(signatureBytes))
+
+	interval := t.retryInterval
+	start := time.Now()
+	for attempt := uint64(0); ; attempt++ {
+		cid, retryable, err := writeTextileEvent(t.client, url, data)
+		if err == nil {
+			return cid, nil
+		}
+		if !retryable || attempt >= t.maxRetries || time.Since(start)+interval > t.maxRetryTime {
+			return "", errors.Wrapf(err, "failed to write textile event after %v attempts", attempt+1)
+		}
+		slog.Warn("retry writing textile event", "endpoint", t.endpoint, "attempt", attempt+1, "error", err)
+		time.Sleep(interval)
+		interval *= 2
 	}
-	return txHash, err
 }
 
-// writeTextileEvent writes a file to a vault via the Basin API.
-func writeTextileEvent(url string, fileData []byte) error {
-	req, err := http.NewRequest("POST", url, bytes.NewReader(fileData))
+// writeTextileEvent writes a file to a vault via the Basin API and returns the event cid,
+// the error is retryable if it's a network error or the server is unavailable
+func writeTextileEvent(client *http.Client, url string, fileData []byte) (string, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(fileData))
 	if err != nil {
-		return errors.Wrap(err, "failed to create request")
+		return "", false, errors.Wrap(err, "failed to create request")
 	}
 
-	hn := sha256.New()
-	hr := hn.Sum(fileData)
-	req.Header.Set("filename", string(hr)[0:7])
+	hash := sha256.Sum256(fileData)
+	req.Header.Set("filename", hex.EncodeToString(hash[:]))
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return errors.Wrap(err, "failed to send request")
+		return "", true, errors.Wrap(err, "failed to send request")
 	}
 	defer resp.Body.Close()
 
-	responseBody, err := io.ReadAll(resp.Body)
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, maxTextileResponseSize))
 	if err != nil {
-		return err
+		return "", true, errors.Wrap(err, "failed to read response body")
 	}
+	slog.Debug("write textile event", "status", resp.StatusCode, "response", string(responseBody))
 
-	slog.Debug("Write event", "response", string(responseBody))
-	return nil
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return "", retryable, errors.Errorf("textile response status %v, body %s", resp.StatusCode, responseBody)
+	}
+	cid := gjson.GetBytes(responseBody, "cid").String()
+	if cid == "" {
+		return "", false, errors.Errorf("missing event cid in textile response %s", responseBody)
+	}
+	return cid, false, nil
 }
 
-// TODO: refactor textile with a KV database adapter
-func newTextileDBAdapter(vaultID string, secretKey string) (Output, error) {
+// newTextileDBAdapter writes the public inputs and proof decoded by vm type to a Basin vault
+func newTextileDBAdapter(conf *TextileConfig, vmType vm.Type, secretKey string) (Output, error) {
 	if secretKey == "" {
 		return nil, errors.New("secret key is empty")
 	}
+	if conf.VaultID == "" {
+		return nil, errors.New("textile vault id is empty")
+	}
+	timeout, err := parseDuration(conf.Timeout, defaultTextileTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid textile timeout")
+	}
+	retryInterval, err := parseDuration(conf.RetryInterval, defaultTextileRetryInterval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid textile retry interval")
+	}
+	maxRetryTime, err := parseDuration(conf.MaxRetryTime, defaultTextileMaxRetryTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid textile max retry time")
+	}
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = defaultTextileEndpoint
+	}
 	return &textileDB{
-		endpoint:  fmt.Sprintf("https://basin.tableland.xyz/vaults/%s/events", vaultID),
-		secretKey: crypto.ToECDSAUnsafe(common.FromHex(secretKey)),
+		endpoint:      fmt.Sprintf("%s/vaults/%s/events", strings.TrimSuffix(endpoint, "/"), conf.VaultID),
+		secretKey:     crypto.ToECDSAUnsafe(common.FromHex(secretKey)),
+		client:        &http.Client{Timeout: timeout},
+		maxRetries:    conf.MaxRetries,
+		retryInterval: retryInterval,
+		maxRetryTime:  maxRetryTime,
+		vmType:        vmType,
 	}, nil
 }
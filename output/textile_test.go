@@ -3,9 +3,13 @@ package output
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/hex"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
 
 	. "github.com/agiledragon/gomonkey/v2"
@@ -15,6 +19,7 @@ import (
 
 	"github.com/machinefi/sprout/testutil"
 	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/vm"
 )
 
 func patchTextileDBPackData(p *Patches, data []byte, err error) *Patches {
@@ -29,12 +34,41 @@ func patchTextileDBWrite(p *Patches, data string, err error) *Patches {
 	})
 }
 
+const testTextileSecretKey = "c47bbade736b0f82788aa6eaa06140cdf41a544707edef944299642e0d708cab"
+
+func Test_newTextileDBAdapter(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("MissingVaultID", func(t *testing.T) {
+		_, err := newTextileDBAdapter(&TextileConfig{}, vm.Risc0, testTextileSecretKey)
+		r.ErrorContains(err, "vault id is empty")
+	})
+	t.Run("InvalidTimeout", func(t *testing.T) {
+		_, err := newTextileDBAdapter(&TextileConfig{VaultID: "vault", Timeout: "any"}, vm.Risc0, testTextileSecretKey)
+		r.ErrorContains(err, "invalid textile timeout")
+	})
+	t.Run("Default", func(t *testing.T) {
+		o, err := newTextileDBAdapter(&TextileConfig{VaultID: "vault"}, vm.Risc0, testTextileSecretKey)
+		r.NoError(err)
+		db := o.(*textileDB)
+		r.Equal("https://basin.tableland.xyz/vaults/vault/events", db.endpoint)
+		r.Equal(defaultTextileTimeout, db.client.Timeout)
+	})
+	t.Run("Endpoint", func(t *testing.T) {
+		o, err := newTextileDBAdapter(&TextileConfig{VaultID: "vault", Endpoint: "http://localhost/"}, vm.Risc0, testTextileSecretKey)
+		r.NoError(err)
+		r.Equal("http://localhost/vaults/vault/events", o.(*textileDB).endpoint)
+	})
+}
+
 func Test_textile_write(t *testing.T) {
 	r := require.New(t)
 
-	o := &textileDB{
-		endpoint:  "any",
-		secretKey: &ecdsa.PrivateKey{},
+	data := []byte(`{"result":"1"}`)
+	newTestTextileDB := func(endpoint string, maxRetries uint64) *textileDB {
+		o, err := newTextileDBAdapter(&TextileConfig{VaultID: "vault", Endpoint: endpoint, MaxRetries: maxRetries, RetryInterval: "1ms"}, vm.Risc0, testTextileSecretKey)
+		r.NoError(err)
+		return o.(*textileDB)
 	}
 
 	t.Run("FailedToSignData", func(t *testing.T) {
@@ -44,35 +78,109 @@ func Test_textile_write(t *testing.T) {
 		p = p.ApplyFuncReturn(signing.NewSigner, &signing.Signer{})
 		p = p.ApplyMethodReturn(&signing.Signer{}, "SignBytes", nil, errors.New(t.Name()))
 
-		txHash, err := o.write([]byte("any"))
-		r.Equal(txHash, "")
+		cid, err := newTestTextileDB("http://localhost", 0).write(data)
+		r.Equal(cid, "")
 		r.ErrorContains(err, t.Name())
 	})
 
-	t.Run("FailedToWriteTextileEvent", func(t *testing.T) {
-		p := NewPatches()
-		defer p.Reset()
-
-		p = p.ApplyFuncReturn(signing.NewSigner, &signing.Signer{})
-		p = p.ApplyMethodReturn(&signing.Signer{}, "SignBytes", []byte("any"), nil)
-		p = p.ApplyFuncReturn(writeTextileEvent, errors.New(t.Name()))
+	t.Run("Success", func(t *testing.T) {
+		type request struct {
+			method string
+			url    *url.URL
+			header http.Header
+			body   []byte
+		}
+		reqs := make(chan *request, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			reqs <- &request{method: req.Method, url: req.URL, header: req.Header, body: body}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"cid":"bafy"}`))
+		}))
+		defer srv.Close()
+
+		cid, err := newTestTextileDB(srv.URL, 0).write(data)
+		r.NoError(err)
+		r.Equal("bafy", cid)
+
+		req := <-reqs
+		r.Equal(http.MethodPost, req.method)
+		r.Equal("/vaults/vault/events", req.url.Path)
+		r.NotEmpty(req.url.Query().Get("timestamp"))
+		r.NotEmpty(req.url.Query().Get("signature"))
+		r.Equal(data, req.body)
+		hash := sha256.Sum256(data)
+		r.Equal(hex.EncodeToString(hash[:]), req.header.Get("filename"))
+	})
 
-		txHash, err := o.write([]byte("any"))
-		r.Equal(txHash, "")
-		r.ErrorContains(err, t.Name())
+	t.Run("RetryUnavailable", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"cid":"bafy"}`))
+		}))
+		defer srv.Close()
+
+		cid, err := newTestTextileDB(srv.URL, 2).write(data)
+		r.NoError(err)
+		r.Equal("bafy", cid)
+		r.Equal(int32(3), calls.Load())
 	})
 
-	t.Run("Success", func(t *testing.T) {
-		p := NewPatches()
-		defer p.Reset()
+	t.Run("RetriesExhausted", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		_, err := newTestTextileDB(srv.URL, 1).write(data)
+		r.ErrorContains(err, "after 2 attempts")
+		r.Equal(int32(2), calls.Load())
+	})
 
-		p = p.ApplyFuncReturn(signing.NewSigner, &signing.Signer{})
-		p = p.ApplyMethodReturn(&signing.Signer{}, "SignBytes", []byte("any"), nil)
-		p = p.ApplyFuncReturn(writeTextileEvent, nil)
+	t.Run("MaxRetryTime", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
 
-		txHash, err := o.write([]byte("any"))
-		r.Equal(txHash, hex.EncodeToString([]byte("any")))
+		o, err := newTextileDBAdapter(&TextileConfig{VaultID: "vault", Endpoint: srv.URL, MaxRetries: 10, RetryInterval: "20ms", MaxRetryTime: "50ms"}, vm.Risc0, testTextileSecretKey)
 		r.NoError(err)
+		_, err = o.(*textileDB).write(data)
+		r.ErrorContains(err, "after 2 attempts")
+		r.Equal(int32(2), calls.Load())
+	})
+
+	t.Run("NoRetryOnClientError", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid signature"}`))
+		}))
+		defer srv.Close()
+
+		_, err := newTestTextileDB(srv.URL, 3).write(data)
+		r.ErrorContains(err, "invalid signature")
+		r.Equal(int32(1), calls.Load())
+	})
+
+	t.Run("MissingCID", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer srv.Close()
+
+		_, err := newTestTextileDB(srv.URL, 0).write(data)
+		r.ErrorContains(err, "missing event cid")
 	})
 }
 
@@ -82,6 +190,7 @@ func Test_textile_packData(t *testing.T) {
 	o := &textileDB{
 		endpoint:  "any",
 		secretKey: &ecdsa.PrivateKey{},
+		vmType:    vm.Risc0,
 	}
 
 	t.Run("FailedToDecodeProof", func(t *testing.T) {
@@ -112,6 +221,13 @@ func Test_textile_packData(t *testing.T) {
 		r.NoError(err)
 	})
 
+	t.Run("ZKwasmInstances", func(t *testing.T) {
+		o := &textileDB{vmType: vm.ZKwasm}
+		data, err := o.packData([]byte(`{"proof":"AQI=","instances":["0x2"],"vk":"Aw=="}`))
+		r.NoError(err)
+		r.JSONEq(`{"result":"[\"0x2\"]","proof":"{\"proof\":\"AQI=\",\"instances\":[\"0x2\"],\"vk\":\"Aw==\"}"}`, string(data))
+	})
+
 	t.Run("FailedToMarshalData", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
@@ -137,6 +253,7 @@ func Test_textile_Output(t *testing.T) {
 	o := &textileDB{
 		endpoint:  "any",
 		secretKey: &ecdsa.PrivateKey{},
+		vmType:    vm.Risc0,
 	}
 
 	t.Run("FailedToPackData", func(t *testing.T) {
@@ -181,7 +298,9 @@ func Test_writeTextileEvent(t *testing.T) {
 
 		p = testutil.HttpNewRequest(p, nil, errors.New(t.Name()))
 
-		r.ErrorContains(writeTextileEvent("any", []byte("any")), t.Name())
+		_, retryable, err := writeTextileEvent(&http.Client{}, "any", []byte("any"))
+		r.False(retryable)
+		r.ErrorContains(err, t.Name())
 	})
 
 	t.Run("FailedToDoHTTPRequest", func(t *testing.T) {
@@ -191,7 +310,9 @@ func Test_writeTextileEvent(t *testing.T) {
 		p = testutil.HttpNewRequest(p, &http.Request{Header: http.Header{}}, nil)
 		p = p.ApplyMethodReturn(&http.Client{}, "Do", nil, errors.New(t.Name()))
 
-		r.ErrorContains(writeTextileEvent("any", []byte("any")), t.Name())
+		_, retryable, err := writeTextileEvent(&http.Client{}, "any", []byte("any"))
+		r.True(retryable)
+		r.ErrorContains(err, t.Name())
 	})
 
 	t.Run("FailedToReadHttpResponse", func(t *testing.T) {
@@ -205,20 +326,9 @@ func Test_writeTextileEvent(t *testing.T) {
 			Body: io.NopCloser(bytes.NewReader(nil)),
 		}, nil)
 		p = testutil.IoReadAll(p, nil, errors.New(t.Name()))
-		r.ErrorContains(writeTextileEvent("any", []byte("any")), t.Name())
-	})
-
-	t.Run("Success", func(t *testing.T) {
-		p := NewPatches()
-		defer p.Reset()
 
-		p = p.ApplyFuncReturn(http.NewRequest, &http.Request{
-			Header: http.Header{},
-		}, nil)
-		p = p.ApplyMethodReturn(&http.Client{}, "Do", &http.Response{
-			Body: io.NopCloser(bytes.NewBufferString("any")),
-		}, nil)
-		p = testutil.IoReadAll(p, []byte("any"), nil)
-		r.NoError(writeTextileEvent("any", []byte("any")))
+		_, retryable, err := writeTextileEvent(&http.Client{}, "any", []byte("any"))
+		r.True(retryable)
+		r.ErrorContains(err, t.Name())
 	})
 }
@@ -0,0 +1,100 @@
+package output
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/machinefi/sprout/types"
+)
+
+// ValueSource is where a mapped value comes from
+type ValueSource string
+
+const (
+	// ValueSourceTaskData reads the JSON of task.Data[DataIndex]
+	ValueSourceTaskData ValueSource = "taskData"
+	// ValueSourceProof reads the proof, it's decoded as JSON if possible, hex decoded first if needed
+	ValueSourceProof ValueSource = "proof"
+	// ValueSourceTask reads the task metadata {"id", "projectID", "projectVersion", "clientID"}
+	ValueSourceTask ValueSource = "task"
+	// ValueSourceConst uses the Value of the mapping
+	ValueSourceConst ValueSource = "const"
+)
+
+// ValueMapping tells which value in task or proof feeds the named field
+type ValueMapping struct {
+	Name      string      `json:"name"`
+	Source    ValueSource `json:"source"`
+	DataIndex int         `json:"dataIndex,omitempty"`
+	// Path is the gjson path in the source, the whole source is used if empty
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (m *ValueMapping) validate() error {
+	switch m.Source {
+	case ValueSourceTaskData, ValueSourceProof, ValueSourceTask:
+	case ValueSourceConst:
+		if !gjson.ValidBytes(m.Value) {
+			return errors.Errorf("invalid const value of %s", m.Name)
+		}
+	default:
+		return errors.Errorf("unsupported source %s of %s", m.Source, m.Name)
+	}
+	if m.DataIndex < 0 {
+		return errors.Errorf("invalid data index of %s", m.Name)
+	}
+	return nil
+}
+
+// resolve returns the JSON value the field is mapped to
+func (m *ValueMapping) resolve(task *types.Task, proof []byte) (gjson.Result, error) {
+	var src []byte
+	switch m.Source {
+	case ValueSourceTaskData:
+		if m.DataIndex >= len(task.Data) {
+			return gjson.Result{}, errors.Errorf("task data index %v out of range", m.DataIndex)
+		}
+		src = task.Data[m.DataIndex]
+	case ValueSourceProof:
+		src = proof
+		if !gjson.ValidBytes(src) {
+			if decoded, err := hex.DecodeString(strings.TrimPrefix(string(proof), "0x")); err == nil && gjson.ValidBytes(decoded) {
+				src = decoded
+			}
+		}
+	case ValueSourceTask:
+		meta, err := json.Marshal(map[string]any{
+			"id":             task.ID,
+			"projectID":      task.ProjectID,
+			"projectVersion": task.ProjectVersion,
+			"clientID":       task.ClientID,
+		})
+		if err != nil {
+			return gjson.Result{}, errors.Wrap(err, "failed to marshal task metadata")
+		}
+		src = meta
+	case ValueSourceConst:
+		src = m.Value
+	}
+
+	if m.Path == "" {
+		if gjson.ValidBytes(src) {
+			return gjson.ParseBytes(src), nil
+		}
+		raw, err := json.Marshal(string(src))
+		if err != nil {
+			return gjson.Result{}, errors.Wrap(err, "failed to marshal raw string")
+		}
+		return gjson.Result{Type: gjson.String, Str: string(src), Raw: string(raw)}, nil
+	}
+	v := gjson.GetBytes(src, m.Path)
+	if !v.Exists() {
+		return gjson.Result{}, errors.Errorf("path %s not exist in %s", m.Path, m.Source)
+	}
+	return v, nil
+}
@@ -0,0 +1,169 @@
+package output
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/types"
+)
+
+const (
+	webhookTimestampHeader = "X-Sprout-Timestamp"
+	webhookSignatureHeader = "X-Sprout-Signature"
+
+	defaultWebhookTimeout       = 10 * time.Second
+	defaultWebhookRetryInterval = time.Second
+	defaultWebhookMaxRetryTime  = 30 * time.Second
+	maxWebhookResponseSize      = 1 << 16
+)
+
+type webhookPayload struct {
+	ProjectID       uint64   `json:"projectID"`
+	ProjectVersion  string   `json:"projectVersion"`
+	TaskID          uint64   `json:"taskID"`
+	ClientID        string   `json:"clientID"`
+	Data            [][]byte `json:"data"`
+	Proof           []byte   `json:"proof"`
+	ProverID        string   `json:"proverID,omitempty"`
+	ProverSignature string   `json:"proverSignature,omitempty"`
+}
+
+type webhook struct {
+	url           string
+	secret        []byte
+	headers       map[string]string
+	client        *http.Client
+	maxRetries    uint64
+	retryInterval time.Duration
+	maxRetryTime  time.Duration
+}
+
+func (w *webhook) Output(task *types.Task, proof []byte) (string, error) {
+	return w.OutputSigned(task, proof, "", "")
+}
+
+func (w *webhook) OutputSigned(task *types.Task, proof []byte, proverID, signature string) (string, error) {
+	slog.Debug("outputing to webhook", "url", w.url)
+	body, err := json.Marshal(&webhookPayload{
+		ProjectID:       task.ProjectID,
+		ProjectVersion:  task.ProjectVersion,
+		TaskID:          task.ID,
+		ClientID:        task.ClientID,
+		Data:            task.Data,
+		Proof:           proof,
+		ProverID:        proverID,
+		ProverSignature: signature,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal webhook payload")
+	}
+
+	interval := w.retryInterval
+	start := time.Now()
+	for attempt := uint64(0); ; attempt++ {
+		res, retryable, err := w.post(body)
+		if err == nil {
+			return res, nil
+		}
+		if !retryable || attempt >= w.maxRetries || time.Since(start)+interval > w.maxRetryTime {
+			return "", errors.Wrapf(err, "failed to post webhook after %v attempts", attempt+1)
+		}
+		slog.Warn("retry webhook", "url", w.url, "attempt", attempt+1, "error", err)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// post sends the body once, the error is retryable if it's a network error or the server is unavailable
+func (w *webhook) post(body []byte) (string, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if len(w.secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, ts)
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(w.secret, ts, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", true, errors.Wrap(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseSize))
+	if err != nil {
+		return "", true, errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return "", retryable, errors.Errorf("webhook response status %v, body %s", resp.StatusCode, respBody)
+	}
+	return string(respBody), false, nil
+}
+
+// signWebhook returns the hex encoded HMAC-SHA256 of `timestamp.body`
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhook(conf *WebhookConfig) (Output, error) {
+	if conf.URL == "" {
+		return nil, errors.New("webhook url is empty")
+	}
+	timeout, err := parseDuration(conf.Timeout, defaultWebhookTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook timeout")
+	}
+	retryInterval, err := parseDuration(conf.RetryInterval, defaultWebhookRetryInterval)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook retry interval")
+	}
+	maxRetryTime, err := parseDuration(conf.MaxRetryTime, defaultWebhookMaxRetryTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid webhook max retry time")
+	}
+	return &webhook{
+		url:           conf.URL,
+		secret:        []byte(conf.Secret),
+		headers:       conf.Headers,
+		client:        &http.Client{Timeout: timeout},
+		maxRetries:    conf.MaxRetries,
+		retryInterval: retryInterval,
+		maxRetryTime:  maxRetryTime,
+	}, nil
+}
+
+// parseDuration parses the positive go duration, def if empty
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("non-positive duration %s", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/types"
+)
+
+func TestNewWebhook(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("MissingURL", func(t *testing.T) {
+		_, err := newWebhook(&WebhookConfig{})
+		r.Error(err)
+	})
+	t.Run("InvalidTimeout", func(t *testing.T) {
+		_, err := newWebhook(&WebhookConfig{URL: "http://localhost", Timeout: "any"})
+		r.Error(err)
+	})
+	t.Run("InvalidRetryInterval", func(t *testing.T) {
+		_, err := newWebhook(&WebhookConfig{URL: "http://localhost", RetryInterval: "-1s"})
+		r.Error(err)
+	})
+	t.Run("Default", func(t *testing.T) {
+		o, err := newWebhook(&WebhookConfig{URL: "http://localhost"})
+		r.NoError(err)
+		w := o.(*webhook)
+		r.Equal(defaultWebhookTimeout, w.client.Timeout)
+		r.Equal(defaultWebhookRetryInterval, w.retryInterval)
+		r.Equal(defaultWebhookMaxRetryTime, w.maxRetryTime)
+	})
+}
+
+func TestWebhook_OutputSigned(t *testing.T) {
+	r := require.New(t)
+
+	task := &types.Task{ID: 1, ProjectID: 2, ProjectVersion: "0.1", ClientID: "client", Data: [][]byte{[]byte("data")}}
+
+	t.Run("Success", func(t *testing.T) {
+		type request struct {
+			header http.Header
+			body   []byte
+		}
+		reqs := make(chan *request, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			reqs <- &request{header: req.Header, body: body}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer srv.Close()
+
+		o, err := newWebhook(&WebhookConfig{URL: srv.URL, Secret: "secret", Headers: map[string]string{"X-Custom": "value"}})
+		r.NoError(err)
+		res, err := o.(SignedOutput).OutputSigned(task, []byte("proof"), "prover", "signature")
+		r.NoError(err)
+		r.Equal("ok", res)
+
+		req := <-reqs
+		r.Equal("value", req.header.Get("X-Custom"))
+		ts := req.header.Get(webhookTimestampHeader)
+		r.Equal("sha256="+signWebhook([]byte("secret"), ts, req.body), req.header.Get(webhookSignatureHeader))
+		var received webhookPayload
+		r.NoError(json.Unmarshal(req.body, &received))
+		r.Equal(webhookPayload{
+			ProjectID:       2,
+			ProjectVersion:  "0.1",
+			TaskID:          1,
+			ClientID:        "client",
+			Data:            [][]byte{[]byte("data")},
+			Proof:           []byte("proof"),
+			ProverID:        "prover",
+			ProverSignature: "signature",
+		}, received)
+	})
+
+	t.Run("RetryOnServerError", func(t *testing.T) {
+		var count atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if count.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer srv.Close()
+
+		o, err := newWebhook(&WebhookConfig{URL: srv.URL, MaxRetries: 2, RetryInterval: "1ms"})
+		r.NoError(err)
+		res, err := o.Output(task, []byte("proof"))
+		r.NoError(err)
+		r.Equal("ok", res)
+		r.Equal(int32(3), count.Load())
+	})
+
+	t.Run("RetryExhausted", func(t *testing.T) {
+		var count atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			count.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		o, err := newWebhook(&WebhookConfig{URL: srv.URL, MaxRetries: 1, RetryInterval: "1ms"})
+		r.NoError(err)
+		_, err = o.Output(task, []byte("proof"))
+		r.ErrorContains(err, "status 500")
+		r.Equal(int32(2), count.Load())
+	})
+
+	t.Run("MaxRetryTime", func(t *testing.T) {
+		var count atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			count.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		o, err := newWebhook(&WebhookConfig{URL: srv.URL, MaxRetries: 10, RetryInterval: "20ms", MaxRetryTime: "50ms"})
+		r.NoError(err)
+		_, err = o.Output(task, []byte("proof"))
+		r.ErrorContains(err, "status 500")
+		r.Equal(int32(2), count.Load())
+	})
+
+	t.Run("NoRetryOnClientError", func(t *testing.T) {
+		var count atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			count.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		o, err := newWebhook(&WebhookConfig{URL: srv.URL, MaxRetries: 3, RetryInterval: "1ms"})
+		r.NoError(err)
+		_, err = o.Output(task, []byte("proof"))
+		r.ErrorContains(err, "status 400")
+		r.Equal(int32(1), count.Load())
+	})
+}
@@ -1,55 +1,227 @@
 package project
 
 import (
-	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"log/slog"
 	"os"
-	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-type cache struct {
-	dir string
+// DefaultCacheMaxSize bounds the project cache if no size limit is given
+const DefaultCacheMaxSize = 256 << 20
+
+// Cache keeps the project files by content hash in ${dir}/${project id}/${hex sha256}, so the versions of
+// a project are cached side by side; the least recently used files are evicted once the size limit exceeded
+type Cache struct {
+	dir     string
+	maxSize int64
+	mux     sync.Mutex
+}
+
+// CacheEntry is a cached project file
+type CacheEntry struct {
+	ProjectID uint64
+	Hash      [32]byte
+	Size      int64
+	UsedAt    time.Time
+	Path      string
 }
 
-func (c *cache) getPath(projectID uint64) string {
-	return path.Join(c.dir, strconv.FormatUint(projectID, 10))
+func (c *Cache) getPath(projectID uint64, hash [32]byte) string {
+	return filepath.Join(c.dir, strconv.FormatUint(projectID, 10), hex.EncodeToString(hash[:]))
 }
 
-func (c *cache) get(projectID uint64, hash []byte) []byte {
-	data, err := os.ReadFile(c.getPath(projectID))
+// Get returns the cached project file of the hash, nil if it's not cached
+func (c *Cache) Get(projectID uint64, hash [32]byte) []byte {
+	p := c.getPath(projectID, hash)
+	data, err := os.ReadFile(p)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			slog.Error("failed to read project cache file", "error", err, "project_id", projectID)
 		}
 		return nil
 	}
-	h := sha256.New()
-	if _, err := h.Write(data); err != nil {
-		slog.Error("failed to generate cache project file hash", "error", err)
+	if sha256.Sum256(data) != hash {
+		slog.Error("failed to validate cache project file hash", "project_id", projectID)
+		_ = os.Remove(p)
 		return nil
 	}
-	if !bytes.Equal(h.Sum(nil), hash) {
-		slog.Error("failed to validate cache project file hash")
-		return nil
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		slog.Error("failed to touch project cache file", "error", err, "project_id", projectID)
 	}
 	return data
 }
 
-func (c *cache) set(projectID uint64, data []byte) {
-	if err := os.WriteFile(c.getPath(projectID), data, 0666); err != nil {
-		slog.Error("failed to write cache project file", "error", err)
+// Set caches the project file, the file is written to a temp file and renamed so readers never see a
+// partial one; the least recently used files are evicted if the size limit exceeded
+func (c *Cache) Set(projectID uint64, data []byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	p := c.getPath(projectID, sha256.Sum256(data))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors.Wrap(err, "failed to create project cache directory")
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create project cache temp file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write project cache temp file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close project cache temp file")
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return errors.Wrap(err, "failed to chmod project cache temp file")
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return errors.Wrap(err, "failed to rename project cache file")
+	}
+
+	if c.maxSize > 0 {
+		if _, err := c.prune(c.maxSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the cached project files, the most recently used first
+func (c *Cache) List() ([]*CacheEntry, error) {
+	projects, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read project cache directory %s", c.dir)
+	}
+	es := []*CacheEntry{}
+	for _, pd := range projects {
+		projectID, err := strconv.ParseUint(pd.Name(), 10, 64)
+		if err != nil || !pd.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(c.dir, pd.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read project cache directory, project_id %v", projectID)
+		}
+		for _, f := range files {
+			e, ok := c.entry(projectID, f)
+			if ok {
+				es = append(es, e)
+			}
+		}
+	}
+	slices.SortFunc(es, func(a, b *CacheEntry) int { return b.UsedAt.Compare(a.UsedAt) })
+	return es, nil
+}
+
+func (c *Cache) entry(projectID uint64, f os.DirEntry) (*CacheEntry, bool) {
+	if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+		return nil, false
+	}
+	h, err := hex.DecodeString(f.Name())
+	if err != nil || len(h) != sha256.Size {
+		return nil, false
+	}
+	info, err := f.Info()
+	if err != nil {
+		return nil, false
+	}
+	return &CacheEntry{
+		ProjectID: projectID,
+		Hash:      [32]byte(h),
+		Size:      info.Size(),
+		UsedAt:    info.ModTime(),
+		Path:      filepath.Join(c.dir, strconv.FormatUint(projectID, 10), f.Name()),
+	}, true
+}
+
+// Prune evicts the least recently used files until the cache is not larger than maxSize, and returns them
+func (c *Cache) Prune(maxSize int64) ([]*CacheEntry, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.prune(maxSize)
+}
+
+func (c *Cache) prune(maxSize int64) ([]*CacheEntry, error) {
+	es, err := c.List()
+	if err != nil {
+		return nil, err
 	}
+	var size int64
+	for _, e := range es {
+		size += e.Size
+	}
+	evicted := []*CacheEntry{}
+	for i := len(es) - 1; i >= 0 && size > maxSize; i-- {
+		if err := os.Remove(es[i].Path); err != nil {
+			return evicted, errors.Wrapf(err, "failed to remove project cache file, project_id %v", es[i].ProjectID)
+		}
+		size -= es[i].Size
+		evicted = append(evicted, es[i])
+	}
+	return evicted, nil
 }
 
-func newCache(projectCacheDir string) (*cache, error) {
-	if err := os.MkdirAll(projectCacheDir, 0777); err != nil {
+// Remove evicts all cached files of the project, and returns them
+func (c *Cache) Remove(projectID uint64) ([]*CacheEntry, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	es, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	es = slices.DeleteFunc(es, func(e *CacheEntry) bool { return e.ProjectID != projectID })
+	if err := os.RemoveAll(filepath.Join(c.dir, strconv.FormatUint(projectID, 10))); err != nil {
+		return nil, errors.Wrapf(err, "failed to remove project cache directory, project_id %v", projectID)
+	}
+	return es, nil
+}
+
+// OpenCache returns the cache in the existing directory as it is, the former layout isn't migrated, e.g. for
+// inspecting the cache of a running node; maxSize is the same as NewCache
+func OpenCache(dir string, maxSize int64) (*Cache, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, errors.Wrapf(err, "failed to open project cache directory %s", dir)
+	}
+	if maxSize == 0 {
+		maxSize = DefaultCacheMaxSize
+	}
+	return &Cache{dir: dir, maxSize: maxSize}, nil
+}
+
+// NewCache returns the cache in the directory, maxSize 0 means DefaultCacheMaxSize and negative means no size
+// limit; the project files cached by project id of the former layout are removed
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, errors.Wrap(err, "failed to create project cache directory")
 	}
-	return &cache{
-		dir: projectCacheDir,
-	}, nil
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read project cache directory %s", dir)
+	}
+	for _, e := range entries {
+		if _, err := strconv.ParseUint(e.Name(), 10, 64); err == nil && !e.IsDir() {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return nil, errors.Wrap(err, "failed to remove legacy project cache file")
+			}
+		}
+	}
+	if maxSize == 0 {
+		maxSize = DefaultCacheMaxSize
+	}
+	return &Cache{dir: dir, maxSize: maxSize}, nil
 }
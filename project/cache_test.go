@@ -0,0 +1,76 @@
+package project
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(dir, "1"), []byte("legacy"), 0666))
+
+	c, err := NewCache(dir, 10)
+	r.NoError(err)
+	r.NoFileExists(filepath.Join(dir, "1"))
+
+	v1, v2, v3 := []byte("v1"), []byte("v2"), []byte("version3")
+
+	t.Run("MultiVersion", func(t *testing.T) {
+		r.Nil(c.Get(1, sha256.Sum256(v1)))
+		r.NoError(c.Set(1, v1))
+		r.NoError(c.Set(1, v2))
+		r.Equal(v1, c.Get(1, sha256.Sum256(v1)))
+		r.Equal(v2, c.Get(1, sha256.Sum256(v2)))
+
+		fi, err := os.Stat(c.getPath(1, sha256.Sum256(v1)))
+		r.NoError(err)
+		r.Equal(os.FileMode(0644), fi.Mode().Perm())
+	})
+	t.Run("HashMismatch", func(t *testing.T) {
+		p := c.getPath(1, sha256.Sum256(v2))
+		r.NoError(os.WriteFile(p, []byte("broken"), 0644))
+		r.Nil(c.Get(1, sha256.Sum256(v2)))
+		r.NoFileExists(p)
+		r.NoError(c.Set(1, v2))
+	})
+	t.Run("EvictLeastRecentlyUsed", func(t *testing.T) {
+		old := time.Now().Add(-time.Hour)
+		r.NoError(os.Chtimes(c.getPath(1, sha256.Sum256(v1)), old, old))
+
+		r.NoError(c.Set(2, v3))
+		r.Nil(c.Get(1, sha256.Sum256(v1)))
+		r.Equal(v2, c.Get(1, sha256.Sum256(v2)))
+		r.Equal(v3, c.Get(2, sha256.Sum256(v3)))
+	})
+	t.Run("List", func(t *testing.T) {
+		old := time.Now().Add(-time.Hour)
+		r.NoError(os.Chtimes(c.getPath(2, sha256.Sum256(v3)), old, old))
+
+		es, err := c.List()
+		r.NoError(err)
+		r.Len(es, 2)
+		r.Equal(uint64(1), es[0].ProjectID)
+		r.Equal(sha256.Sum256(v2), es[0].Hash)
+		r.Equal(int64(len(v2)), es[0].Size)
+		r.Equal(uint64(2), es[1].ProjectID)
+	})
+	t.Run("Prune", func(t *testing.T) {
+		es, err := c.Prune(2)
+		r.NoError(err)
+		r.Len(es, 1)
+		r.Equal(uint64(2), es[0].ProjectID)
+	})
+	t.Run("Remove", func(t *testing.T) {
+		es, err := c.Remove(1)
+		r.NoError(err)
+		r.Len(es, 1)
+		r.NoDirExists(filepath.Join(dir, "1"))
+	})
+}
@@ -0,0 +1,244 @@
+package project
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/utils/ipfs"
+)
+
+var (
+	errProjectTooLarge     = errors.New("project file is too large")
+	errProjectHashMismatch = errors.New("failed to validate project hash")
+)
+
+const (
+	defaultFetchTimeout  = 30 * time.Second
+	defaultFetchAttempts = 3
+	defaultFetchBackoff  = time.Second
+	defaultFetchMaxSize  = 16 << 20
+
+	defaultArweaveGateway = "https://arweave.net"
+)
+
+// Fetcher fetches the project file described by the meta, the sources of the uri are tried in order and
+// all of them are retried with backoff until the file matching the meta hash is fetched
+type Fetcher struct {
+	// IPFSGateways are tried in order for the ipfs cid, a gateway with http or https scheme is an http gateway
+	// serving ${gateway}/ipfs/${cid}, otherwise it's an ipfs api endpoint, e.g. ipfs.mainnet.iotex.io
+	IPFSGateways []string
+	// ArweaveGateways serve ${gateway}/${txid} for ar://${txid}
+	ArweaveGateways []string
+	// ContentGateways serve ${gateway}/${hex sha256} for sha256://${hex sha256}
+	ContentGateways []string
+	// Timeout limits each fetch from a source
+	Timeout time.Duration
+	// Attempts is how many times all the sources are tried
+	Attempts int
+	// Backoff is the wait before the second attempt, it's doubled after each attempt
+	Backoff time.Duration
+	// MaxSize limits the size of the project file
+	MaxSize int64
+	Client  *http.Client
+}
+
+// source fetches the project file from one place
+type source struct {
+	name  string
+	fetch func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Fetch returns the project file once it's fetched from any source of the uri and its hash verified
+func (f *Fetcher) Fetch(ctx context.Context, pm *Meta) ([]byte, error) {
+	sources, err := f.sources(pm)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, errors.Errorf("no source to fetch project, uri %s", pm.Uri)
+	}
+
+	var lastErr error
+	backoff := f.Backoff
+	for attempt := 1; ; attempt++ {
+		for _, s := range sources {
+			data, err := f.fetchFrom(ctx, s, pm.Hash)
+			if err == nil {
+				return data, nil
+			}
+			slog.Warn("failed to fetch project", "error", err, "project_id", pm.ProjectID, "source", s.name, "attempt", attempt)
+			lastErr = err
+		}
+		if attempt >= f.Attempts {
+			return nil, errors.Wrapf(lastErr, "failed to fetch project after %d attempts, uri %s", attempt, pm.Uri)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "failed to fetch project, uri %s", pm.Uri)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (f *Fetcher) fetchFrom(ctx context.Context, s *source, hash [32]byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	rc, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, f.MaxSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read project from %s", s.name)
+	}
+	if int64(len(data)) > f.MaxSize {
+		return nil, errors.Wrapf(errProjectTooLarge, "limit %d bytes", f.MaxSize)
+	}
+	if sha256.Sum256(data) != hash {
+		return nil, errProjectHashMismatch
+	}
+	return data, nil
+}
+
+// sources returns the sources of the uri in the order they are tried
+func (f *Fetcher) sources(pm *Meta) ([]*source, error) {
+	u, err := url.Parse(pm.Uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse project uri %s", pm.Uri)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return []*source{f.httpSource(pm.Uri)}, nil
+
+	case "file":
+		// local project file url: file://${absolute path}
+		return []*source{{
+			name:  pm.Uri,
+			fetch: func(context.Context) (io.ReadCloser, error) { return os.Open(u.Path) },
+		}}, nil
+
+	case "ipfs":
+		// ipfs url: ipfs://${endpoint}/${cid} or ipfs://${cid}
+		cid := firstPathSegment(u.Path)
+		if cid == "" {
+			return f.ipfsSources(u.Host), nil
+		}
+		return append([]*source{ipfsAPISource(u.Host, cid)}, f.ipfsSources(cid)...), nil
+
+	case "ar":
+		// arweave url: ar://${txid}
+		txid := u.Host + strings.TrimSuffix(u.Path, "/")
+		return f.gatewaySources(f.ArweaveGateways, txid), nil
+
+	case "sha256":
+		// content addressed url: sha256://${hex sha256}, the content is identified by the hash itself
+		digest := strings.ToLower(u.Host)
+		if digest != hex.EncodeToString(pm.Hash[:]) {
+			return nil, errors.Errorf("project uri hash mismatch the project hash, uri %s", pm.Uri)
+		}
+		return f.gatewaySources(f.ContentGateways, digest), nil
+
+	default:
+		// fetch content by ipfs cid with the ipfs gateways
+		return f.ipfsSources(firstPathSegment(u.Path)), nil
+	}
+}
+
+func (f *Fetcher) ipfsSources(cid string) []*source {
+	ss := make([]*source, 0, len(f.IPFSGateways))
+	for _, g := range f.IPFSGateways {
+		if strings.HasPrefix(g, "http://") || strings.HasPrefix(g, "https://") {
+			ss = append(ss, f.httpSource(strings.TrimSuffix(g, "/")+"/ipfs/"+cid))
+			continue
+		}
+		ss = append(ss, ipfsAPISource(g, cid))
+	}
+	return ss
+}
+
+func (f *Fetcher) gatewaySources(gateways []string, path string) []*source {
+	ss := make([]*source, 0, len(gateways))
+	for _, g := range gateways {
+		ss = append(ss, f.httpSource(strings.TrimSuffix(g, "/")+"/"+path))
+	}
+	return ss
+}
+
+func (f *Fetcher) httpSource(uri string) *source {
+	return &source{
+		name: uri,
+		fetch: func(ctx context.Context) (io.ReadCloser, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to new request, uri %s", uri)
+			}
+			resp, err := f.Client.Do(req)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to fetch project, uri %s", uri)
+			}
+			if resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+				return nil, errors.Errorf("failed to fetch project, uri %s, status %s", uri, resp.Status)
+			}
+			return resp.Body, nil
+		},
+	}
+}
+
+func ipfsAPISource(endpoint, cid string) *source {
+	return &source{
+		name: "ipfs://" + endpoint + "/" + cid,
+		fetch: func(ctx context.Context) (io.ReadCloser, error) {
+			return ipfs.NewIPFS(endpoint).CatReader(ctx, cid)
+		},
+	}
+}
+
+func firstPathSegment(p string) string {
+	return strings.Split(strings.Trim(p, "/"), "/")[0]
+}
+
+// ParseGateways splits the comma separated gateways
+func ParseGateways(s string) []string {
+	gs := []string{}
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
+// NewFetcher returns the fetcher trying the ipfs gateways in order, the other fields are set to the defaults
+func NewFetcher(ipfsGateways ...string) *Fetcher {
+	gs := []string{}
+	for _, g := range ipfsGateways {
+		if g != "" {
+			gs = append(gs, g)
+		}
+	}
+	return &Fetcher{
+		IPFSGateways:    gs,
+		ArweaveGateways: []string{defaultArweaveGateway},
+		Timeout:         defaultFetchTimeout,
+		Attempts:        defaultFetchAttempts,
+		Backoff:         defaultFetchBackoff,
+		MaxSize:         defaultFetchMaxSize,
+		Client:          &http.Client{},
+	}
+}
@@ -0,0 +1,163 @@
+package project
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testFetcher(ipfsGateways ...string) *Fetcher {
+	f := NewFetcher(ipfsGateways...)
+	f.Timeout = time.Second
+	f.Backoff = time.Millisecond
+	return f
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	r := require.New(t)
+
+	data := []byte(testLocalProject)
+	hash := sha256.Sum256(data)
+
+	var failures atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/project", "/ipfs/cid", "/txid", "/" + hex.EncodeToString(hash[:]):
+			_, _ = w.Write(data)
+		case "/api/v0/cat":
+			if req.URL.Query().Get("arg") != "cid" {
+				http.Error(w, `{"Message":"not found","Code":0}`, http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write(data)
+		case "/flaky":
+			if failures.Add(-1) >= 0 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write(data)
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat(" ", 100)))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write(data)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+	apiEndpoint := strings.TrimPrefix(srv.URL, "http://")
+
+	t.Run("InvalidUri", func(t *testing.T) {
+		_, err := testFetcher().Fetch(context.Background(), &Meta{Uri: "://"})
+		r.ErrorContains(err, "failed to parse project uri")
+	})
+	t.Run("HTTP", func(t *testing.T) {
+		got, err := testFetcher().Fetch(context.Background(), &Meta{Uri: srv.URL + "/project", Hash: hash})
+		r.NoError(err)
+		r.Equal(data, got)
+	})
+	t.Run("HashMismatch", func(t *testing.T) {
+		_, err := testFetcher().Fetch(context.Background(), &Meta{Uri: srv.URL + "/project"})
+		r.ErrorIs(err, errProjectHashMismatch)
+	})
+	t.Run("RetryWithBackoff", func(t *testing.T) {
+		failures.Store(2)
+		got, err := testFetcher().Fetch(context.Background(), &Meta{Uri: srv.URL + "/flaky", Hash: hash})
+		r.NoError(err)
+		r.Equal(data, got)
+
+		failures.Store(3)
+		_, err = testFetcher().Fetch(context.Background(), &Meta{Uri: srv.URL + "/flaky", Hash: hash})
+		r.ErrorContains(err, "after 3 attempts")
+		r.ErrorContains(err, "503")
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		f := testFetcher()
+		f.Timeout = 10 * time.Millisecond
+		f.Attempts = 1
+		_, err := f.Fetch(context.Background(), &Meta{Uri: srv.URL + "/slow", Hash: hash})
+		r.ErrorIs(err, context.DeadlineExceeded)
+	})
+	t.Run("ContextCanceled", func(t *testing.T) {
+		f := testFetcher()
+		f.Backoff = time.Hour
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := f.Fetch(ctx, &Meta{Uri: srv.URL + "/notfound", Hash: hash})
+		r.ErrorIs(err, context.DeadlineExceeded)
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		f := testFetcher()
+		f.MaxSize = 10
+		_, err := f.Fetch(context.Background(), &Meta{Uri: srv.URL + "/large", Hash: hash})
+		r.ErrorIs(err, errProjectTooLarge)
+	})
+	t.Run("File", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "1")
+		r.NoError(os.WriteFile(p, data, 0666))
+		got, err := testFetcher().Fetch(context.Background(), &Meta{Uri: "file://" + filepath.ToSlash(p), Hash: hash})
+		r.NoError(err)
+		r.Equal(data, got)
+	})
+	t.Run("IPFS", func(t *testing.T) {
+		t.Run("FallbackGateway", func(t *testing.T) {
+			f := testFetcher(srv.URL+"/notfound", srv.URL)
+			got, err := f.Fetch(context.Background(), &Meta{Uri: "ipfs://cid", Hash: hash})
+			r.NoError(err)
+			r.Equal(data, got)
+		})
+		t.Run("API", func(t *testing.T) {
+			got, err := testFetcher().Fetch(context.Background(), &Meta{Uri: "ipfs://" + apiEndpoint + "/cid", Hash: hash})
+			r.NoError(err)
+			r.Equal(data, got)
+		})
+		t.Run("DefaultGateways", func(t *testing.T) {
+			f := testFetcher(apiEndpoint)
+			got, err := f.Fetch(context.Background(), &Meta{Uri: "cid", Hash: hash})
+			r.NoError(err)
+			r.Equal(data, got)
+
+			_, err = f.Fetch(context.Background(), &Meta{Uri: "any", Hash: hash})
+			r.ErrorContains(err, "failed to read content from ipfs")
+		})
+		t.Run("NoGateway", func(t *testing.T) {
+			_, err := testFetcher().Fetch(context.Background(), &Meta{Uri: "ipfs://cid", Hash: hash})
+			r.ErrorContains(err, "no source")
+		})
+	})
+	t.Run("Arweave", func(t *testing.T) {
+		f := testFetcher()
+		f.ArweaveGateways = []string{srv.URL + "/"}
+		got, err := f.Fetch(context.Background(), &Meta{Uri: "ar://txid", Hash: hash})
+		r.NoError(err)
+		r.Equal(data, got)
+	})
+	t.Run("ContentAddressed", func(t *testing.T) {
+		f := testFetcher()
+		f.ContentGateways = []string{srv.URL + "/notfound", srv.URL}
+		got, err := f.Fetch(context.Background(), &Meta{Uri: "sha256://" + hex.EncodeToString(hash[:]), Hash: hash})
+		r.NoError(err)
+		r.Equal(data, got)
+
+		_, err = f.Fetch(context.Background(), &Meta{Uri: "sha256://" + hex.EncodeToString(hash[:])})
+		r.ErrorContains(err, "uri hash mismatch")
+	})
+}
+
+func TestParseGateways(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal([]string{}, ParseGateways(""))
+	r.Equal([]string{"a", "https://b"}, ParseGateways(" a,, https://b "))
+}
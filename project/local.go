@@ -0,0 +1,149 @@
+package project
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/utils/contract"
+)
+
+// localProjectPollInterval is how often the project file directory is scanned for changes
+var localProjectPollInterval = 2 * time.Second
+
+// localProjectMeta reads the meta of the project file, the file is named by the project id
+func localProjectMeta(dir string, projectID uint64) (*Meta, error) {
+	p, err := filepath.Abs(filepath.Join(dir, strconv.FormatUint(projectID, 10)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get project file path, project_id %v", projectID)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read project file, project_id %v", projectID)
+	}
+	return &Meta{
+		ProjectID: projectID,
+		Uri:       "file://" + filepath.ToSlash(p),
+		Hash:      sha256.Sum256(data),
+	}, nil
+}
+
+// listLocalProject returns the metas of the project files in the directory, the files not named by a
+// project id are ignored
+func listLocalProject(dir string) (map[uint64]*Meta, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read project file directory %s", dir)
+	}
+	ms := map[uint64]*Meta{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		projectID, err := strconv.ParseUint(e.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		m, err := localProjectMeta(dir, projectID)
+		if err != nil {
+			return nil, err
+		}
+		ms[projectID] = m
+	}
+	return ms, nil
+}
+
+// ListAndWatchLocalProject sends the projects in the project file directory like the project registrar
+// contract does, a project is sent again once its file changed, and sent as paused once its file removed
+func ListAndWatchLocalProject(dir string) (<-chan *contract.Project, error) {
+	current, err := listLocalProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *contract.Project, len(current)+10)
+	for _, m := range current {
+		ch <- localProject(m, false)
+	}
+
+	go func() {
+		ticker := time.NewTicker(localProjectPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			latest, err := listLocalProject(dir)
+			if err != nil {
+				slog.Error("failed to list local projects", "error", err, "dir", dir)
+				continue
+			}
+			for id, m := range latest {
+				if c, ok := current[id]; !ok || c.Hash != m.Hash {
+					slog.Info("local project changed", "project_id", id)
+					ch <- localProject(m, false)
+				}
+			}
+			for id, m := range current {
+				if _, ok := latest[id]; !ok {
+					slog.Info("local project removed", "project_id", id)
+					ch <- localProject(m, true)
+				}
+			}
+			current = latest
+		}
+	}()
+	return ch, nil
+}
+
+func localProject(m *Meta, paused bool) *contract.Project {
+	return &contract.Project{
+		ID:     m.ProjectID,
+		Uri:    m.Uri,
+		Hash:   m.Hash,
+		Paused: paused,
+	}
+}
+
+// LocalRegistry reads the projects from the project file directory, the file is named by the project id
+type LocalRegistry struct {
+	dir string
+	hub projectHub
+}
+
+var _ Registry = (*LocalRegistry)(nil)
+
+func (r *LocalRegistry) List() ([]*contract.Project, error) {
+	ms, err := listLocalProject(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	ps := make([]*contract.Project, 0, len(ms))
+	for _, m := range ms {
+		ps = append(ps, localProject(m, false))
+	}
+	slices.SortFunc(ps, func(a, b *contract.Project) int { return cmp.Compare(a.ID, b.ID) })
+	return ps, nil
+}
+
+func (r *LocalRegistry) Meta(projectID uint64) (*Meta, error) {
+	return localProjectMeta(r.dir, projectID)
+}
+
+func (r *LocalRegistry) Watch() <-chan *contract.Project {
+	return r.hub.watch()
+}
+
+func NewLocalRegistry(projectFileDir string) (*LocalRegistry, error) {
+	projectCh, err := ListAndWatchLocalProject(projectFileDir)
+	if err != nil {
+		return nil, err
+	}
+	r := &LocalRegistry{dir: projectFileDir}
+	go r.hub.run(projectCh)
+	return r, nil
+}
@@ -0,0 +1,93 @@
+package project
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/utils/contract"
+)
+
+const testLocalProject = `{"defaultVersion":"0.1","versions":[{"version":"0.1","vmType":"risc0","code":"code"}]}`
+
+func TestListAndWatchLocalProject(t *testing.T) {
+	r := require.New(t)
+
+	interval := localProjectPollInterval
+	localProjectPollInterval = 10 * time.Millisecond
+	defer func() { localProjectPollInterval = interval }()
+
+	t.Run("DirectoryNotExist", func(t *testing.T) {
+		_, err := ListAndWatchLocalProject(filepath.Join(t.TempDir(), "any"))
+		r.Error(err)
+	})
+
+	dir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(dir, "1"), []byte(testLocalProject), 0666))
+	r.NoError(os.WriteFile(filepath.Join(dir, "README.md"), []byte("any"), 0666))
+
+	ch, err := ListAndWatchLocalProject(dir)
+	r.NoError(err)
+
+	receive := func() *contract.Project {
+		select {
+		case p := <-ch:
+			return p
+		case <-time.After(time.Second):
+			r.FailNow("no project received")
+			return nil
+		}
+	}
+
+	p := receive()
+	r.Equal(uint64(1), p.ID)
+	r.Equal([32]byte(sha256.Sum256([]byte(testLocalProject))), p.Hash)
+	r.False(p.Paused)
+
+	t.Run("Changed", func(t *testing.T) {
+		changed := []byte(testLocalProject + " ")
+		r.NoError(os.WriteFile(filepath.Join(dir, "1"), changed, 0666))
+		p := receive()
+		r.Equal(uint64(1), p.ID)
+		r.Equal([32]byte(sha256.Sum256(changed)), p.Hash)
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		r.NoError(os.Remove(filepath.Join(dir, "1")))
+		p := receive()
+		r.Equal(uint64(1), p.ID)
+		r.True(p.Paused)
+	})
+}
+
+func TestLocalRegistry(t *testing.T) {
+	r := require.New(t)
+
+	dir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(dir, "2"), []byte(testLocalProject), 0666))
+	r.NoError(os.WriteFile(filepath.Join(dir, "1"), []byte(testLocalProject), 0666))
+
+	reg, err := NewLocalRegistry(dir)
+	r.NoError(err)
+
+	ps, err := reg.List()
+	r.NoError(err)
+	r.Len(ps, 2)
+	r.Equal(uint64(1), ps[0].ID)
+
+	m, err := reg.Meta(2)
+	r.NoError(err)
+	r.Equal([32]byte(sha256.Sum256([]byte(testLocalProject))), m.Hash)
+
+	_, err = reg.Meta(3)
+	r.ErrorContains(err, "failed to read project file")
+
+	mgr := NewManager(reg, nil, NewFetcher())
+	p, err := mgr.Get(1)
+	r.NoError(err)
+	r.Equal("0.1", p.DefaultVersion)
+}
@@ -1,22 +1,50 @@
 package project
 
 import (
-	"bytes"
+	"context"
+	"log/slog"
+	"slices"
 	"sync"
+	"time"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/pkg/errors"
 
-	"github.com/machinefi/sprout/project/contracts"
-	utilscontract "github.com/machinefi/sprout/utils/contract"
+	"github.com/machinefi/sprout/utils/contract"
 )
 
+const (
+	maxProjectHistory       = 5
+	projectPrefetchAttempts = 3
+)
+
+var projectPrefetchInterval = 5 * time.Second
+
+// Version is a loaded version of the project file
+type Version struct {
+	Meta     Meta
+	Project  *Project
+	LoadedAt time.Time
+}
+
+// UpdateHook is called once the project is swapped to a new version, e.g. for pre-warming the vm instance
+type UpdateHook func(projectID uint64, p *Project)
+
+type projectUpdate struct {
+	projectID uint64
+	project   *Project
+}
+
 type Manager struct {
-	ipfsEndpoint string
-	instance     *contracts.Contracts
-	projects     sync.Map // projectID(uint64) -> *Project
-	cache        *cache   // optional
+	fetcher     *Fetcher
+	registry    Registry
+	projects    sync.Map // projectID(uint64) -> *Project
+	cache       *Cache   // optional
+	mux         sync.Mutex
+	history     map[uint64][]*Version // projectID -> loaded versions, the last one is current
+	hooks       []UpdateHook
+	updates     []projectUpdate  // the swapped projects waiting for the hooks, in swapping order
+	updated     chan struct{}    // signals the updates
+	prefetching map[uint64]*Meta // projectID -> the latest upserted meta, it's set while the prefetch is running
 }
 
 func (m *Manager) Get(projectID uint64) (*Project, error) {
@@ -32,86 +60,245 @@ func (m *Manager) Get(projectID uint64) (*Project, error) {
 }
 
 func (m *Manager) load(projectID uint64) (*Project, error) {
-	emptyHash := [32]byte{}
-	c, err := m.instance.Projects(nil, projectID)
+	pm, err := m.registry.Meta(projectID)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get project meta from chain, project_id %v", projectID)
+		return nil, err
 	}
-	if c.Uri == "" || bytes.Equal(c.Hash[:], emptyHash[:]) {
-		return nil, errors.Errorf("the project not exist, project_id %v", projectID)
+	return m.Load(pm)
+}
+
+// Load fetches the project described by the meta, and swaps the cached one to it once the hash verified;
+// the project in history is reused if it's of the same hash
+func (m *Manager) Load(pm *Meta) (*Project, error) {
+	p, err := m.fetch(pm)
+	if err != nil {
+		return nil, err
 	}
+	m.swap(pm, p)
+	return p, nil
+}
 
-	pm := &Meta{
-		ProjectID: projectID,
-		Uri:       c.Uri,
-		Hash:      c.Hash,
+// fetch returns the project of the meta without swapping to it
+func (m *Manager) fetch(pm *Meta) (*Project, error) {
+	if v := m.version(pm.ProjectID, pm.Hash); v != nil {
+		return v.Project, nil
 	}
 
-	var data []byte
+	var (
+		data []byte
+		err  error
+	)
 	cached := true
 	if m.cache != nil {
-		data = m.cache.get(projectID, c.Hash[:])
+		data = m.cache.Get(pm.ProjectID, pm.Hash)
 	}
 	if len(data) == 0 {
 		cached = false
-		data, err = pm.GetProjectRawData(m.ipfsEndpoint)
+		if r, ok := m.registry.(rawDataRegistry); ok {
+			data, err = r.rawData(pm)
+		} else {
+			data, err = m.fetcher.Fetch(context.Background(), pm)
+		}
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to get project raw data, project_id %v", projectID)
+			return nil, errors.Wrapf(err, "failed to get project raw data, project_id %v", pm.ProjectID)
 		}
 	}
 	if !cached && m.cache != nil {
-		m.cache.set(projectID, data)
+		if err := m.cache.Set(pm.ProjectID, data); err != nil {
+			slog.Error("failed to cache project file", "error", err, "project_id", pm.ProjectID)
+		}
 	}
 
 	p, err := convertProject(data)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to convert project, project_id %v", projectID)
+		return nil, errors.Wrapf(err, "failed to convert project, project_id %v", pm.ProjectID)
 	}
-	m.projects.Store(projectID, p)
 	return p, nil
 }
 
-func (m *Manager) watchProjectContract(chainEndpoint, contractAddress string) error {
-	projectCh, err := utilscontract.ListAndWatchProject(chainEndpoint, contractAddress)
-	if err != nil {
-		return err
+// swap makes the project current and records it in the history unless it's current already, the hooks are
+// queued if it's an update
+func (m *Manager) swap(pm *Meta, p *Project) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	vs := m.history[pm.ProjectID]
+	if len(vs) > 0 && vs[len(vs)-1].Project == p {
+		return
+	}
+	updated := len(vs) > 0 && vs[len(vs)-1].Meta.Hash != pm.Hash
+	vs = append(vs, &Version{Meta: *pm, Project: p, LoadedAt: time.Now()})
+	if len(vs) > maxProjectHistory {
+		vs = vs[len(vs)-maxProjectHistory:]
 	}
+	m.history[pm.ProjectID] = vs
+	m.projects.Store(pm.ProjectID, p)
 
-	go func() {
-		for p := range projectCh {
-			m.projects.Delete(p.ID)
+	if updated {
+		slog.Info("project updated", "project_id", pm.ProjectID, "uri", pm.Uri)
+		m.updates = append(m.updates, projectUpdate{projectID: pm.ProjectID, project: p})
+		select {
+		case m.updated <- struct{}{}:
+		default:
 		}
-	}()
+	}
+}
+
+// runHooks calls the hooks of the swapped projects one by one in the swapping order
+func (m *Manager) runHooks() {
+	for range m.updated {
+		m.mux.Lock()
+		updates, hooks := m.updates, slices.Clone(m.hooks)
+		m.updates = nil
+		m.mux.Unlock()
+
+		for _, u := range updates {
+			for _, h := range hooks {
+				h(u.projectID, u.project)
+			}
+		}
+	}
+}
+
+func (m *Manager) isCurrent(projectID uint64, p *Project) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	vs := m.history[projectID]
+	return len(vs) > 0 && vs[len(vs)-1].Project == p
+}
+
+// version returns the latest loaded version of the hash, nil if not loaded
+func (m *Manager) version(projectID uint64, hash [32]byte) *Version {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	vs := m.history[projectID]
+	for i := len(vs) - 1; i >= 0; i-- {
+		if vs[i].Meta.Hash == hash {
+			return vs[i]
+		}
+	}
 	return nil
 }
 
-// TODO support local project config
-func NewManager(chainEndpoint, contractAddress, projectCacheDir, ipfsEndpoint string) (*Manager, error) {
-	var c *cache
-	var err error
-	if projectCacheDir != "" {
-		c, err = newCache(projectCacheDir)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to new cache")
+// History returns the loaded versions of the project in loading order, the last one is current
+func (m *Manager) History(projectID uint64) []*Version {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return append([]*Version{}, m.history[projectID]...)
+}
+
+// OnUpdate registers the hook called once a loaded project is swapped to a new version
+func (m *Manager) OnUpdate(h UpdateHook) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.hooks = append(m.hooks, h)
+}
+
+// Registry returns the registry the projects are loaded from
+func (m *Manager) Registry() Registry {
+	return m.registry
+}
+
+// watchProject prefetches the upserted projects which are in use, the others are loaded on demand; a project
+// has one prefetch running at most, which picks up the latest upsert once it's done
+func (m *Manager) watchProject(projectCh <-chan *contract.Project) {
+	for p := range projectCh {
+		if _, ok := m.projects.Load(p.ID); !ok {
+			continue
+		}
+		m.mux.Lock()
+		_, running := m.prefetching[p.ID]
+		m.prefetching[p.ID] = &Meta{ProjectID: p.ID, Uri: p.Uri, Hash: p.Hash}
+		m.mux.Unlock()
+
+		if !running {
+			go m.prefetch(p.ID)
 		}
 	}
+}
+
+// prefetch loads the latest upserted meta of the project in background until no newer one is upserted
+func (m *Manager) prefetch(projectID uint64) {
+	var pm *Meta
+	for {
+		m.mux.Lock()
+		latest := m.prefetching[projectID]
+		if latest == pm {
+			delete(m.prefetching, projectID)
+			m.mux.Unlock()
+			return
+		}
+		m.mux.Unlock()
+
+		pm = latest
+		m.prefetchMeta(pm)
+	}
+}
 
-	client, err := ethclient.Dial(chainEndpoint)
+// superseded reports whether a newer meta of the project is upserted during the prefetch
+func (m *Manager) superseded(pm *Meta) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return m.prefetching[pm.ProjectID] != pm
+}
+
+// prefetchMeta loads the project of the meta, the current version is kept until the new one is loaded, and it's
+// swapped only if the meta is still the latest one of the registry
+func (m *Manager) prefetchMeta(pm *Meta) {
+	for attempt := 1; ; attempt++ {
+		if m.superseded(pm) {
+			return
+		}
+		err := m.prefetchOnce(pm)
+		if err == nil {
+			return
+		}
+		if attempt >= projectPrefetchAttempts {
+			slog.Error("failed to prefetch project", "error", err, "project_id", pm.ProjectID, "attempts", attempt)
+			return
+		}
+		slog.Warn("retry prefetching project", "error", err, "project_id", pm.ProjectID, "attempt", attempt)
+		time.Sleep(projectPrefetchInterval)
+	}
+}
+
+func (m *Manager) prefetchOnce(pm *Meta) error {
+	p, err := m.fetch(pm)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to dial chain, endpoint %s", chainEndpoint)
+		return err
+	}
+	if m.isCurrent(pm.ProjectID, p) {
+		return nil
 	}
-	instance, err := contracts.NewContracts(common.HexToAddress(contractAddress), client)
+	latest, err := m.registry.Meta(pm.ProjectID)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to new contract instance, endpoint %s, contractAddress %s", chainEndpoint, contractAddress)
+		return err
+	}
+	if latest.Hash != pm.Hash {
+		slog.Info("skip stale project", "project_id", pm.ProjectID, "uri", pm.Uri)
+		return nil
 	}
+	m.swap(pm, p)
+	return nil
+}
 
+// NewManager returns the manager loading the projects of the registry, the project files are fetched by the
+// fetcher unless the registry keeps them itself; cache is optional
+func NewManager(registry Registry, cache *Cache, fetcher *Fetcher) *Manager {
 	m := &Manager{
-		ipfsEndpoint: ipfsEndpoint,
-		instance:     instance,
-		cache:        c,
-	}
-	if err := m.watchProjectContract(chainEndpoint, contractAddress); err != nil {
-		return nil, err
+		fetcher:     fetcher,
+		registry:    registry,
+		cache:       cache,
+		history:     map[uint64][]*Version{},
+		updated:     make(chan struct{}, 1),
+		prefetching: map[uint64]*Meta{},
 	}
-	return m, nil
+	go m.runHooks()
+	go m.watchProject(registry.Watch())
+	return m
 }
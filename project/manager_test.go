@@ -1,42 +1,156 @@
 package project
 
 import (
+	"crypto/sha256"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/agiledragon/gomonkey/v2"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/pkg/errors"
+	. "github.com/agiledragon/gomonkey/v2"
 	"github.com/stretchr/testify/require"
-
-	"github.com/machinefi/sprout/project/contracts"
 )
 
-func TestNewManager(t *testing.T) {
+func TestManager_Get(t *testing.T) {
 	r := require.New(t)
-	p := gomonkey.NewPatches()
-	defer p.Reset()
 
-	t.Run("FailedToDialChain", func(t *testing.T) {
-		p = p.ApplyFuncReturn(ethclient.Dial, nil, errors.New(t.Name()))
+	reg := NewMemoryRegistry()
+	m := NewManager(reg, nil, NewFetcher())
 
-		_, err := NewManager("", "", "", "")
-		r.ErrorContains(err, t.Name())
+	t.Run("NotExist", func(t *testing.T) {
+		_, err := m.Get(1)
+		r.ErrorContains(err, "not exist")
 	})
-	p = p.ApplyFuncReturn(ethclient.Dial, ethclient.NewClient(&rpc.Client{}), nil)
 
-	t.Run("FailedToNewContracts", func(t *testing.T) {
-		p = p.ApplyFuncReturn(contracts.NewContracts, nil, errors.New(t.Name()))
+	t.Run("Success", func(t *testing.T) {
+		reg.Upsert(1, []byte(testLocalProject), nil)
+		p, err := m.Get(1)
+		r.NoError(err)
+		r.Equal("0.1", p.DefaultVersion)
+	})
 
-		_, err := NewManager("", "", "", "")
-		r.ErrorContains(err, t.Name())
+	t.Run("InvalidProject", func(t *testing.T) {
+		reg.Upsert(2, []byte("any"), nil)
+		_, err := m.Get(2)
+		r.ErrorContains(err, "failed to convert project")
 	})
-	p = p.ApplyFuncReturn(contracts.NewContracts, nil, nil)
+}
 
-	t.Run("Success", func(t *testing.T) {
-		p = p.ApplyPrivateMethod(&Manager{}, "watchProjectContract", func() error { return nil })
+func TestManager_Update(t *testing.T) {
+	r := require.New(t)
+
+	interval := projectPrefetchInterval
+	projectPrefetchInterval = time.Millisecond
+	defer func() { projectPrefetchInterval = interval }()
+
+	reg := NewMemoryRegistry()
+	m := NewManager(reg, nil, NewFetcher())
+
+	updated := make(chan *Project, 1)
+	m.OnUpdate(func(projectID uint64, p *Project) {
+		r.Equal(uint64(1), projectID)
+		updated <- p
+	})
+	waitUpdated := func() *Project {
+		select {
+		case p := <-updated:
+			return p
+		case <-time.After(time.Second):
+			r.FailNow("project not updated")
+			return nil
+		}
+	}
+
+	v1 := []byte(testLocalProject)
+	reg.Upsert(1, v1, nil)
+	p1, err := m.Get(1)
+	r.NoError(err)
+
+	t.Run("InvalidVersionKeepsCurrent", func(t *testing.T) {
+		reg.Upsert(1, []byte("any"), nil)
+		time.Sleep(50 * time.Millisecond)
+		p, err := m.Get(1)
+		r.NoError(err)
+		r.Same(p1, p)
+		r.Len(m.History(1), 1)
+	})
 
-		_, err := NewManager("", "", "", "")
+	t.Run("Prefetched", func(t *testing.T) {
+		reg.Upsert(1, []byte(strings.Replace(testLocalProject, `"code":"code"`, `"code":"code2"`, 1)), nil)
+		p2 := waitUpdated()
+		r.Equal("code2", p2.Versions[0].Code)
+		p, err := m.Get(1)
 		r.NoError(err)
+		r.Same(p2, p)
+		r.Len(m.History(1), 2)
+	})
+
+	t.Run("RollbackReusesHistory", func(t *testing.T) {
+		reg.Upsert(1, v1, nil)
+		r.Same(p1, waitUpdated())
+		vs := m.History(1)
+		r.Len(vs, 3)
+		r.Equal(sha256.Sum256(v1), vs[2].Meta.Hash)
 	})
 }
+
+func TestManager_OverlappingUpdates(t *testing.T) {
+	r := require.New(t)
+
+	reg := NewMemoryRegistry()
+	m := NewManager(reg, nil, NewFetcher())
+
+	updated := make(chan *Project, 2)
+	m.OnUpdate(func(_ uint64, p *Project) { updated <- p })
+
+	reg.Upsert(1, []byte(testLocalProject), nil)
+	_, err := m.Get(1)
+	r.NoError(err)
+
+	v2 := []byte(strings.Replace(testLocalProject, `"code":"code"`, `"code":"code2"`, 1))
+	v3 := []byte(strings.Replace(testLocalProject, `"code":"code"`, `"code":"code3"`, 1))
+	started, release := make(chan struct{}), make(chan struct{})
+	loadsMux, loads := sync.Mutex{}, map[[32]byte]int{}
+	p := NewPatches()
+	defer p.Reset()
+	p = p.ApplyPrivateMethod(reg, "rawData", func(_ *MemoryRegistry, pm *Meta) ([]byte, error) {
+		loadsMux.Lock()
+		loads[pm.Hash]++
+		loadsMux.Unlock()
+		if pm.Hash == sha256.Sum256(v2) {
+			close(started)
+			<-release
+			return v2, nil
+		}
+		return v3, nil
+	})
+
+	reg.Upsert(1, v2, nil)
+	<-started
+	reg.Upsert(1, v3, nil)
+	time.Sleep(50 * time.Millisecond)
+	loadsMux.Lock()
+	r.Len(loads, 1, "the second upsert waits for the running prefetch")
+	loadsMux.Unlock()
+	close(release)
+
+	select {
+	case p3 := <-updated:
+		r.Equal("code3", p3.Versions[0].Code)
+	case <-time.After(time.Second):
+		r.FailNow("project not updated")
+	}
+	select {
+	case p := <-updated:
+		r.FailNow("unexpected update", "code %s", p.Versions[0].Code)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cur, err := m.Get(1)
+	r.NoError(err)
+	r.Equal("code3", cur.Versions[0].Code)
+	r.Len(m.History(1), 2, "the stale version is not swapped")
+	loadsMux.Lock()
+	defer loadsMux.Unlock()
+	r.Equal(1, loads[sha256.Sum256(v3)])
+}
@@ -1,18 +1,14 @@
 package project
 
 import (
-	"bytes"
-	"crypto/sha256"
 	"encoding/json"
-	"io"
-	"net/http"
-	"net/url"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/machinefi/sprout/output"
-	"github.com/machinefi/sprout/utils/ipfs"
 	"github.com/machinefi/sprout/vm"
 )
 
@@ -20,6 +16,11 @@ var (
 	errEmptyConfig       = errors.New("config is empty")
 	errEmptyCode         = errors.New("code is empty")
 	errUnsupportedVMType = errors.New("unsupported vm type")
+	errInvalidRetryWait  = errors.New("invalid retry policy wait time")
+	errInvalidOutputMode = errors.New("invalid output mode")
+	errDuplicatedVersion = errors.New("duplicated project version")
+
+	ErrVersionNotExist = errors.New("project version not exist")
 )
 
 type Project struct {
@@ -40,11 +41,87 @@ type Attribute struct {
 }
 
 type Config struct {
-	Version      string        `json:"version"`
-	VMType       vm.Type       `json:"vmType"`
-	Output       output.Config `json:"output"`
-	CodeExpParam string        `json:"codeExpParam,omitempty"`
-	Code         string        `json:"code"`
+	Version string        `json:"version"`
+	VMType  vm.Type       `json:"vmType"`
+	Output  output.Config `json:"output"`
+	// Outputs fan the proof out to all of them, Output is ignored if it's not empty
+	Outputs      []output.Config `json:"outputs,omitempty"`
+	OutputMode   OutputMode      `json:"outputMode,omitempty"`
+	CodeExpParam string          `json:"codeExpParam,omitempty"`
+	Code         string          `json:"code"`
+	RetryPolicy  *RetryPolicy    `json:"retryPolicy,omitempty"`
+}
+
+// OutputMode defines when the outputs fail the task
+type OutputMode string
+
+const (
+	// OutputModeAll fails the task if any output not marked optional failed, it's the default mode
+	OutputModeAll OutputMode = "all"
+	// OutputModeBestEffort fails the task only if all outputs failed
+	OutputModeBestEffort OutputMode = "bestEffort"
+)
+
+// GetOutputs returns the outputs of the config, the single Output if Outputs is empty; the vm type
+// of the config is set to them for decoding the proofs
+func (c *Config) GetOutputs() []output.Config {
+	outputs := []output.Config{c.Output}
+	if len(c.Outputs) > 0 {
+		outputs = append([]output.Config{}, c.Outputs...)
+	}
+	for i := range outputs {
+		outputs[i].VMType = c.VMType
+	}
+	return outputs
+}
+
+// RetryPolicy defines how the coordinator republishes a task which has no result from provers.
+// InitialWait and MaxTotalTime are go duration strings, e.g. "5m"; empty MaxTotalTime means no limit.
+// The zero MaxAttempts, InitialWait and BackoffMultiplier are filled with the defaults
+type RetryPolicy struct {
+	MaxAttempts       uint64  `json:"maxAttempts,omitempty"`
+	InitialWait       string  `json:"initialWait"`
+	BackoffMultiplier float64 `json:"backoffMultiplier,omitempty"`
+	Jitter            float64 `json:"jitter,omitempty"`
+	MaxTotalTime      string  `json:"maxTotalTime,omitempty"`
+}
+
+func (r *RetryPolicy) GetInitialWait() (time.Duration, error) {
+	return parseRetryDuration(r.InitialWait)
+}
+
+func (r *RetryPolicy) GetMaxTotalTime() (time.Duration, error) {
+	return parseRetryDuration(r.MaxTotalTime)
+}
+
+func (r *RetryPolicy) Validate() error {
+	if _, err := r.GetInitialWait(); err != nil {
+		return err
+	}
+	if _, err := r.GetMaxTotalTime(); err != nil {
+		return err
+	}
+	if r.BackoffMultiplier < 0 {
+		return errors.New("invalid retry policy backoff multiplier")
+	}
+	if r.Jitter < 0 || r.Jitter >= 1 {
+		return errors.New("invalid retry policy jitter, it should be in [0, 1)")
+	}
+	return nil
+}
+
+func parseRetryDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrap(err, errInvalidRetryWait.Error())
+	}
+	if d < 0 {
+		return 0, errInvalidRetryWait
+	}
+	return d, nil
 }
 
 func (p *Project) GetConfig(version string) (*Config, error) {
@@ -53,80 +130,107 @@ func (p *Project) GetConfig(version string) (*Config, error) {
 			return c, nil
 		}
 	}
-	return nil, errors.New("project config not exist")
+	return nil, errors.Wrapf(ErrVersionNotExist, "version %s", version)
 }
 
 func (p *Project) GetDefaultConfig() (*Config, error) {
 	return p.GetConfig(p.DefaultVersion)
 }
 
+// GetTaskConfig returns the config of the project version the task is submitted for, the default
+// config if the task has no version
+func (p *Project) GetTaskConfig(version string) (*Config, error) {
+	if version == "" {
+		return p.GetDefaultConfig()
+	}
+	return p.GetConfig(version)
+}
+
+// ValidationErrors are all the problems found in a project file
+type ValidationErrors []error
+
+func (es ValidationErrors) Error() string {
+	if len(es) == 1 {
+		return es[0].Error()
+	}
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("%d problems: %s", len(es), strings.Join(msgs, "; "))
+}
+
+func (es ValidationErrors) Unwrap() []error {
+	return es
+}
+
+// join returns nil if there is no problem
+func (es ValidationErrors) join() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// Validate checks every version of the project, the outputs are created in dry run mode; all problems are
+// reported as ValidationErrors
 func (p *Project) Validate() error {
 	if len(p.Versions) == 0 {
 		return errEmptyConfig
 	}
-	for _, c := range p.Versions {
+	es := ValidationErrors{}
+	versions := map[string]bool{}
+	for i, c := range p.Versions {
+		if versions[c.Version] {
+			es = append(es, errors.Wrapf(errDuplicatedVersion, "versions[%d] %s", i, c.Version))
+		}
+		versions[c.Version] = true
 		if err := c.Validate(); err != nil {
-			return err
+			for _, e := range flatten(err) {
+				es = append(es, errors.Wrapf(e, "versions[%d] %s", i, c.Version))
+			}
 		}
 	}
-	return nil
+	if !versions[p.DefaultVersion] {
+		es = append(es, errors.Wrapf(ErrVersionNotExist, "default version %s", p.DefaultVersion))
+	}
+	return es.join()
 }
 
+// Validate checks the config, the outputs are created in dry run mode; all problems are reported as ValidationErrors
 func (c *Config) Validate() error {
+	es := ValidationErrors{}
 	if len(c.Code) == 0 {
-		return errEmptyCode
+		es = append(es, errEmptyCode)
 	}
 	switch c.VMType {
-	default:
-		return errUnsupportedVMType
 	case vm.Halo2, vm.Wasm, vm.Risc0, vm.ZKwasm:
-		return nil
-	}
-}
-
-func (m *Meta) GetProjectRawData(ipfsEndpoint string) ([]byte, error) {
-	u, err := url.Parse(m.Uri)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to parse project uri %s", m.Uri)
+	default:
+		es = append(es, errors.Wrapf(errUnsupportedVMType, "vm type %s", c.VMType))
 	}
-
-	var data []byte
-	switch u.Scheme {
-	case "http", "https":
-		resp, _err := http.Get(m.Uri)
-		if _err != nil {
-			return nil, errors.Wrapf(_err, "failed to fetch project, uri %s", m.Uri)
+	if c.RetryPolicy != nil {
+		if err := c.RetryPolicy.Validate(); err != nil {
+			es = append(es, err)
 		}
-		defer resp.Body.Close()
-		// TODO network error should try again
-		data, err = io.ReadAll(resp.Body)
-
-	case "ipfs":
-		// ipfs url: ipfs://${endpoint}/${cid}
-		sh := ipfs.NewIPFS(u.Host)
-		cid := strings.Split(strings.Trim(u.Path, "/"), "/")
-		data, err = sh.Cat(cid[0])
-
+	}
+	switch c.OutputMode {
+	case "", OutputModeAll, OutputModeBestEffort:
 	default:
-		// fetch content by ipfs cid with default endpoint
-		sh := ipfs.NewIPFS(ipfsEndpoint)
-		cid := strings.Split(strings.Trim(u.Path, "/"), "/")
-		data, err = sh.Cat(cid[0])
+		es = append(es, errors.Wrapf(errInvalidOutputMode, "output mode %s", c.OutputMode))
 	}
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to read project, uri %s", m.Uri)
+	for i, o := range c.GetOutputs() {
+		if err := output.Validate(&o); err != nil {
+			es = append(es, errors.Wrapf(err, "outputs[%d] %s", i, o.Type))
+		}
 	}
+	return es.join()
+}
 
-	h := sha256.New()
-	if _, err := h.Write(data); err != nil {
-		return nil, errors.Wrap(err, "failed to generate project hash")
-	}
-	if !bytes.Equal(h.Sum(nil), m.Hash[:]) {
-		return nil, errors.New("failed to validate project hash")
+func flatten(err error) []error {
+	if es, ok := err.(ValidationErrors); ok {
+		return es
 	}
-
-	return data, nil
+	return []error{err}
 }
 
 func convertProject(projectRawData []byte) (*Project, error) {
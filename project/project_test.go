@@ -1,111 +1,90 @@
 package project
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/json"
-	"io"
-	"net/http"
-	"net/url"
 	"testing"
 
-	"github.com/agiledragon/gomonkey/v2"
-	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
-	"github.com/machinefi/sprout/utils/ipfs"
+	"github.com/machinefi/sprout/output"
+	"github.com/machinefi/sprout/vm"
 )
 
-func TestProjectMeta_GetConfigs_init(t *testing.T) {
+func TestConfig_GetOutputs(t *testing.T) {
 	r := require.New(t)
-	p := gomonkey.NewPatches()
-	defer p.Reset()
 
-	t.Run("InvalidUri", func(t *testing.T) {
-		p = p.ApplyFuncReturn(url.Parse, nil, errors.New(t.Name()))
+	c := &Config{Code: "code", VMType: vm.Risc0, Output: output.Config{Type: output.Stdout}}
+	r.Equal([]output.Config{{Type: output.Stdout, VMType: vm.Risc0}}, c.GetOutputs())
 
-		_, err := (&Meta{}).GetProjectRawData("")
-		r.ErrorContains(err, t.Name())
-	})
+	c.Outputs = []output.Config{{Type: output.Webhook}, {Type: output.Database, Optional: true}}
+	r.Equal([]output.Config{{Type: output.Webhook, VMType: vm.Risc0}, {Type: output.Database, Optional: true, VMType: vm.Risc0}}, c.GetOutputs())
+	r.Empty(c.Outputs[0].VMType)
+
+	c.Outputs[0].Webhook.URL = "http://localhost"
+	c.Outputs[1].Database.DSN = "postgres://localhost/db"
+	r.NoError(c.Validate())
+	c.OutputMode = OutputModeBestEffort
+	r.NoError(c.Validate())
+	c.OutputMode = "any"
+	r.ErrorIs(c.Validate(), errInvalidOutputMode)
 }
 
-func TestProjectMeta_GetConfigs_http(t *testing.T) {
+func TestProject_GetTaskConfig(t *testing.T) {
 	r := require.New(t)
-	p := gomonkey.NewPatches()
-	defer p.Reset()
-
-	c := Project{}
-	jc, err := json.Marshal(c)
-	r.NoError(err)
-
-	h := sha256.New()
-	_, err = h.Write(jc)
-	r.NoError(err)
-	hash := h.Sum(nil)
 
-	pm := &Meta{
-		Uri:  "https://test.com/project_config",
-		Hash: [32]byte(hash),
+	p := &Project{
+		DefaultVersion: "0.1",
+		Versions:       []*Config{{Version: "0.1", Code: "code1"}, {Version: "0.2", Code: "code2"}},
 	}
 
-	t.Run("FailedToGetHTTP", func(t *testing.T) {
-		p = p.ApplyFuncReturn(http.Get, nil, errors.New(t.Name()))
+	c, err := p.GetTaskConfig("0.2")
+	r.NoError(err)
+	r.Equal("code2", c.Code)
 
-		_, err := pm.GetProjectRawData("")
-		r.ErrorContains(err, t.Name())
-	})
-	t.Run("FailedToIOReadAll", func(t *testing.T) {
-		p = p.ApplyFuncReturn(http.Get, &http.Response{
-			Body: io.NopCloser(bytes.NewReader(jc)),
-		}, nil)
-		p = p.ApplyFuncReturn(io.ReadAll, nil, errors.New(t.Name()))
-
-		_, err := pm.GetProjectRawData("")
-		r.ErrorContains(err, t.Name())
-	})
-	t.Run("HashMismatch", func(t *testing.T) {
-		p = p.ApplyFuncReturn(io.ReadAll, jc, nil)
+	c, err = p.GetTaskConfig("")
+	r.NoError(err)
+	r.Equal("code1", c.Code)
 
-		npm := *pm
-		npm.Hash = [32]byte{}
-		_, err := npm.GetProjectRawData("")
-		r.ErrorContains(err, "failed to validate project hash")
-	})
-	t.Run("Success", func(t *testing.T) {
-		_, err := pm.GetProjectRawData("")
-		r.NoError(err)
-	})
+	_, err = p.GetTaskConfig("0.3")
+	r.ErrorIs(err, ErrVersionNotExist)
+	r.ErrorContains(err, "version 0.3")
 }
 
-func TestProjectMeta_GetConfigs_ipfs(t *testing.T) {
+func TestProject_Validate(t *testing.T) {
 	r := require.New(t)
-	p := gomonkey.NewPatches()
-	defer p.Reset()
-
-	pm := &Meta{
-		Uri: "ipfs://test.com/123",
-	}
-	t.Run("FailedToGetIPFS", func(t *testing.T) {
-		p = p.ApplyMethodReturn(&ipfs.IPFS{}, "Cat", nil, errors.New(t.Name()))
-
-		_, err := pm.GetProjectRawData("")
-		r.ErrorContains(err, t.Name())
-	})
-}
 
-func TestProjectMeta_GetConfigs_default(t *testing.T) {
-	r := require.New(t)
-	p := gomonkey.NewPatches()
-	defer p.Reset()
+	r.ErrorIs((&Project{}).Validate(), errEmptyConfig)
 
-	pm := &Meta{
-		Uri: "test.com/123",
+	p := &Project{
+		DefaultVersion: "0.1",
+		Versions: []*Config{
+			{Version: "0.1", Code: "code", VMType: vm.Risc0},
+			{Version: "0.2", Code: "code", VMType: vm.Halo2, Output: output.Config{Type: output.Stdout}},
+		},
 	}
-
-	t.Run("FailedToGetIPFS", func(t *testing.T) {
-		p = p.ApplyMethodReturn(&ipfs.IPFS{}, "Cat", nil, errors.New(t.Name()))
-
-		_, err := pm.GetProjectRawData("")
-		r.ErrorContains(err, t.Name())
+	r.NoError(p.Validate())
+
+	p.DefaultVersion = "0.3"
+	p.Versions = append(p.Versions, &Config{
+		Version:    "0.2",
+		VMType:     "any",
+		OutputMode: "any",
+		Outputs: []output.Config{
+			{Type: output.Stdout},
+			{Type: output.EthereumContract, Ethereum: output.EthereumConfig{ContractAbiJSON: "[]", ContractMethod: "submit"}},
+			{Type: output.SolanaProgram, Solana: output.SolanaConfig{ProgramID: "any"}},
+		},
 	})
+	err := p.Validate()
+	r.ErrorIs(err, errDuplicatedVersion)
+	r.ErrorIs(err, ErrVersionNotExist)
+	r.ErrorIs(err, errEmptyCode)
+	r.ErrorIs(err, errUnsupportedVMType)
+	r.ErrorIs(err, errInvalidOutputMode)
+
+	var es ValidationErrors
+	r.ErrorAs(err, &es)
+	r.Len(es, 7)
+	r.ErrorContains(es[4], "versions[2] 0.2: outputs[1] ethereumContract: the contract method not exist in abi")
+	r.ErrorContains(es[5], "versions[2] 0.2: outputs[2] solanaProgram: invalid program id")
+	r.ErrorContains(err, "7 problems")
 }
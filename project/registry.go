@@ -0,0 +1,215 @@
+package project
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/utils/contract"
+)
+
+// Registry is where the projects are registered, e.g. the project registrar contract
+type Registry interface {
+	// List returns the projects currently registered
+	List() ([]*contract.Project, error)
+	// Meta returns the meta of the project, error if the project not exist
+	Meta(projectID uint64) (*Meta, error)
+	// Watch returns a channel of the upserted projects, the latest state of the known projects is sent first
+	Watch() <-chan *contract.Project
+}
+
+// rawDataRegistry is implemented by the registries keeping the project files themselves
+type rawDataRegistry interface {
+	rawData(pm *Meta) ([]byte, error)
+}
+
+// projectHub fans the projects of a registry out to the watchers
+type projectHub struct {
+	mux      sync.Mutex
+	projects map[uint64]*contract.Project
+	watchers []*projectWatcher
+}
+
+// run publishes the projects received from the source channel
+func (h *projectHub) run(projectCh <-chan *contract.Project) {
+	for p := range projectCh {
+		h.publish(p)
+	}
+}
+
+// publish never blocks on the watchers, a slow watcher only receives the latest state of its pending projects
+func (h *projectHub) publish(p *contract.Project) {
+	h.mux.Lock()
+	if h.projects == nil {
+		h.projects = map[uint64]*contract.Project{}
+	}
+	h.projects[p.ID] = p
+	watchers := slices.Clone(h.watchers)
+	h.mux.Unlock()
+
+	for _, w := range watchers {
+		w.push(p.ID)
+	}
+}
+
+func (h *projectHub) watch() <-chan *contract.Project {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	w := &projectWatcher{
+		hub:     h,
+		pending: map[uint64]bool{},
+		signal:  make(chan struct{}, 1),
+		ch:      make(chan *contract.Project),
+	}
+	ids := make([]uint64, 0, len(h.projects))
+	for id := range h.projects {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		w.push(id)
+	}
+	h.watchers = append(h.watchers, w)
+	go w.run()
+	return w.ch
+}
+
+func (h *projectHub) project(id uint64) *contract.Project {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	return h.projects[id]
+}
+
+// projectWatcher queues the upserted project ids of a watcher, the latest state of the project is sent when
+// it's dequeued, so the upserts of a pending project are coalesced
+type projectWatcher struct {
+	hub     *projectHub
+	mux     sync.Mutex
+	pending map[uint64]bool
+	order   []uint64 // the pending project ids in the order they are queued
+	signal  chan struct{}
+	ch      chan *contract.Project
+}
+
+func (w *projectWatcher) push(id uint64) {
+	w.mux.Lock()
+	if !w.pending[id] {
+		w.pending[id] = true
+		w.order = append(w.order, id)
+	}
+	w.mux.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *projectWatcher) pop() (uint64, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if len(w.order) == 0 {
+		return 0, false
+	}
+	id := w.order[0]
+	w.order = w.order[1:]
+	delete(w.pending, id)
+	return id, true
+}
+
+// run sends the pending projects to the watcher channel
+func (w *projectWatcher) run() {
+	for range w.signal {
+		for id, ok := w.pop(); ok; id, ok = w.pop() {
+			w.ch <- w.hub.project(id)
+		}
+	}
+}
+
+// MemoryRegistry keeps the projects in memory, it's used by tests and tools
+type MemoryRegistry struct {
+	hub  projectHub
+	mux  sync.RWMutex
+	data map[uint64][]byte
+}
+
+var _ Registry = (*MemoryRegistry)(nil)
+
+// Upsert registers the project file, the upsert is sent to the watchers
+func (r *MemoryRegistry) Upsert(projectID uint64, data []byte, attr *Attribute) {
+	r.mux.Lock()
+	r.data[projectID] = data
+	r.mux.Unlock()
+
+	p := &contract.Project{
+		ID:   projectID,
+		Uri:  "memory://" + strconv.FormatUint(projectID, 10),
+		Hash: sha256.Sum256(data),
+	}
+	if attr != nil {
+		p.Paused = attr.Paused
+		p.RequestedProverAmount = attr.RequestedProverAmount
+	}
+	r.hub.publish(p)
+}
+
+func (r *MemoryRegistry) List() ([]*contract.Project, error) {
+	r.hub.mux.Lock()
+	defer r.hub.mux.Unlock()
+
+	ps := make([]*contract.Project, 0, len(r.hub.projects))
+	for _, p := range r.hub.projects {
+		ps = append(ps, p)
+	}
+	slices.SortFunc(ps, func(a, b *contract.Project) int { return cmp.Compare(a.ID, b.ID) })
+	return ps, nil
+}
+
+func (r *MemoryRegistry) Meta(projectID uint64) (*Meta, error) {
+	r.hub.mux.Lock()
+	defer r.hub.mux.Unlock()
+
+	p, ok := r.hub.projects[projectID]
+	if !ok {
+		return nil, errors.Errorf("the project not exist, project_id %v", projectID)
+	}
+	return &Meta{ProjectID: p.ID, Uri: p.Uri, Hash: p.Hash}, nil
+}
+
+func (r *MemoryRegistry) Watch() <-chan *contract.Project {
+	return r.hub.watch()
+}
+
+func (r *MemoryRegistry) rawData(pm *Meta) ([]byte, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	data, ok := r.data[pm.ProjectID]
+	if !ok {
+		return nil, errors.Errorf("the project not exist, project_id %v", pm.ProjectID)
+	}
+	if sha256.Sum256(data) != pm.Hash {
+		return nil, errors.New("failed to validate project hash")
+	}
+	return data, nil
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{data: map[uint64][]byte{}}
+}
+
+// NewRegistry returns the local registry of the project file directory if it's given, otherwise the
+// registry of the project registrar contract
+func NewRegistry(chainEndpoint, contractAddress, projectFileDir string) (Registry, error) {
+	if projectFileDir != "" {
+		return NewLocalRegistry(projectFileDir)
+	}
+	return NewChainRegistry(chainEndpoint, contractAddress)
+}
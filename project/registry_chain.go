@@ -0,0 +1,70 @@
+package project
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/project/contracts"
+	"github.com/machinefi/sprout/utils/contract"
+)
+
+// ChainRegistry reads the projects from the project registrar contract, the chain is dialed once and
+// watched once for all watchers
+type ChainRegistry struct {
+	client          *ethclient.Client
+	instance        *contracts.Contracts
+	contractAddress string
+	hub             projectHub
+}
+
+var _ Registry = (*ChainRegistry)(nil)
+
+func (r *ChainRegistry) List() ([]*contract.Project, error) {
+	return contract.ListProject(r.client, r.contractAddress)
+}
+
+func (r *ChainRegistry) Meta(projectID uint64) (*Meta, error) {
+	emptyHash := [32]byte{}
+	c, err := r.instance.Projects(nil, projectID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get project meta from chain, project_id %v", projectID)
+	}
+	if c.Uri == "" || bytes.Equal(c.Hash[:], emptyHash[:]) {
+		return nil, errors.Errorf("the project not exist, project_id %v", projectID)
+	}
+	return &Meta{
+		ProjectID: projectID,
+		Uri:       c.Uri,
+		Hash:      c.Hash,
+	}, nil
+}
+
+func (r *ChainRegistry) Watch() <-chan *contract.Project {
+	return r.hub.watch()
+}
+
+func NewChainRegistry(chainEndpoint, contractAddress string) (*ChainRegistry, error) {
+	client, err := ethclient.Dial(chainEndpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial chain, endpoint %s", chainEndpoint)
+	}
+	instance, err := contracts.NewContracts(common.HexToAddress(contractAddress), client)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to new contract instance, endpoint %s, contractAddress %s", chainEndpoint, contractAddress)
+	}
+	projectCh, err := contract.ListAndWatchProjectByClient(client, contractAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ChainRegistry{
+		client:          client,
+		instance:        instance,
+		contractAddress: contractAddress,
+	}
+	go r.hub.run(projectCh)
+	return r, nil
+}
@@ -0,0 +1,53 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/project/contracts"
+	"github.com/machinefi/sprout/utils/contract"
+)
+
+func TestNewChainRegistry(t *testing.T) {
+	r := require.New(t)
+	p := gomonkey.NewPatches()
+	defer p.Reset()
+
+	t.Run("FailedToDialChain", func(t *testing.T) {
+		p = p.ApplyFuncReturn(ethclient.Dial, nil, errors.New(t.Name()))
+
+		_, err := NewChainRegistry("", "")
+		r.ErrorContains(err, t.Name())
+	})
+	p = p.ApplyFuncReturn(ethclient.Dial, ethclient.NewClient(&rpc.Client{}), nil)
+
+	t.Run("FailedToNewContracts", func(t *testing.T) {
+		p = p.ApplyFuncReturn(contracts.NewContracts, nil, errors.New(t.Name()))
+
+		_, err := NewChainRegistry("", "")
+		r.ErrorContains(err, t.Name())
+	})
+	p = p.ApplyFuncReturn(contracts.NewContracts, nil, nil)
+
+	t.Run("FailedToWatchProject", func(t *testing.T) {
+		p = p.ApplyFuncReturn(contract.ListAndWatchProjectByClient, nil, errors.New(t.Name()))
+
+		_, err := NewChainRegistry("", "")
+		r.ErrorContains(err, t.Name())
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		ch := make(chan *contract.Project, 1)
+		ch <- &contract.Project{ID: 1}
+		p = p.ApplyFuncReturn(contract.ListAndWatchProjectByClient, (<-chan *contract.Project)(ch), nil)
+
+		reg, err := NewChainRegistry("", "")
+		r.NoError(err)
+		r.Equal(uint64(1), (<-reg.Watch()).ID)
+	})
+}
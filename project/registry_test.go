@@ -0,0 +1,92 @@
+package project
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/utils/contract"
+)
+
+func TestProjectHub(t *testing.T) {
+	r := require.New(t)
+
+	h := &projectHub{}
+	h.publish(&contract.Project{ID: 2, BlockNumber: 1})
+	h.publish(&contract.Project{ID: 1, BlockNumber: 1})
+	h.publish(&contract.Project{ID: 2, BlockNumber: 2})
+
+	ch := h.watch()
+	r.Equal(&contract.Project{ID: 1, BlockNumber: 1}, <-ch)
+	r.Equal(&contract.Project{ID: 2, BlockNumber: 2}, <-ch)
+
+	h.publish(&contract.Project{ID: 3})
+	select {
+	case p := <-ch:
+		r.Equal(uint64(3), p.ID)
+	case <-time.After(time.Second):
+		r.FailNow("no project received")
+	}
+
+	t.Run("SlowWatcher", func(t *testing.T) {
+		slow := h.watch()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := uint64(1); i <= 100; i++ {
+				h.publish(&contract.Project{ID: 4, BlockNumber: i})
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			r.FailNow("publish blocked by the slow watcher")
+		}
+
+		received := 0
+		for last := (&contract.Project{}); last.ID != 4 || last.BlockNumber != 100; {
+			select {
+			case last = <-slow:
+				received++
+			case <-time.After(time.Second):
+				r.FailNow("the latest project not received")
+			}
+		}
+		r.Less(received, 100)
+	})
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	r := require.New(t)
+
+	reg := NewMemoryRegistry()
+	ch := reg.Watch()
+
+	_, err := reg.Meta(1)
+	r.Error(err)
+
+	reg.Upsert(2, []byte("project2"), &Attribute{RequestedProverAmount: 3})
+	reg.Upsert(1, []byte("project1"), nil)
+
+	p := <-ch
+	r.Equal(uint64(2), p.ID)
+	r.Equal(uint64(3), p.RequestedProverAmount)
+	r.Equal(uint64(1), (<-ch).ID)
+
+	ps, err := reg.List()
+	r.NoError(err)
+	r.Len(ps, 2)
+	r.Equal(uint64(1), ps[0].ID)
+
+	m, err := reg.Meta(1)
+	r.NoError(err)
+	data, err := reg.rawData(m)
+	r.NoError(err)
+	r.Equal([]byte("project1"), data)
+
+	reg.Upsert(1, []byte("project1 changed"), nil)
+	_, err = reg.rawData(m)
+	r.ErrorContains(err, "hash")
+}
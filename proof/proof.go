@@ -0,0 +1,175 @@
+package proof
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/machinefi/sprout/vm"
+)
+
+var (
+	ErrMissingSeal            = errors.New("proof missing seal")
+	ErrMissingPostStateDigest = errors.New("proof missing post state digest")
+	ErrMissingJournal         = errors.New("proof missing journal")
+)
+
+// Proof is the vm independent form of the proof returned by a vm
+type Proof struct {
+	VMType vm.Type
+	// Seal is the cryptographic proof which is checked by the verifier
+	Seal []byte
+	// PublicInputs is the risc0 journal or the serialized public instances of the circuit, empty if the proof
+	// doesn't carry them
+	PublicInputs []byte
+	// VerifierID identifies the verifying key, e.g. the zkwasm vk, empty if the proof doesn't carry it
+	VerifierID []byte
+	// PostStateDigest is only set by risc0 snark receipt
+	PostStateDigest []byte
+	// Raw is the decoded proof document, e.g. the receipt JSON of risc0
+	Raw []byte
+}
+
+// Decoder normalizes the proof generated by a type of vm
+type Decoder func(raw []byte) (*Proof, error)
+
+var decoders = map[vm.Type]Decoder{
+	vm.Risc0:  decodeRisc0,
+	vm.Halo2:  decodeHalo2,
+	vm.ZKwasm: decodeZKwasm,
+	vm.Wasm:   decodeWasm,
+}
+
+// Decode normalizes the raw proof by the decoder of the vm type
+func Decode(vmType vm.Type, raw []byte) (*Proof, error) {
+	d, ok := decoders[vmType]
+	if !ok {
+		return nil, errors.Errorf("unsupported vm type %s", vmType)
+	}
+	p, err := d(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s proof", vmType)
+	}
+	p.VMType = vmType
+	return p, nil
+}
+
+// decodeRisc0 decodes the receipt JSON, which may be hex encoded, of both snark and stark receipts
+func decodeRisc0(raw []byte) (*Proof, error) {
+	doc, err := jsonDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proof{Raw: doc}
+
+	if snark := gjson.GetBytes(doc, "Snark"); snark.Exists() {
+		if p.Seal, err = bytesOf(snark.Get("snark")); err != nil {
+			return nil, errors.Wrap(err, "invalid seal")
+		}
+		if p.PostStateDigest, err = bytesOf(snark.Get("post_state_digest")); err != nil {
+			return nil, errors.Wrap(err, "invalid post state digest")
+		}
+		journal := snark.Get("journal")
+		if !journal.Exists() {
+			return nil, ErrMissingJournal
+		}
+		if p.PublicInputs, err = bytesOf(journal); err != nil {
+			return nil, errors.Wrap(err, "invalid journal")
+		}
+		return p, nil
+	}
+
+	stark := gjson.GetBytes(doc, "Stark")
+	if !stark.Exists() {
+		return nil, errors.New("neither snark nor stark receipt")
+	}
+	journal := stark.Get("journal.bytes")
+	if !journal.Exists() {
+		return nil, ErrMissingJournal
+	}
+	if p.PublicInputs, err = bytesOf(journal); err != nil {
+		return nil, errors.Wrap(err, "invalid journal")
+	}
+	if inner := stark.Get("inner"); inner.Exists() {
+		p.Seal = []byte(inner.Raw)
+	}
+	return p, nil
+}
+
+// decodeHalo2 decodes the hex encoded proof, the public instances are not part of it
+func decodeHalo2(raw []byte) (*Proof, error) {
+	seal, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(raw)), "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode hex proof")
+	}
+	if len(seal) == 0 {
+		return nil, ErrMissingSeal
+	}
+	return &Proof{Seal: seal, Raw: raw}, nil
+}
+
+// decodeZKwasm decodes the JSON {"proof", "instances", "vk"}, proof and vk are base64 encoded
+func decodeZKwasm(raw []byte) (*Proof, error) {
+	doc, err := jsonDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	seal, err := base64.StdEncoding.DecodeString(gjson.GetBytes(doc, "proof").String())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode base64 proof")
+	}
+	if len(seal) == 0 {
+		return nil, ErrMissingSeal
+	}
+	vk, err := base64.StdEncoding.DecodeString(gjson.GetBytes(doc, "vk").String())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode base64 vk")
+	}
+	p := &Proof{Seal: seal, VerifierID: vk, Raw: doc}
+	if instances := gjson.GetBytes(doc, "instances"); instances.Exists() {
+		p.PublicInputs = []byte(instances.Raw)
+	}
+	return p, nil
+}
+
+// decodeWasm takes the result of the wasm program as the public inputs, there is no seal
+func decodeWasm(raw []byte) (*Proof, error) {
+	return &Proof{PublicInputs: raw, Raw: raw}, nil
+}
+
+// jsonDocument returns the JSON document, hex decoding it if needed
+func jsonDocument(raw []byte) ([]byte, error) {
+	if gjson.ValidBytes(raw) {
+		return raw, nil
+	}
+	doc, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(raw)), "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode hex proof")
+	}
+	if !gjson.ValidBytes(doc) {
+		return nil, errors.New("proof is not JSON")
+	}
+	return doc, nil
+}
+
+// bytesOf converts a JSON byte array to bytes, other values except arrays are kept as the string
+func bytesOf(v gjson.Result) ([]byte, error) {
+	if !v.Exists() {
+		return nil, nil
+	}
+	if !v.IsArray() {
+		return []byte(v.String()), nil
+	}
+	elems := v.Array()
+	b := make([]byte, 0, len(elems))
+	for k, e := range elems {
+		if e.Type != gjson.Number || e.Num < 0 || e.Num > 255 || e.Num != float64(int(e.Num)) {
+			return nil, errors.Errorf("element %d is not a byte: %s", k, e.Raw)
+		}
+		b = append(b, byte(e.Num))
+	}
+	return b, nil
+}
@@ -0,0 +1,102 @@
+package proof
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/vm"
+)
+
+func TestDecode(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("UnsupportedVMType", func(t *testing.T) {
+		_, err := Decode("any", []byte("any"))
+		r.ErrorContains(err, "unsupported vm type")
+	})
+
+	t.Run("Risc0", func(t *testing.T) {
+		t.Run("InvalidProof", func(t *testing.T) {
+			_, err := Decode(vm.Risc0, []byte("INVALID_HEX_DECODING"))
+			r.Error(err)
+			_, err = Decode(vm.Risc0, []byte(hex.EncodeToString([]byte("not json"))))
+			r.ErrorContains(err, "not JSON")
+			_, err = Decode(vm.Risc0, []byte(`{}`))
+			r.ErrorContains(err, "neither snark nor stark")
+		})
+		t.Run("Snark", func(t *testing.T) {
+			receipt := `{"Snark":{"snark":{"a":[[1]]},"post_state_digest":[1,2],"journal":[3,4]}}`
+			p, err := Decode(vm.Risc0, []byte(hex.EncodeToString([]byte(receipt))))
+			r.NoError(err)
+			r.Equal(&Proof{
+				VMType:          vm.Risc0,
+				Seal:            []byte(`{"a":[[1]]}`),
+				PublicInputs:    []byte{3, 4},
+				PostStateDigest: []byte{1, 2},
+				Raw:             []byte(receipt),
+			}, p)
+		})
+		t.Run("SnarkMissingJournal", func(t *testing.T) {
+			_, err := Decode(vm.Risc0, []byte(`{"Snark":{"snark":"seal","post_state_digest":"digest"}}`))
+			r.ErrorIs(err, ErrMissingJournal)
+
+			p, err := Decode(vm.Risc0, []byte(`{"Snark":{"journal":[1]}}`))
+			r.NoError(err)
+			r.Empty(p.Seal)
+			r.Empty(p.PostStateDigest)
+			r.Equal([]byte{1}, p.PublicInputs)
+		})
+		t.Run("SnarkNotByteArray", func(t *testing.T) {
+			_, err := Decode(vm.Risc0, []byte(`{"Snark":{"snark":[1,256],"post_state_digest":[1],"journal":[1]}}`))
+			r.ErrorContains(err, "invalid seal")
+			_, err = Decode(vm.Risc0, []byte(`{"Snark":{"post_state_digest":["1"],"journal":[1]}}`))
+			r.ErrorContains(err, "invalid post state digest")
+			_, err = Decode(vm.Risc0, []byte(`{"Snark":{"journal":[-1]}}`))
+			r.ErrorContains(err, "invalid journal")
+		})
+		t.Run("Stark", func(t *testing.T) {
+			p, err := Decode(vm.Risc0, []byte(`{"Stark":{"inner":{"segments":[]},"journal":{"bytes":[1,255]}}}`))
+			r.NoError(err)
+			r.Equal([]byte(`{"segments":[]}`), p.Seal)
+			r.Equal([]byte{1, 255}, p.PublicInputs)
+
+			_, err = Decode(vm.Risc0, []byte(`{"Stark":{"journal":{"bytes":[1,300]}}}`))
+			r.ErrorContains(err, "element 1 is not a byte")
+			_, err = Decode(vm.Risc0, []byte(`{"Stark":{}}`))
+			r.ErrorIs(err, ErrMissingJournal)
+		})
+	})
+
+	t.Run("Halo2", func(t *testing.T) {
+		p, err := Decode(vm.Halo2, []byte("0x0102"))
+		r.NoError(err)
+		r.Equal([]byte{1, 2}, p.Seal)
+		r.Empty(p.PublicInputs)
+
+		_, err = Decode(vm.Halo2, []byte("any"))
+		r.Error(err)
+		_, err = Decode(vm.Halo2, nil)
+		r.ErrorIs(err, ErrMissingSeal)
+	})
+
+	t.Run("ZKwasm", func(t *testing.T) {
+		p, err := Decode(vm.ZKwasm, []byte(`{"proof":"AQI=","instances":["0x2"],"vk":"Aw=="}`))
+		r.NoError(err)
+		r.Equal([]byte{1, 2}, p.Seal)
+		r.Equal([]byte(`["0x2"]`), p.PublicInputs)
+		r.Equal([]byte{3}, p.VerifierID)
+
+		_, err = Decode(vm.ZKwasm, []byte(`{"instances":[]}`))
+		r.ErrorIs(err, ErrMissingSeal)
+		_, err = Decode(vm.ZKwasm, []byte(`{"proof":"AQI=","vk":"!"}`))
+		r.ErrorContains(err, "vk")
+	})
+
+	t.Run("Wasm", func(t *testing.T) {
+		p, err := Decode(vm.Wasm, []byte("result"))
+		r.NoError(err)
+		r.Equal(&Proof{VMType: vm.Wasm, PublicInputs: []byte("result"), Raw: []byte("result")}, p)
+	})
+}
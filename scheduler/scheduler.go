@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/machinefi/sprout/p2p"
+	"github.com/machinefi/sprout/project"
 	"github.com/machinefi/sprout/utils/contract"
 	"github.com/machinefi/sprout/utils/distance"
 	"github.com/machinefi/sprout/utils/hash"
@@ -19,6 +20,7 @@ import (
 type HandleProjectProvers func(projectID uint64, provers []string)
 
 type scheduler struct {
+	mux                  sync.Mutex
 	provers              *sync.Map // proverID(string) -> Prover(*contract.Prover)
 	projectOffsets       *sync.Map // project offset in interval(uint64) -> Project(*contract.Project)
 	epoch                uint64
@@ -35,34 +37,51 @@ func (s *scheduler) schedule() {
 		if !ok {
 			continue
 		}
-		projectID := cp.(*contract.Project).ID
-		slog.Info("a new epoch has arrived", "head_number", head, "project_id", projectID)
+		p := cp.(*contract.Project)
+		slog.Info("a new epoch has arrived", "head_number", head, "project_id", p.ID)
+		s.scheduleProject(p)
+	}
+}
 
-		provers := s.getAllProver()
+// scheduleProject subscribes the project topic if the project is scheduled to this prover, otherwise drops it
+func (s *scheduler) scheduleProject(p *contract.Project) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
 
-		amount := uint64(1) // TODO fetch amount from project attr
-		if amount > uint64(len(provers)) {
-			slog.Error("no enough resource for the project", "require prover amount", amount, "current prover", len(provers), "project_id", projectID)
-			continue
-		}
+	projectID := p.ID
+	if p.Paused {
+		s.pubSubs.Delete(projectID)
+		slog.Info("the project paused", "project_id", projectID)
+		return
+	}
 
-		projectProvers := distance.GetMinNLocation(provers, projectID, amount)
+	provers := s.getAllProver()
 
-		isMy := false
-		for _, p := range projectProvers {
-			if p == s.proverID {
-				isMy = true
-			}
-		}
-		if !isMy {
-			slog.Info("the project not scheduld to this prover", "project_id", projectID)
-			s.pubSubs.Delete(projectID)
-			continue
+	amount := p.RequestedProverAmount
+	if amount == 0 {
+		amount = 1
+	}
+	if amount > uint64(len(provers)) {
+		slog.Error("no enough resource for the project", "require prover amount", amount, "current prover", len(provers), "project_id", projectID)
+		return
+	}
+
+	projectProvers := distance.GetMinNLocation(provers, projectID, amount)
+
+	isMy := false
+	for _, p := range projectProvers {
+		if p == s.proverID {
+			isMy = true
 		}
-		s.handleProjectProvers(projectID, projectProvers)
-		s.pubSubs.Add(projectID)
-		slog.Info("the project scheduld to this prover", "project_id", projectID)
 	}
+	if !isMy {
+		slog.Info("the project not scheduld to this prover", "project_id", projectID)
+		s.pubSubs.Delete(projectID)
+		return
+	}
+	s.handleProjectProvers(projectID, projectProvers)
+	s.pubSubs.Add(projectID)
+	slog.Info("the project scheduld to this prover", "project_id", projectID)
 }
 
 func (s *scheduler) getAllProver() []string {
@@ -98,7 +117,7 @@ func watchChainHead(head chan<- uint64, chainEndpoint string) error {
 	return nil
 }
 
-func Run(epoch uint64, chainEndpoint, proverContractAddress, projectContractAddress, proverID string, pubSubs *p2p.PubSubs, handleProjectProvers HandleProjectProvers) error {
+func Run(epoch uint64, chainEndpoint, proverContractAddress string, projects project.Registry, proverID string, pubSubs *p2p.PubSubs, handleProjectProvers HandleProjectProvers) error {
 	provers := &sync.Map{}
 	proverCh, err := contract.ListAndWatchProver(chainEndpoint, proverContractAddress)
 	if err != nil {
@@ -117,27 +136,6 @@ func Run(epoch uint64, chainEndpoint, proverContractAddress, projectContractAddr
 		}
 	}()
 
-	projectOffsets := &sync.Map{}
-	projectCh, err := contract.ListAndWatchProject(chainEndpoint, projectContractAddress)
-	if err != nil {
-		return err
-	}
-	go func() {
-		for p := range projectCh {
-			slog.Info("get a new project", "project_id", p.ID)
-			projectIDHash := hash.Sum256Uint64(p.ID)
-			offset := new(big.Int).SetBytes(projectIDHash[:]).Uint64() % epoch
-
-			e, ok := projectOffsets.Load(offset)
-			if ok {
-				if ep := e.(*contract.Project); ep.BlockNumber > p.BlockNumber {
-					p = ep
-				}
-			}
-			projectOffsets.Store(offset, p) // TODO different project may have same offset
-		}
-	}()
-
 	chainHead := make(chan uint64)
 	if err := watchChainHead(chainHead, chainEndpoint); err != nil {
 		return err
@@ -145,13 +143,55 @@ func Run(epoch uint64, chainEndpoint, proverContractAddress, projectContractAddr
 
 	s := &scheduler{
 		provers:              provers,
-		projectOffsets:       projectOffsets,
+		projectOffsets:       &sync.Map{},
 		epoch:                epoch,
 		pubSubs:              pubSubs,
 		chainHead:            chainHead,
 		proverID:             proverID,
 		handleProjectProvers: handleProjectProvers,
 	}
+	go func() {
+		for p := range projects.Watch() {
+			slog.Info("get a new project", "project_id", p.ID)
+			projectIDHash := hash.Sum256Uint64(p.ID)
+			offset := new(big.Int).SetBytes(projectIDHash[:]).Uint64() % epoch
+
+			wasPaused := false
+			e, ok := s.projectOffsets.Load(offset)
+			if ok {
+				ep := e.(*contract.Project)
+				if ep.BlockNumber > p.BlockNumber {
+					p = ep
+				}
+				wasPaused = ep.ID == p.ID && ep.Paused
+			}
+			s.projectOffsets.Store(offset, p) // TODO different project may have same offset
+			// the pause and resume take effect at once instead of waiting for the project epoch
+			if p.Paused || wasPaused {
+				s.scheduleProject(p)
+			}
+		}
+	}()
 	go s.schedule()
 	return nil
 }
+
+// RunLocal schedules all projects to this prover without the prover registrar and chain head, it's used
+// with the local project files
+func RunLocal(projects project.Registry, proverID string, pubSubs *p2p.PubSubs, handleProjectProvers HandleProjectProvers) {
+	go func() {
+		for p := range projects.Watch() {
+			if p.Paused {
+				pubSubs.Delete(p.ID)
+				slog.Info("the local project paused", "project_id", p.ID)
+				continue
+			}
+			handleProjectProvers(p.ID, []string{proverID})
+			if err := pubSubs.Add(p.ID); err != nil {
+				slog.Error("failed to add project topic", "error", err, "project_id", p.ID)
+				continue
+			}
+			slog.Info("the local project scheduld to this prover", "project_id", p.ID)
+		}
+	}()
+}
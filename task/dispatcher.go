@@ -1,21 +1,20 @@
 package task
 
 import (
-	"bytes"
 	"log/slog"
 	"sync"
+	"time"
 
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/pkg/errors"
 
 	"github.com/machinefi/sprout/p2p"
 	"github.com/machinefi/sprout/project"
-	"github.com/machinefi/sprout/project/contracts"
 	internaldispatcher "github.com/machinefi/sprout/task/internal/dispatcher"
 	"github.com/machinefi/sprout/task/internal/handler"
 	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/utils/contract"
+	"github.com/machinefi/sprout/utils/distance"
 )
 
 type Persistence interface {
@@ -32,8 +31,30 @@ type ProjectManager interface {
 	Get(projectID uint64) (*project.Project, error)
 }
 
+// LoadProject fetches the project by the given meta instead of the cached one
+type LoadProject func(pm *project.Meta) (*project.Project, error)
+
+// ProjectState is the dispatching state of a project
+type ProjectState struct {
+	ProjectID             uint64
+	Uri                   string
+	Hash                  [32]byte
+	Paused                bool
+	RequestedProverAmount uint64
+	InflightTasks         int
+}
+
+// GetProjectState returns the dispatching state of the project, error if the project is not dispatched
+type GetProjectState func(projectID uint64) (*ProjectState, error)
+
 type dispatcher struct {
 	projectDispatchers *sync.Map // projectID(uint64) -> *ProjectDispatcher
+	persistence        Persistence
+	newDatasource      internaldispatcher.NewDatasource
+	loadProject        LoadProject
+	pubSubs            *p2p.PubSubs
+	taskStateHandler   *handler.TaskStateHandler
+	provers            *sync.Map // proverID(string) -> *contract.Prover
 }
 
 func (d *dispatcher) handleP2PData(data *p2p.Data, topic *pubsub.Topic) {
@@ -50,56 +71,247 @@ func (d *dispatcher) handleP2PData(data *p2p.Data, topic *pubsub.Topic) {
 	pd.(*internaldispatcher.ProjectDispatcher).Handle(s)
 }
 
-func RunDispatcher(persistence Persistence, newDatasource internaldispatcher.NewDatasource, getProject handler.GetProject, bootNodeMultiaddr, operatorPrivateKey, operatorPrivateKeyED25519, chainEndpoint, projectContractAddress string, iotexChainID int) error {
-	projectDispatchers := &sync.Map{}
-	d := &dispatcher{projectDispatchers: projectDispatchers}
+// projectAddRetryWait is the waiting time before the first retry of a failed project dispatcher add, it doubles
+// on each failure up to maxProjectAddRetryWait
+var (
+	projectAddRetryWait    = 5 * time.Second
+	maxProjectAddRetryWait = 5 * time.Minute
+)
+
+func (d *dispatcher) watchProject(projectCh <-chan *contract.Project) {
+	latest := map[uint64]*contract.Project{}
+	failures := map[uint64]int{}
+	retryCh := make(chan *contract.Project)
+	done := make(chan struct{})
+	defer close(done)
 
-	ps, err := p2p.NewPubSubs(d.handleP2PData, bootNodeMultiaddr, iotexChainID)
-	if err != nil {
-		return err
+	for {
+		var cp *contract.Project
+		select {
+		case p, ok := <-projectCh:
+			if !ok {
+				return
+			}
+			cp = p
+			if latest[cp.ID] != cp {
+				latest[cp.ID] = cp
+				delete(failures, cp.ID)
+			}
+		case p := <-retryCh:
+			// a newer upsert of the project supersedes the retry
+			if latest[p.ID] != p {
+				continue
+			}
+			cp = p
+		}
+
+		pm := &project.Meta{
+			ProjectID: cp.ID,
+			Uri:       cp.Uri,
+			Hash:      cp.Hash,
+		}
+		attr := &project.Attribute{
+			Paused:                cp.Paused,
+			RequestedProverAmount: cp.RequestedProverAmount,
+		}
+
+		v, ok := d.projectDispatchers.Load(cp.ID)
+		if !ok {
+			if err := d.addProjectDispatcher(pm, attr); err != nil {
+				failures[cp.ID]++
+				wait := addRetryWait(failures[cp.ID])
+				slog.Error("failed to add project dispatcher", "error", err, "project_id", cp.ID, "retry_after", wait)
+				time.AfterFunc(wait, func() {
+					select {
+					case retryCh <- cp:
+					case <-done:
+					}
+				})
+				continue
+			}
+			delete(failures, cp.ID)
+			continue
+		}
+
+		pd := v.(*internaldispatcher.ProjectDispatcher)
+		pd.SetAttribute(attr)
+		if !pd.Changed(pm) {
+			continue
+		}
+		if err := d.reloadProjectDispatcher(pd, pm); err != nil {
+			slog.Error("failed to reload project dispatcher", "error", err, "project_id", cp.ID)
+			continue
+		}
+		slog.Info("project dispatcher reloaded", "project_id", cp.ID, "uri", cp.Uri)
 	}
+}
 
-	taskStateHandler := handler.NewTaskStateHandler(persistence.Create, getProject, operatorPrivateKey, operatorPrivateKeyED25519)
+func addRetryWait(failures int) time.Duration {
+	wait := projectAddRetryWait
+	for k := 1; k < failures && wait < maxProjectAddRetryWait; k++ {
+		wait *= 2
+	}
+	return min(wait, maxProjectAddRetryWait)
+}
 
-	client, err := ethclient.Dial(chainEndpoint)
+// addProjectDispatcher subscribes the project topic before the project dispatcher starts, the topic is removed
+// if the dispatcher fails to start
+func (d *dispatcher) addProjectDispatcher(pm *project.Meta, attr *project.Attribute) error {
+	p, err := d.loadProject(pm)
 	if err != nil {
-		return errors.Wrapf(err, "failed to dial chain endpoint %s", chainEndpoint)
+		return errors.Wrap(err, "failed to load project")
 	}
-	instance, err := contracts.NewContracts(common.HexToAddress(projectContractAddress), client)
+	c, err := p.GetDefaultConfig()
 	if err != nil {
-		return errors.Wrapf(err, "failed to new project contract instance")
+		return errors.Wrapf(err, "failed to get project config, project_version %v", p.DefaultVersion)
 	}
+	if err := d.pubSubs.Add(pm.ProjectID); err != nil {
+		return errors.Wrap(err, "failed to add project topic")
+	}
+	pd, err := internaldispatcher.NewProjectDispatcher(d.persistence.FetchProjectProcessedTaskID, d.persistence.UpsertProjectProcessedTask, p.DatasourceURI, d.newDatasource, pm, attr, c.RetryPolicy, d.pubSubs.Publish, d.taskStateHandler)
+	if err != nil {
+		d.pubSubs.Delete(pm.ProjectID)
+		return errors.Wrap(err, "failed to new project dispatcher")
+	}
+	pd.SetBatchSize(batchSize(p))
+	d.projectDispatchers.Store(pm.ProjectID, pd)
+	slog.Info("project dispatcher added", "project_id", pm.ProjectID)
+	return nil
+}
 
-	emptyHash := [32]byte{}
-	for projectID := uint64(1); ; projectID++ {
-		mp, err := instance.Projects(nil, projectID)
-		if err != nil {
-			return errors.Wrapf(err, "failed to get project meta from chain, project_id %v", projectID)
-		}
-		if mp.Uri == "" || bytes.Equal(mp.Hash[:], emptyHash[:]) {
-			break
-		}
-		pm := &project.Meta{
-			ProjectID: projectID,
-			Uri:       mp.Uri,
-			Hash:      mp.Hash,
+func (d *dispatcher) reloadProjectDispatcher(pd *internaldispatcher.ProjectDispatcher, pm *project.Meta) error {
+	p, err := d.loadProject(pm)
+	if err != nil {
+		return errors.Wrap(err, "failed to load project")
+	}
+	c, err := p.GetDefaultConfig()
+	if err != nil {
+		return errors.Wrapf(err, "failed to get project config, project_version %v", p.DefaultVersion)
+	}
+	if err := pd.Reload(pm, p.DatasourceURI, c.RetryPolicy); err != nil {
+		return err
+	}
+	pd.SetBatchSize(batchSize(p))
+	return nil
+}
+
+func (d *dispatcher) projectState(projectID uint64) (*ProjectState, error) {
+	v, ok := d.projectDispatchers.Load(projectID)
+	if !ok {
+		return nil, errors.Errorf("the project not dispatched, project_id %v", projectID)
+	}
+	pd := v.(*internaldispatcher.ProjectDispatcher)
+	pm := pd.Meta()
+	s := &ProjectState{
+		ProjectID:     projectID,
+		Uri:           pm.Uri,
+		Hash:          pm.Hash,
+		Paused:        pd.Paused(),
+		InflightTasks: pd.InflightTasks(),
+	}
+	if attr := pd.Attribute(); attr != nil {
+		s.RequestedProverAmount = attr.RequestedProverAmount
+	}
+	return s, nil
+}
+
+// batchSize returns the max batch size of the outputs of all project versions, as tasks are output by
+// the config of their versions; 0 if no output is batched
+func batchSize(p *project.Project) uint64 {
+	size := uint64(0)
+	for _, c := range p.Versions {
+		for _, o := range c.GetOutputs() {
+			if o.Batch != nil {
+				size = max(size, o.Batch.Size)
+			}
 		}
-		// TODO support project update & watch project upsert
-		_, ok := projectDispatchers.Load(projectID)
+	}
+	return size
+}
+
+// finishTask finishes the task of the project dispatcher after its batch output completed
+func (d *dispatcher) finishTask(projectID, taskID uint64) {
+	v, ok := d.projectDispatchers.Load(projectID)
+	if !ok {
+		slog.Error("failed to get project dispatcher", "project_id", projectID, "task_id", taskID)
+		return
+	}
+	v.(*internaldispatcher.ProjectDispatcher).Finish(taskID)
+}
+
+func (d *dispatcher) watchProver(proverCh <-chan *contract.Prover) {
+	for p := range proverCh {
+		slog.Info("get a new prover", "prover_id", p.ID)
+		e, ok := d.provers.Load(p.ID)
 		if ok {
-			continue
+			if ep := e.(*contract.Prover); ep.BlockNumber > p.BlockNumber {
+				p = ep
+			}
 		}
-		p, err := getProject(projectID)
-		if err != nil {
-			return errors.Wrapf(err, "failed to get project, project_id %v", projectID)
+		d.provers.Store(p.ID, p)
+	}
+}
+
+// validateProver checks the prover is registered, and is one of the provers the scheduler assigns to the project
+func (d *dispatcher) validateProver(projectID uint64, proverID string) error {
+	if _, ok := d.provers.Load(proverID); !ok {
+		return errors.Errorf("prover not registered, prover_id %s", proverID)
+	}
+	provers := []string{}
+	d.provers.Range(func(key, value any) bool {
+		provers = append(provers, key.(string))
+		return true
+	})
+
+	amount := uint64(1)
+	if v, ok := d.projectDispatchers.Load(projectID); ok {
+		if attr := v.(*internaldispatcher.ProjectDispatcher).Attribute(); attr != nil && attr.RequestedProverAmount > 0 {
+			amount = attr.RequestedProverAmount
+		}
+	}
+	// the same as the scheduler, no prover is assigned to the project if there are not enough provers
+	if amount > uint64(len(provers)) {
+		return errors.Errorf("not enough provers for the project, required %d, registered %d", amount, len(provers))
+	}
+
+	for _, p := range distance.GetMinNLocation(provers, projectID, amount) {
+		if p == proverID {
+			return nil
 		}
-		ps.Add(projectID)
-		pd, err := internaldispatcher.NewProjectDispatcher(persistence.FetchProjectProcessedTaskID, persistence.UpsertProjectProcessedTask, p.DatasourceURI, newDatasource, pm, ps.Publish, taskStateHandler)
+	}
+	return errors.Errorf("prover not assigned to the project, prover_id %s", proverID)
+}
+
+// RunDispatcher dispatches the tasks of the projects in the registry, the returned func queries the dispatching
+// state of a project
+func RunDispatcher(persistence Persistence, newDatasource internaldispatcher.NewDatasource, getProject handler.GetProject, loadProject LoadProject, projects project.Registry, bootNodeMultiaddr, operatorPrivateKey, operatorPrivateKeyED25519, chainEndpoint, proverContractAddress string, iotexChainID int) (GetProjectState, error) {
+	d := &dispatcher{
+		projectDispatchers: &sync.Map{},
+		persistence:        persistence,
+		newDatasource:      newDatasource,
+		loadProject:        loadProject,
+	}
+
+	ps, err := p2p.NewPubSubs(d.handleP2PData, bootNodeMultiaddr, iotexChainID)
+	if err != nil {
+		return nil, err
+	}
+	d.pubSubs = ps
+
+	// without prover registrar, only the proof signature is verified
+	var validateProver handler.ValidateProver
+	if proverContractAddress != "" {
+		d.provers = &sync.Map{}
+		proverCh, err := contract.ListAndWatchProver(chainEndpoint, proverContractAddress)
 		if err != nil {
-			return errors.Wrapf(err, "failed to new project dispatcher, project_id %v", projectID)
+			return nil, err
 		}
-		projectDispatchers.Store(projectID, pd)
+		go d.watchProver(proverCh)
+		validateProver = d.validateProver
 	}
+	d.taskStateHandler = handler.NewTaskStateHandler(persistence.Create, getProject, validateProver, d.finishTask, operatorPrivateKey, operatorPrivateKeyED25519)
 
-	return nil
+	go d.watchProject(projects.Watch())
+
+	return d.projectState, nil
 }
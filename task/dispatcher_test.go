@@ -1,7 +1,19 @@
 package task
 
 import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/p2p"
+	"github.com/machinefi/sprout/project"
+	internaldispatcher "github.com/machinefi/sprout/task/internal/dispatcher"
 	"github.com/machinefi/sprout/types"
+	"github.com/machinefi/sprout/utils/contract"
 )
 
 type mockPersistence struct{}
@@ -32,6 +44,135 @@ func (m *mockDatasourceSuccess) Retrieve(nextTaskID uint64) (*types.Task, error)
 	return m.task, nil
 }
 
+func TestDispatcher_ValidateProver(t *testing.T) {
+	r := require.New(t)
+
+	d := &dispatcher{projectDispatchers: &sync.Map{}, provers: &sync.Map{}}
+	d.provers.Store("prover", &contract.Prover{})
+
+	t.Run("NotRegistered", func(t *testing.T) {
+		r.ErrorContains(d.validateProver(1, "other"), "not registered")
+	})
+	t.Run("Assigned", func(t *testing.T) {
+		r.NoError(d.validateProver(1, "prover"))
+	})
+	t.Run("NotEnoughProvers", func(t *testing.T) {
+		p := gomonkey.NewPatches()
+		defer p.Reset()
+
+		d.projectDispatchers.Store(uint64(1), &internaldispatcher.ProjectDispatcher{})
+		defer d.projectDispatchers.Delete(uint64(1))
+		p = p.ApplyMethodReturn(&internaldispatcher.ProjectDispatcher{}, "Attribute", &project.Attribute{RequestedProverAmount: 2})
+
+		r.ErrorContains(d.validateProver(1, "prover"), "not enough provers")
+	})
+}
+
+type testPersistence struct{}
+
+func (p *testPersistence) Create(tl *types.TaskStateLog, t *types.Task) error {
+	return nil
+}
+
+func (p *testPersistence) FetchProjectProcessedTaskID(projectID uint64) (uint64, error) {
+	return 0, nil
+}
+
+func (p *testPersistence) UpsertProjectProcessedTask(projectID, taskID uint64) error {
+	return nil
+}
+
+func TestDispatcher_AddProjectDispatcher(t *testing.T) {
+	r := require.New(t)
+
+	p := gomonkey.NewPatches()
+	defer p.Reset()
+
+	var added, deleted []uint64
+	p = p.ApplyMethod(&p2p.PubSubs{}, "Add", func(_ *p2p.PubSubs, projectID uint64) error {
+		added = append(added, projectID)
+		return nil
+	})
+	p = p.ApplyMethod(&p2p.PubSubs{}, "Delete", func(_ *p2p.PubSubs, projectID uint64) {
+		deleted = append(deleted, projectID)
+	})
+	p = p.ApplyFuncReturn(internaldispatcher.NewProjectDispatcher, nil, errors.New(t.Name()))
+
+	d := &dispatcher{
+		projectDispatchers: &sync.Map{},
+		persistence:        &testPersistence{},
+		pubSubs:            &p2p.PubSubs{},
+		loadProject: func(pm *project.Meta) (*project.Project, error) {
+			return &project.Project{DefaultVersion: "v1", Versions: []*project.Config{{Version: "v1"}}}, nil
+		},
+	}
+	err := d.addProjectDispatcher(&project.Meta{ProjectID: 1}, nil)
+	r.ErrorContains(err, t.Name())
+	// the topic subscribed for the dispatcher is removed
+	r.Equal([]uint64{1}, added)
+	r.Equal([]uint64{1}, deleted)
+	_, ok := d.projectDispatchers.Load(uint64(1))
+	r.False(ok)
+}
+
+func TestDispatcher_WatchProject(t *testing.T) {
+	r := require.New(t)
+
+	wait := projectAddRetryWait
+	projectAddRetryWait = 10 * time.Millisecond
+	defer func() { projectAddRetryWait = wait }()
+
+	p := gomonkey.NewPatches()
+	defer p.Reset()
+
+	var mux sync.Mutex
+	calls := map[[32]byte]int{}
+	d := &dispatcher{projectDispatchers: &sync.Map{}}
+	p = p.ApplyPrivateMethod(d, "addProjectDispatcher", func(_ *dispatcher, pm *project.Meta, attr *project.Attribute) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		calls[pm.Hash]++
+		// the first upsert always fails, the second one succeeds at the third attempt
+		if pm.Hash == [32]byte{1} || calls[pm.Hash] < 3 {
+			return errors.New("any")
+		}
+		d.projectDispatchers.Store(pm.ProjectID, &internaldispatcher.ProjectDispatcher{})
+		return nil
+	})
+	callsOf := func(hash [32]byte) int {
+		mux.Lock()
+		defer mux.Unlock()
+		return calls[hash]
+	}
+
+	projectCh := make(chan *contract.Project)
+	go d.watchProject(projectCh)
+
+	projectCh <- &contract.Project{ID: 1, Hash: [32]byte{1}}
+	r.Eventually(func() bool { return callsOf([32]byte{1}) >= 2 }, time.Second, time.Millisecond)
+
+	// the retries of the first upsert stop once the project is upserted again
+	projectCh <- &contract.Project{ID: 1, Hash: [32]byte{2}}
+	r.Eventually(func() bool {
+		_, ok := d.projectDispatchers.Load(uint64(1))
+		return ok
+	}, time.Second, time.Millisecond)
+	first := callsOf([32]byte{1})
+	time.Sleep(100 * time.Millisecond)
+	r.Equal(first, callsOf([32]byte{1}))
+	r.Equal(3, callsOf([32]byte{2}))
+}
+
+func TestAddRetryWait(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(projectAddRetryWait, addRetryWait(1))
+	r.Equal(2*projectAddRetryWait, addRetryWait(2))
+	r.Equal(4*projectAddRetryWait, addRetryWait(3))
+	r.Equal(maxProjectAddRetryWait, addRetryWait(100))
+}
+
 // func TestNewDispatcher(t *testing.T) {
 // 	r := require.New(t)
 
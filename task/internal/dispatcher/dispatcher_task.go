@@ -13,57 +13,96 @@ import (
 )
 
 type dispatcherTask struct {
-	finished atomic.Bool
-	timeOut  func(s *types.TaskStateLog)
-	cancel   context.CancelFunc
-	waitTime time.Duration
-	task     *types.Task
-	publish  Publish
-	handler  *handler.TaskStateHandler
+	finished    atomic.Bool
+	pending     atomic.Bool // the proof is accepted and waits for a batch output
+	timeOut     func(s *types.TaskStateLog)
+	retried     func(s *types.TaskStateLog)
+	cancel      context.CancelFunc
+	retryPolicy *retryPolicy
+	task        *types.Task
+	publish     Publish
+	handler     *handler.TaskStateHandler
 }
 
+func (t *dispatcherTask) verifyState(s *types.TaskStateLog) bool {
+	return t.handler.Verify(s, t.task)
+}
+
+// handleState handles the prover state of the task; once the proof is pending for a batch output, the task is
+// only finished by the batcher, so the later prover states are dropped
 func (t *dispatcherTask) handleState(s *types.TaskStateLog) {
-	if t.handler.Handle(s, t.task) {
+	if t.pending.Load() {
+		slog.Info("drop state of task pending for output", "project_id", t.task.ProjectID, "task_id", t.task.ID, "prover_id", s.ProverID, "state", s.State)
+		return
+	}
+	finished, pending := t.handler.Handle(s, t.task)
+	if finished {
 		t.cancel()
 		t.finished.Store(true)
 	}
+	if pending {
+		t.cancel()
+		t.pending.Store(true)
+	}
 }
 
 func (t *dispatcherTask) runWatchdog(ctx context.Context) {
-	retryChan := time.After(t.waitTime)
-	timeoutChan := time.After(2 * t.waitTime)
-	for {
+	startTime := time.Now()
+	for attempt := uint64(1); ; attempt++ {
+		waitTime := t.retryPolicy.wait(attempt)
+		if t.retryPolicy.maxTotalTime > 0 {
+			if left := t.retryPolicy.maxTotalTime - time.Since(startTime); waitTime > left {
+				waitTime = left
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			slog.Info("task finished", "project_id", t.task.ProjectID, "task_id", t.task.ID)
 			return
-		case <-retryChan:
-			slog.Info("retry task", "project_id", t.task.ProjectID, "task_id", t.task.ID, "wait_time", t.waitTime)
-			if err := t.publish(t.task.ProjectID, &p2p.Data{Task: t.task}); err != nil {
-				slog.Error("failed to publish p2p data", "project_id", t.task.ProjectID, "task_id", t.task.ID)
-			}
-		case <-timeoutChan:
-			slog.Info("task timeout", "project_id", t.task.ProjectID, "task_id", t.task.ID, "wait_time", 2*t.waitTime)
+		case <-time.After(waitTime):
+		}
+
+		totalWaitTime := time.Since(startTime)
+		if attempt > t.retryPolicy.maxAttempts || (t.retryPolicy.maxTotalTime > 0 && totalWaitTime >= t.retryPolicy.maxTotalTime) {
+			slog.Info("task timeout", "project_id", t.task.ProjectID, "task_id", t.task.ID, "total_wait_time", totalWaitTime)
 			t.timeOut(&types.TaskStateLog{
 				TaskID:    t.task.ID,
+				ProjectID: t.task.ProjectID,
 				State:     types.TaskStateFailed,
-				Comment:   fmt.Sprintf("task timeout, number of retries %v, total waiting time %v", 1, 2*t.waitTime),
+				Comment:   fmt.Sprintf("task timeout, number of retries %v, total waiting time %v", attempt-1, totalWaitTime),
 				CreatedAt: time.Now(),
 			})
+			return
+		}
+
+		slog.Info("retry task", "project_id", t.task.ProjectID, "task_id", t.task.ID, "attempt", attempt, "wait_time", waitTime)
+		comment := fmt.Sprintf("retry %v of %v, waiting time %v", attempt, t.retryPolicy.maxAttempts, waitTime)
+		if err := t.publish(t.task.ProjectID, &p2p.Data{Task: t.task}); err != nil {
+			slog.Error("failed to publish p2p data", "project_id", t.task.ProjectID, "task_id", t.task.ID)
+			comment += ", failed to publish: " + err.Error()
 		}
+		t.retried(&types.TaskStateLog{
+			TaskID:    t.task.ID,
+			ProjectID: t.task.ProjectID,
+			State:     types.TaskStateRetried,
+			Comment:   comment,
+			CreatedAt: time.Now(),
+		})
 	}
 }
 
-func newDispatcherTask(task *types.Task, timeOut func(s *types.TaskStateLog), publish Publish, handler *handler.TaskStateHandler) *dispatcherTask {
+func newDispatcherTask(task *types.Task, retryPolicy *retryPolicy, timeOut, retried func(s *types.TaskStateLog), publish Publish, handler *handler.TaskStateHandler) *dispatcherTask {
 	ctx, cancel := context.WithCancel(context.Background())
 	t := &dispatcherTask{
-		finished: atomic.Bool{},
-		timeOut:  timeOut,
-		cancel:   cancel,
-		waitTime: 5 * time.Minute, // TODO define wait time config
-		task:     task,
-		publish:  publish,
-		handler:  handler,
+		finished:    atomic.Bool{},
+		timeOut:     timeOut,
+		retried:     retried,
+		cancel:      cancel,
+		retryPolicy: retryPolicy,
+		task:        task,
+		publish:     publish,
+		handler:     handler,
 	}
 	go t.runWatchdog(ctx)
 	return t
@@ -0,0 +1,148 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/p2p"
+	"github.com/machinefi/sprout/task/internal/handler"
+	"github.com/machinefi/sprout/types"
+)
+
+type watchdogRecord struct {
+	retried  []*types.TaskStateLog
+	timeout  chan *types.TaskStateLog
+	publish  []time.Time
+	startAt  time.Time
+	finished chan struct{}
+}
+
+func runTestWatchdog(ctx context.Context, policy *retryPolicy, publishErr error) *watchdogRecord {
+	rec := &watchdogRecord{
+		timeout:  make(chan *types.TaskStateLog, 1),
+		startAt:  time.Now(),
+		finished: make(chan struct{}),
+	}
+	t := &dispatcherTask{
+		task:        &types.Task{ID: 1, ProjectID: 1},
+		retryPolicy: policy,
+		timeOut:     func(s *types.TaskStateLog) { rec.timeout <- s },
+		retried:     func(s *types.TaskStateLog) { rec.retried = append(rec.retried, s) },
+		publish: func(projectID uint64, d *p2p.Data) error {
+			rec.publish = append(rec.publish, time.Now())
+			return publishErr
+		},
+	}
+	go func() {
+		defer close(rec.finished)
+		t.runWatchdog(ctx)
+	}()
+	return rec
+}
+
+func TestDispatcherTask_runWatchdog(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("MaxAttempts", func(t *testing.T) {
+		policy := &retryPolicy{maxAttempts: 3, initialWait: 20 * time.Millisecond, backoffMultiplier: 2}
+		rec := runTestWatchdog(context.Background(), policy, nil)
+
+		select {
+		case s := <-rec.timeout:
+			r.Equal(types.TaskStateFailed, s.State)
+			r.Contains(s.Comment, "number of retries 3")
+		case <-time.After(5 * time.Second):
+			r.FailNow("task not timeout")
+		}
+		<-rec.finished
+
+		r.Len(rec.retried, 3)
+		for k, s := range rec.retried {
+			r.Equal(types.TaskStateRetried, s.State)
+			r.Equal(uint64(1), s.TaskID)
+			r.Contains(s.Comment, fmt.Sprintf("retry %d of 3, waiting time %v", k+1, policy.wait(uint64(k+1))))
+		}
+
+		// the waiting time doubles on each attempt
+		r.Len(rec.publish, 3)
+		prev := rec.startAt
+		for k, at := range rec.publish {
+			r.GreaterOrEqual(at.Sub(prev), policy.wait(uint64(k+1)))
+			prev = at
+		}
+	})
+
+	t.Run("MaxTotalTime", func(t *testing.T) {
+		policy := &retryPolicy{
+			maxAttempts:       100,
+			initialWait:       20 * time.Millisecond,
+			backoffMultiplier: 1,
+			maxTotalTime:      100 * time.Millisecond,
+		}
+		rec := runTestWatchdog(context.Background(), policy, nil)
+
+		select {
+		case s := <-rec.timeout:
+			r.Equal(types.TaskStateFailed, s.State)
+			r.GreaterOrEqual(time.Since(rec.startAt), policy.maxTotalTime)
+		case <-time.After(5 * time.Second):
+			r.FailNow("task not timeout")
+		}
+		<-rec.finished
+		r.NotEmpty(rec.retried)
+		r.Less(len(rec.retried), 5)
+	})
+
+	t.Run("FailedToPublish", func(t *testing.T) {
+		policy := &retryPolicy{maxAttempts: 1, initialWait: 10 * time.Millisecond, backoffMultiplier: 1}
+		rec := runTestWatchdog(context.Background(), policy, errors.New(t.Name()))
+
+		<-rec.timeout
+		<-rec.finished
+		r.Len(rec.retried, 1)
+		r.Contains(rec.retried[0].Comment, "failed to publish: "+t.Name())
+	})
+
+	t.Run("Finished", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := &retryPolicy{maxAttempts: 1, initialWait: time.Hour, backoffMultiplier: 1}
+		rec := runTestWatchdog(ctx, policy, nil)
+
+		cancel()
+		select {
+		case <-rec.finished:
+		case <-time.After(5 * time.Second):
+			r.FailNow("watchdog not stopped")
+		}
+		r.Empty(rec.timeout)
+		r.Empty(rec.retried)
+	})
+}
+
+func TestDispatcherTask_handleState(t *testing.T) {
+	r := require.New(t)
+
+	saved := []*types.TaskStateLog{}
+	h := handler.NewTaskStateHandler(func(s *types.TaskStateLog, _ *types.Task) error {
+		saved = append(saved, s)
+		return nil
+	}, nil, nil, nil, "", "")
+	dt := &dispatcherTask{task: &types.Task{ID: 1, ProjectID: 1}, handler: h, cancel: func() {}}
+	dt.pending.Store(true)
+
+	for _, state := range []types.TaskState{types.TaskStateDispatched, types.TaskStateProved, types.TaskStateFailed} {
+		dt.handleState(&types.TaskStateLog{TaskID: 1, ProjectID: 1, State: state, ProverID: "prover"})
+	}
+	r.Empty(saved)
+	r.False(dt.finished.Load())
+
+	dt.pending.Store(false)
+	dt.handleState(&types.TaskStateLog{TaskID: 1, ProjectID: 1, State: types.TaskStateFailed, ProverID: "prover"})
+	r.Len(saved, 1)
+	r.True(dt.finished.Load())
+}
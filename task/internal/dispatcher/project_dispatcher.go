@@ -1,7 +1,9 @@
 package dispatcher
 
 import (
+	"bytes"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/machinefi/sprout/datasource"
@@ -21,21 +23,131 @@ type FetchProcessedTaskID func(projectID uint64) (uint64, error)
 type UpsertProcessedTask func(projectID, taskID uint64) error
 
 type ProjectDispatcher struct {
-	window       *window
-	waitInterval time.Duration
-	startTaskID  uint64
-	projectID    uint64
-	datasource   datasource.Datasource
-	publish      Publish
+	mux           sync.RWMutex
+	window        *window
+	waitInterval  time.Duration
+	startTaskID   uint64
+	projectID     uint64
+	projectMeta   *project.Meta
+	attr          *project.Attribute
+	batchSize     uint64
+	datasourceURI string
+	datasource    datasource.Datasource
+	newDatasource NewDatasource
+	publish       Publish
 }
 
 func (d *ProjectDispatcher) Handle(s *types.TaskStateLog) {
 	d.window.consume(s)
 }
 
+// Finish marks the task finished after its batch output completed
+func (d *ProjectDispatcher) Finish(taskID uint64) {
+	d.window.finish(taskID)
+}
+
+// SetAttribute applies the latest project attribute, the window size follows the requested prover amount,
+// and no task is retrieved from the datasource while the project is paused
+func (d *ProjectDispatcher) SetAttribute(attr *project.Attribute) {
+	d.mux.Lock()
+	if paused := attr != nil && attr.Paused; paused != (d.attr != nil && d.attr.Paused) {
+		if paused {
+			slog.Info("project paused, stop dispatching new tasks", "project_id", d.projectID)
+		} else {
+			slog.Info("project resumed", "project_id", d.projectID)
+		}
+	}
+	d.attr = attr
+	size := windowSize(attr, d.batchSize)
+	d.mux.Unlock()
+
+	d.window.setSize(size)
+}
+
+// SetBatchSize enlarges the window to hold a full batch of the project output, 0 means no batch
+func (d *ProjectDispatcher) SetBatchSize(batchSize uint64) {
+	d.mux.Lock()
+	d.batchSize = batchSize
+	size := windowSize(d.attr, batchSize)
+	d.mux.Unlock()
+
+	d.window.setSize(size)
+}
+
+// Attribute returns the latest project attribute, nil if the project has none
+func (d *ProjectDispatcher) Attribute() *project.Attribute {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	return d.attr
+}
+
+// Paused reports whether the project is paused, in-flight tasks of the window are still processed
+func (d *ProjectDispatcher) Paused() bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	return d.attr != nil && d.attr.Paused
+}
+
+// Meta returns the project meta the dispatcher is running with
+func (d *ProjectDispatcher) Meta() *project.Meta {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	return d.projectMeta
+}
+
+// InflightTasks returns the amount of the tasks in the window
+func (d *ProjectDispatcher) InflightTasks() int {
+	return d.window.inflight()
+}
+
+// Changed reports whether the project meta differs from the one the dispatcher is running with
+func (d *ProjectDispatcher) Changed(projectMeta *project.Meta) bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	return d.projectMeta.Uri != projectMeta.Uri || !bytes.Equal(d.projectMeta.Hash[:], projectMeta.Hash[:])
+}
+
+// Reload applies the config of an updated project, in-flight tasks of the window are kept
+func (d *ProjectDispatcher) Reload(projectMeta *project.Meta, datasourceURI string, projectRetryPolicy *project.RetryPolicy) error {
+	retryPolicy, err := newRetryPolicy(projectRetryPolicy)
+	if err != nil {
+		return errors.Wrap(err, "failed to new retry policy")
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if datasourceURI != d.datasourceURI {
+		ds, err := d.newDatasource(datasourceURI)
+		if err != nil {
+			return errors.Wrap(err, "failed to new task retriever")
+		}
+		d.datasource = ds
+		d.datasourceURI = datasourceURI
+	}
+	d.window.setRetryPolicy(retryPolicy)
+	d.projectMeta = projectMeta
+	return nil
+}
+
+func (d *ProjectDispatcher) getDatasource() datasource.Datasource {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	return d.datasource
+}
+
 func (d *ProjectDispatcher) run() {
 	nextTaskID := d.startTaskID
 	for {
+		if d.Paused() {
+			time.Sleep(d.waitInterval)
+			continue
+		}
 		next, err := d.dispatch(nextTaskID)
 		if err != nil {
 			slog.Error("failed to dispatch task", "error", err, "project_id", d.projectID)
@@ -49,7 +161,7 @@ func (d *ProjectDispatcher) run() {
 }
 
 func (d *ProjectDispatcher) dispatch(nextTaskID uint64) (uint64, error) {
-	t, err := d.datasource.Retrieve(d.projectID, nextTaskID)
+	t, err := d.getDatasource().Retrieve(d.projectID, nextTaskID)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to retrieve task from data source")
 	}
@@ -65,7 +177,7 @@ func (d *ProjectDispatcher) dispatch(nextTaskID uint64) (uint64, error) {
 	return t.ID + 1, nil
 }
 
-func NewProjectDispatcher(fetch FetchProcessedTaskID, upsert UpsertProcessedTask, datasourceURI string, newDatasource NewDatasource, projectMeta *project.Meta, publish Publish, handler *handler.TaskStateHandler) (*ProjectDispatcher, error) {
+func NewProjectDispatcher(fetch FetchProcessedTaskID, upsert UpsertProcessedTask, datasourceURI string, newDatasource NewDatasource, projectMeta *project.Meta, attr *project.Attribute, projectRetryPolicy *project.RetryPolicy, publish Publish, handler *handler.TaskStateHandler) (*ProjectDispatcher, error) {
 	processedTaskID, err := fetch(projectMeta.ProjectID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to fetch next task_id, project_id %v", projectMeta.ProjectID)
@@ -74,20 +186,31 @@ func NewProjectDispatcher(fetch FetchProcessedTaskID, upsert UpsertProcessedTask
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to new task retriever")
 	}
-	// TODO get prover amount from project attr
-	//windowSize := projectMeta.ProverAmount
-	//if windowSize == 0 {
-	windowSize := uint64(1)
-	//}
-	window := newWindow(windowSize, publish, handler, upsert)
+	retryPolicy, err := newRetryPolicy(projectRetryPolicy)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to new retry policy")
+	}
+	window := newWindow(windowSize(attr, 0), retryPolicy, publish, handler, upsert)
 	d := &ProjectDispatcher{
-		window:       window,
-		waitInterval: 3 * time.Second,
-		startTaskID:  processedTaskID + 1,
-		datasource:   datasource,
-		projectID:    projectMeta.ProjectID,
-		publish:      publish,
+		window:        window,
+		waitInterval:  3 * time.Second,
+		startTaskID:   processedTaskID + 1,
+		projectID:     projectMeta.ProjectID,
+		projectMeta:   projectMeta,
+		attr:          attr,
+		datasourceURI: datasourceURI,
+		datasource:    datasource,
+		newDatasource: newDatasource,
+		publish:       publish,
 	}
 	go d.run()
 	return d, nil
 }
+
+func windowSize(attr *project.Attribute, batchSize uint64) uint64 {
+	size := uint64(1)
+	if attr != nil && attr.RequestedProverAmount > 0 {
+		size = attr.RequestedProverAmount
+	}
+	return max(size, batchSize)
+}
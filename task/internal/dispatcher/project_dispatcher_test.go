@@ -0,0 +1,108 @@
+package dispatcher
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/datasource"
+	"github.com/machinefi/sprout/project"
+	"github.com/machinefi/sprout/types"
+)
+
+type testDatasource struct {
+	uri string
+}
+
+func (d *testDatasource) Retrieve(projectID, nextTaskID uint64) (*types.Task, error) {
+	return nil, nil
+}
+
+func TestProjectDispatcher_Reload(t *testing.T) {
+	r := require.New(t)
+
+	pm := &project.Meta{ProjectID: 1, Uri: "uri", Hash: [32]byte{1}}
+	d := &ProjectDispatcher{
+		window:        newWindow(1, defaultRetryPolicy, nil, nil, nil),
+		projectID:     1,
+		projectMeta:   pm,
+		datasourceURI: "datasource",
+		datasource:    &testDatasource{uri: "datasource"},
+		newDatasource: func(uri string) (datasource.Datasource, error) {
+			if uri == "invalid" {
+				return nil, errors.New(uri)
+			}
+			return &testDatasource{uri: uri}, nil
+		},
+	}
+	inflight := &dispatcherTask{task: &types.Task{ID: 1, ProjectID: 1}}
+	d.window.enQueue(inflight)
+
+	t.Run("Changed", func(t *testing.T) {
+		r.False(d.Changed(&project.Meta{ProjectID: 1, Uri: "uri", Hash: [32]byte{1}}))
+		r.True(d.Changed(&project.Meta{ProjectID: 1, Uri: "uri", Hash: [32]byte{2}}))
+		r.True(d.Changed(&project.Meta{ProjectID: 1, Uri: "uri2", Hash: [32]byte{1}}))
+	})
+
+	npm := &project.Meta{ProjectID: 1, Uri: "uri2", Hash: [32]byte{2}}
+
+	t.Run("InvalidRetryPolicy", func(t *testing.T) {
+		r.Error(d.Reload(npm, "datasource", &project.RetryPolicy{InitialWait: "any"}))
+		r.True(d.Changed(npm))
+	})
+
+	t.Run("FailedToNewDatasource", func(t *testing.T) {
+		r.ErrorContains(d.Reload(npm, "invalid", nil), "invalid")
+		r.True(d.Changed(npm))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		r.NoError(d.Reload(npm, "datasource2", &project.RetryPolicy{MaxAttempts: 3}))
+		r.False(d.Changed(npm))
+		r.Equal("datasource2", d.getDatasource().(*testDatasource).uri)
+		r.Equal(uint64(3), d.window.retryPolicy.maxAttempts)
+		r.Equal(inflight, d.window.getTask(1))
+	})
+}
+
+type countingDatasource struct {
+	retrieved atomic.Int32
+}
+
+func (d *countingDatasource) Retrieve(projectID, nextTaskID uint64) (*types.Task, error) {
+	d.retrieved.Add(1)
+	return nil, nil
+}
+
+func TestProjectDispatcher_Pause(t *testing.T) {
+	r := require.New(t)
+
+	ds := &countingDatasource{}
+	d := &ProjectDispatcher{
+		window:       newWindow(1, defaultRetryPolicy, nil, nil, nil),
+		waitInterval: time.Millisecond,
+		projectID:    1,
+		projectMeta:  &project.Meta{ProjectID: 1},
+		attr:         &project.Attribute{Paused: true},
+		datasource:   ds,
+	}
+	inflight := &dispatcherTask{task: &types.Task{ID: 1, ProjectID: 1}}
+	d.window.enQueue(inflight)
+	go d.run()
+
+	t.Run("Paused", func(t *testing.T) {
+		time.Sleep(20 * time.Millisecond)
+		r.True(d.Paused())
+		r.Zero(ds.retrieved.Load())
+		r.Equal(1, d.InflightTasks())
+	})
+	t.Run("Resumed", func(t *testing.T) {
+		d.SetAttribute(&project.Attribute{})
+		r.False(d.Paused())
+		r.Eventually(func() bool { return ds.retrieved.Load() > 0 }, time.Second, time.Millisecond)
+		r.Equal(inflight, d.window.getTask(1))
+	})
+}
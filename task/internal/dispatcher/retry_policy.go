@@ -0,0 +1,68 @@
+package dispatcher
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/machinefi/sprout/project"
+)
+
+var defaultRetryPolicy = &retryPolicy{
+	maxAttempts:       1,
+	initialWait:       5 * time.Minute,
+	backoffMultiplier: 1,
+}
+
+type retryPolicy struct {
+	maxAttempts       uint64
+	initialWait       time.Duration
+	backoffMultiplier float64
+	jitter            float64
+	maxTotalTime      time.Duration // zero means no limit
+}
+
+// wait returns the waiting time before the attempt-th retry, attempt starts from 1
+func (p *retryPolicy) wait(attempt uint64) time.Duration {
+	w := float64(p.initialWait) * math.Pow(p.backoffMultiplier, float64(attempt-1))
+	if p.jitter > 0 {
+		w += w * p.jitter * (2*rand.Float64() - 1)
+	}
+	if w > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(w)
+}
+
+func newRetryPolicy(c *project.RetryPolicy) (*retryPolicy, error) {
+	if c == nil {
+		return defaultRetryPolicy, nil
+	}
+	initialWait, err := c.GetInitialWait()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse retry initial wait")
+	}
+	maxTotalTime, err := c.GetMaxTotalTime()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse retry max total time")
+	}
+	p := &retryPolicy{
+		maxAttempts:       c.MaxAttempts,
+		initialWait:       initialWait,
+		backoffMultiplier: c.BackoffMultiplier,
+		jitter:            c.Jitter,
+		maxTotalTime:      maxTotalTime,
+	}
+	if p.maxAttempts == 0 {
+		p.maxAttempts = defaultRetryPolicy.maxAttempts
+	}
+	if p.initialWait == 0 {
+		p.initialWait = defaultRetryPolicy.initialWait
+	}
+	if p.backoffMultiplier == 0 {
+		p.backoffMultiplier = defaultRetryPolicy.backoffMultiplier
+	}
+	return p, nil
+}
@@ -0,0 +1,65 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/project"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("Default", func(t *testing.T) {
+		p, err := newRetryPolicy(nil)
+		r.NoError(err)
+		r.Equal(defaultRetryPolicy, p)
+	})
+	t.Run("InvalidInitialWait", func(t *testing.T) {
+		_, err := newRetryPolicy(&project.RetryPolicy{InitialWait: "any"})
+		r.Error(err)
+	})
+	t.Run("InvalidMaxTotalTime", func(t *testing.T) {
+		_, err := newRetryPolicy(&project.RetryPolicy{MaxTotalTime: "any"})
+		r.Error(err)
+	})
+	t.Run("FillDefault", func(t *testing.T) {
+		p, err := newRetryPolicy(&project.RetryPolicy{MaxAttempts: 3, MaxTotalTime: "1h"})
+		r.NoError(err)
+		r.Equal(uint64(3), p.maxAttempts)
+		r.Equal(defaultRetryPolicy.initialWait, p.initialWait)
+		r.Equal(defaultRetryPolicy.backoffMultiplier, p.backoffMultiplier)
+		r.Equal(time.Hour, p.maxTotalTime)
+	})
+	t.Run("FillDefaultMaxAttempts", func(t *testing.T) {
+		p, err := newRetryPolicy(&project.RetryPolicy{InitialWait: "1m"})
+		r.NoError(err)
+		r.Equal(defaultRetryPolicy.maxAttempts, p.maxAttempts)
+		r.Equal(time.Minute, p.initialWait)
+	})
+}
+
+func TestRetryPolicy_Wait(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("Backoff", func(t *testing.T) {
+		p := &retryPolicy{initialWait: time.Second, backoffMultiplier: 2}
+		r.Equal(time.Second, p.wait(1))
+		r.Equal(2*time.Second, p.wait(2))
+		r.Equal(8*time.Second, p.wait(4))
+	})
+	t.Run("Jitter", func(t *testing.T) {
+		p := &retryPolicy{initialWait: time.Second, backoffMultiplier: 1, jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			w := p.wait(1)
+			r.GreaterOrEqual(w, 500*time.Millisecond)
+			r.LessOrEqual(w, 1500*time.Millisecond)
+		}
+	})
+	t.Run("Overflow", func(t *testing.T) {
+		p := &retryPolicy{initialWait: time.Hour, backoffMultiplier: 10}
+		r.Positive(p.wait(100))
+	})
+}
@@ -9,16 +9,26 @@ import (
 )
 
 type window struct {
-	cond    *sync.Cond
-	front   int
-	rear    int
-	tasks   []*dispatcherTask
-	publish Publish
-	handler *handler.TaskStateHandler
-	upsert  UpsertProcessedTask
+	cond        *sync.Cond
+	size        uint64
+	tasks       []*dispatcherTask // in task id order, tasks[0] is the front
+	retryPolicy *retryPolicy
+	publish     Publish
+	handler     *handler.TaskStateHandler
+	upsert      UpsertProcessedTask
 }
 
+// consume handles the state log reported by provers, it's dropped if the verification failed
 func (w *window) consume(s *types.TaskStateLog) {
+	w.handle(s, true)
+}
+
+// record handles the state log generated by the watchdog of task
+func (w *window) record(s *types.TaskStateLog) {
+	w.handle(s, false)
+}
+
+func (w *window) handle(s *types.TaskStateLog, verify bool) {
 	w.cond.L.Lock()
 	defer w.cond.Broadcast()
 	defer w.cond.L.Unlock()
@@ -28,25 +38,75 @@ func (w *window) consume(s *types.TaskStateLog) {
 		slog.Error("failed to get task in processing window", "task_id", s.TaskID)
 		return
 	}
+	if verify && !t.verifyState(s) {
+		return
+	}
 	t.handleState(s)
 	w.deQueue()
 }
 
+// finish marks the task finished, it's called once the output of a pending task completed
+func (w *window) finish(taskID uint64) {
+	w.cond.L.Lock()
+	defer w.cond.Broadcast()
+	defer w.cond.L.Unlock()
+
+	t := w.getTask(taskID)
+	if t == nil {
+		slog.Error("failed to get task in processing window", "task_id", taskID)
+		return
+	}
+	t.finished.Store(true)
+	w.deQueue()
+}
+
 func (w *window) produce(t *types.Task) {
 	w.cond.L.Lock()
 	for w.isFull() {
 		w.cond.Wait()
 	}
 
-	dt := newDispatcherTask(t, w.consume, w.publish, w.handler)
+	dt := newDispatcherTask(t, w.retryPolicy, w.record, w.record, w.publish, w.handler)
 	w.enQueue(dt)
 
 	w.cond.L.Unlock()
 }
 
+// setSize resizes the window; if the window shrinks, in-flight tasks are kept and
+// new tasks will be blocked until the amount of in-flight tasks is below the new size
+func (w *window) setSize(size uint64) {
+	if size == 0 {
+		size = 1
+	}
+	w.cond.L.Lock()
+	defer w.cond.Broadcast()
+	defer w.cond.L.Unlock()
+
+	if w.size != size {
+		slog.Info("resize processing window", "old_size", w.size, "new_size", size)
+	}
+	w.size = size
+}
+
+// setRetryPolicy changes the retry policy of the tasks produced later
+func (w *window) setRetryPolicy(p *retryPolicy) {
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
+
+	w.retryPolicy = p
+}
+
+// inflight returns the amount of the tasks not dequeued
+func (w *window) inflight() int {
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
+
+	return len(w.tasks)
+}
+
 func (w *window) getTask(taskID uint64) *dispatcherTask {
 	for _, t := range w.tasks {
-		if t != nil && t.task.ID == taskID {
+		if t.task.ID == taskID {
 			return t
 		}
 	}
@@ -54,14 +114,14 @@ func (w *window) getTask(taskID uint64) *dispatcherTask {
 }
 
 func (w *window) enQueue(value *dispatcherTask) {
-	w.tasks[w.rear] = value
-	w.rear = (w.rear + 1) % len(w.tasks)
+	w.tasks = append(w.tasks, value)
 }
 
 func (w *window) deQueue() {
 	for !w.isEmpty() {
-		if t := w.tasks[w.front]; t.finished.Load() {
-			w.front = (w.front + 1) % len(w.tasks)
+		if t := w.tasks[0]; t.finished.Load() {
+			w.tasks[0] = nil
+			w.tasks = w.tasks[1:]
 			if err := w.upsert(t.task.ProjectID, t.task.ID); err != nil {
 				slog.Error("failed to upsert processed task", "project_id", t.task.ProjectID, "task_id", t.task.ID)
 			}
@@ -72,19 +132,24 @@ func (w *window) deQueue() {
 }
 
 func (w *window) isEmpty() bool {
-	return w.rear == w.front
+	return len(w.tasks) == 0
 }
 
 func (w *window) isFull() bool {
-	return (w.rear+1)%len(w.tasks) == w.front
+	return uint64(len(w.tasks)) >= w.size
 }
 
-func newWindow(size uint64, publish Publish, handler *handler.TaskStateHandler, upsert UpsertProcessedTask) *window {
+func newWindow(size uint64, retryPolicy *retryPolicy, publish Publish, handler *handler.TaskStateHandler, upsert UpsertProcessedTask) *window {
+	if size == 0 {
+		size = 1
+	}
 	return &window{
-		cond:    sync.NewCond(&sync.Mutex{}),
-		tasks:   make([]*dispatcherTask, size+1),
-		publish: publish,
-		handler: handler,
-		upsert:  upsert,
+		cond:        sync.NewCond(&sync.Mutex{}),
+		size:        size,
+		tasks:       make([]*dispatcherTask, 0, size),
+		retryPolicy: retryPolicy,
+		publish:     publish,
+		handler:     handler,
+		upsert:      upsert,
 	}
 }
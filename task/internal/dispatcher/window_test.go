@@ -0,0 +1,70 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/types"
+)
+
+func TestWindow(t *testing.T) {
+	r := require.New(t)
+
+	upserted := []uint64{}
+	w := newWindow(2, defaultRetryPolicy, nil, nil, func(projectID, taskID uint64) error {
+		upserted = append(upserted, taskID)
+		return nil
+	})
+	newTask := func(id uint64) *dispatcherTask {
+		return &dispatcherTask{task: &types.Task{ID: id, ProjectID: 1}}
+	}
+
+	t1, t2, t3 := newTask(1), newTask(2), newTask(3)
+	w.enQueue(t1)
+	r.False(w.isFull())
+	w.enQueue(t2)
+	r.True(w.isFull())
+
+	t.Run("Resize", func(t *testing.T) {
+		w.setSize(3)
+		r.False(w.isFull())
+		w.enQueue(t3)
+		r.True(w.isFull())
+
+		w.setSize(1)
+		r.True(w.isFull())
+		r.Equal(t2, w.getTask(2))
+	})
+
+	t.Run("DeQueueInOrder", func(t *testing.T) {
+		t2.finished.Store(true)
+		w.deQueue()
+		r.Empty(upserted)
+
+		t1.finished.Store(true)
+		w.deQueue()
+		r.Equal([]uint64{1, 2}, upserted)
+		r.Nil(w.getTask(1))
+		r.True(w.isFull())
+
+		t3.finished.Store(true)
+		w.deQueue()
+		r.True(w.isEmpty())
+		r.False(w.isFull())
+	})
+
+	t.Run("Finish", func(t *testing.T) {
+		t4 := newTask(4)
+		t4.pending.Store(true)
+		w.enQueue(t4)
+
+		w.finish(5)
+		r.False(w.isEmpty())
+
+		w.finish(4)
+		r.True(t4.finished.Load())
+		r.True(w.isEmpty())
+		r.Equal([]uint64{1, 2, 3, 4}, upserted)
+	})
+}
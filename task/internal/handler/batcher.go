@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/machinefi/sprout/output"
+	"github.com/machinefi/sprout/types"
+)
+
+type batchItem struct {
+	task  *types.Task
+	proof []byte
+	job   *outputJob
+	index int // index of the output in project config
+}
+
+// batcherKey identifies the batcher of an output of project version
+type batcherKey struct {
+	projectID uint64
+	version   string
+	index     int
+}
+
+type flushBatch func(conf *output.Config, o output.BatchOutput, items []*batchItem)
+
+// batcher accumulates the proofs of a project, they are flushed together once the batch is full or the window expires
+type batcher struct {
+	mux    sync.Mutex
+	conf   output.Config // the output config the batcher is created with
+	output output.BatchOutput
+	size   int
+	window time.Duration
+	items  []*batchItem
+	timer  *time.Timer
+	gen    uint64 // increased on each flush, so that the timer of a flushed batch is ignored
+	flush  flushBatch
+}
+
+func (b *batcher) add(item *batchItem) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.items = append(b.items, item)
+	if len(b.items) == 1 {
+		gen := b.gen
+		b.timer = time.AfterFunc(b.window, func() { b.expire(gen) })
+	}
+	if len(b.items) >= b.size {
+		go b.flush(&b.conf, b.output, b.take())
+	}
+}
+
+func (b *batcher) expire(gen uint64) {
+	b.mux.Lock()
+	if gen != b.gen {
+		b.mux.Unlock()
+		return
+	}
+	items := b.take()
+	b.mux.Unlock()
+
+	if len(items) > 0 {
+		b.flush(&b.conf, b.output, items)
+	}
+}
+
+// drain flushes the accumulated proofs at once, it's used when the batcher is replaced
+func (b *batcher) drain() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if len(b.items) > 0 {
+		go b.flush(&b.conf, b.output, b.take())
+	}
+}
+
+func (b *batcher) take() []*batchItem {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.gen++
+	items := b.items
+	b.items = nil
+	return items
+}
+
+func newBatcher(conf *output.Config, o output.BatchOutput, flush flushBatch) (*batcher, error) {
+	window, err := conf.Batch.GetWindow()
+	if err != nil {
+		return nil, err
+	}
+	return &batcher{
+		conf:   *conf,
+		output: o,
+		size:   int(conf.Batch.Size),
+		window: window,
+		flush:  flush,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/output"
+	"github.com/machinefi/sprout/types"
+)
+
+func TestBatcher(t *testing.T) {
+	r := require.New(t)
+
+	newTestBatcher := func(size uint64, window string) (*batcher, chan []*batchItem) {
+		flushed := make(chan []*batchItem, 10)
+		b, err := newBatcher(&output.Config{Batch: &output.BatchConfig{Size: size, Window: window}}, nil, func(_ *output.Config, _ output.BatchOutput, items []*batchItem) {
+			flushed <- items
+		})
+		r.NoError(err)
+		return b, flushed
+	}
+	item := func(id uint64) *batchItem {
+		return &batchItem{task: &types.Task{ID: id}}
+	}
+
+	t.Run("InvalidWindow", func(t *testing.T) {
+		_, err := newBatcher(&output.Config{Batch: &output.BatchConfig{Size: 1, Window: "any"}}, nil, nil)
+		r.Error(err)
+	})
+	t.Run("FlushFullBatch", func(t *testing.T) {
+		b, flushed := newTestBatcher(2, "1h")
+		b.add(item(1))
+		b.add(item(2))
+		b.add(item(3))
+
+		items := <-flushed
+		r.Len(items, 2)
+		r.Equal(uint64(1), items[0].task.ID)
+		r.Len(b.items, 1)
+	})
+	t.Run("FlushExpiredBatch", func(t *testing.T) {
+		b, flushed := newTestBatcher(10, "10ms")
+		b.add(item(1))
+
+		select {
+		case items := <-flushed:
+			r.Len(items, 1)
+		case <-time.After(time.Second):
+			r.Fail("batch not flushed after window")
+		}
+	})
+	t.Run("IgnoreTimerOfFlushedBatch", func(t *testing.T) {
+		b, flushed := newTestBatcher(1, "1h")
+		b.add(item(1))
+		<-flushed
+
+		b.expire(0)
+		r.Empty(flushed)
+	})
+	t.Run("Drain", func(t *testing.T) {
+		b, flushed := newTestBatcher(10, "1h")
+		b.drain()
+		r.Empty(flushed)
+
+		b.add(item(1))
+		b.drain()
+		r.Len(<-flushed, 1)
+		r.Nil(b.timer)
+	})
+}
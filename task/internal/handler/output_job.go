@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/machinefi/sprout/project"
+	"github.com/machinefi/sprout/types"
+)
+
+// outputJob tracks the outputs of a proved task, the one completing the last output finishes the task
+type outputJob struct {
+	mux       sync.Mutex
+	task      *types.Task
+	mode      project.OutputMode
+	total     int
+	left      int // uncompleted outputs, plus one held by the handler until all outputs are started
+	succeeded int
+	failures  []string // failures which fail the task
+}
+
+// complete records the result of an output, it returns true if the job is done
+func (j *outputJob) complete(required bool, failure string) bool {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if failure == "" {
+		j.succeeded++
+	} else if required || j.mode == project.OutputModeBestEffort {
+		j.failures = append(j.failures, failure)
+	}
+	j.left--
+	return j.left == 0
+}
+
+// release drops the reference held by the handler, it returns true if the job is done
+func (j *outputJob) release() bool {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	j.left--
+	return j.left == 0
+}
+
+// failure returns why the outputs failed the task, empty if the task is outputted
+func (j *outputJob) failure() string {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if j.mode == project.OutputModeBestEffort && j.succeeded > 0 {
+		return ""
+	}
+	return strings.Join(j.failures, "; ")
+}
+
+func newOutputJob(t *types.Task, mode project.OutputMode, total int) *outputJob {
+	return &outputJob{
+		task:  t,
+		mode:  mode,
+		total: total,
+		left:  total + 1,
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/project"
+	"github.com/machinefi/sprout/types"
+)
+
+func TestOutputJob(t *testing.T) {
+	r := require.New(t)
+
+	t.Run("AllSucceeded", func(t *testing.T) {
+		j := newOutputJob(&types.Task{}, "", 2)
+		r.False(j.complete(true, ""))
+		r.False(j.complete(true, ""))
+		r.True(j.release())
+		r.Empty(j.failure())
+	})
+	t.Run("RequiredFailed", func(t *testing.T) {
+		j := newOutputJob(&types.Task{}, project.OutputModeAll, 2)
+		r.False(j.complete(true, ""))
+		r.False(j.release())
+		r.True(j.complete(true, "output 2 failed"))
+		r.Equal("output 2 failed", j.failure())
+	})
+	t.Run("OptionalFailed", func(t *testing.T) {
+		j := newOutputJob(&types.Task{}, project.OutputModeAll, 2)
+		r.False(j.complete(true, ""))
+		r.False(j.complete(false, "output 2 failed"))
+		r.True(j.release())
+		r.Empty(j.failure())
+	})
+	t.Run("BestEffort", func(t *testing.T) {
+		j := newOutputJob(&types.Task{}, project.OutputModeBestEffort, 2)
+		r.False(j.complete(true, "output 1 failed"))
+		r.False(j.complete(true, ""))
+		r.True(j.release())
+		r.Empty(j.failure())
+
+		j = newOutputJob(&types.Task{}, project.OutputModeBestEffort, 2)
+		r.False(j.complete(true, "output 1 failed"))
+		r.False(j.complete(false, "output 2 failed"))
+		r.True(j.release())
+		r.Equal("output 1 failed; output 2 failed", j.failure())
+	})
+}
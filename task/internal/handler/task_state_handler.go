@@ -1,9 +1,16 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"reflect"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/machinefi/sprout/output"
 	"github.com/machinefi/sprout/project"
 	"github.com/machinefi/sprout/types"
@@ -13,21 +20,35 @@ type SaveTaskStateLog func(s *types.TaskStateLog, t *types.Task) error
 
 type GetProject func(projectID uint64) (*project.Project, error)
 
+// ValidateProver checks the prover is registered and assigned to the project
+type ValidateProver func(projectID uint64, proverID string) error
+
+// FinishTask marks the task finished after its output completed asynchronously
+type FinishTask func(projectID, taskID uint64)
+
 type TaskStateHandler struct {
 	saveTaskStateLog          SaveTaskStateLog
 	getProject                GetProject
+	validateProver            ValidateProver
+	finishTask                FinishTask
 	operatorPrivateKeyECDSA   string
 	operatorPrivateKeyED25519 string
+	confirmRetryInterval      time.Duration
+	maxConfirmAttempts        int
+	batchersMux               sync.Mutex
+	batchers                  map[batcherKey]*batcher
 }
 
-func (h *TaskStateHandler) Handle(s *types.TaskStateLog, t *types.Task) (finished bool) {
-	// TODO Verify TaskStateLog Signature
+// Handle saves the state log and outputs the proof of proved task to all outputs of the project;
+// if the proof is accumulated for a batch output, pending is returned and the task is finished by
+// FinishTask once the outputs completed
+func (h *TaskStateHandler) Handle(s *types.TaskStateLog, t *types.Task) (finished, pending bool) {
 	if err := h.saveTaskStateLog(s, t); err != nil {
 		slog.Error("failed to create task state log", "error", err, "task_id", s.TaskID)
 		return
 	}
 	if s.State == types.TaskStateFailed {
-		return true
+		return true, false
 	}
 
 	if s.State != types.TaskStateProved {
@@ -38,60 +59,275 @@ func (h *TaskStateHandler) Handle(s *types.TaskStateLog, t *types.Task) (finishe
 		slog.Error("failed to get project", "error", err, "project_id", t.ProjectID)
 		return
 	}
-	c, err := p.GetDefaultConfig()
+	c, err := p.GetTaskConfig(t.ProjectVersion)
 	if err != nil {
-		slog.Error("failed to get project config", "error", err, "project_id", t.ProjectID, "project_version", p.DefaultVersion)
-		return
+		slog.Error("failed to get project config", "error", err, "project_id", t.ProjectID, "project_version", t.ProjectVersion)
+		h.failTask(t, err)
+		return true, false
+	}
+
+	outputs := c.GetOutputs()
+	job := newOutputJob(t, c.OutputMode, len(outputs))
+	for i := range outputs {
+		conf := &outputs[i]
+		if conf.Batch != nil {
+			b, err := h.getBatcher(t.ProjectID, c.Version, i, conf)
+			if err != nil {
+				slog.Error("failed to init batch output", "error", err, "project_id", t.ProjectID)
+				h.completeOutput(job, i, conf, "", 0, err)
+				continue
+			}
+			b.add(&batchItem{task: t, proof: s.Result, job: job, index: i})
+			continue
+		}
+
+		o, outRes, err := h.output(conf, s, t)
+		h.completeOutput(job, i, conf, outRes, 0, err)
+		if co, ok := o.(output.ConfirmedOutput); ok && err == nil {
+			go h.waitConfirmed(co, conf, []*types.Task{t}, outRes)
+		}
+	}
+	if job.release() {
+		h.finishOutputJob(job)
+		return true, false
 	}
+	return false, true
+}
 
-	output, err := output.New(&c.Output, h.operatorPrivateKeyECDSA, h.operatorPrivateKeyED25519)
+// output sends the proof to the output, the output is returned for waiting confirmation
+func (h *TaskStateHandler) output(conf *output.Config, s *types.TaskStateLog, t *types.Task) (output.Output, string, error) {
+	o, err := output.New(conf, h.operatorPrivateKeyECDSA, h.operatorPrivateKeyED25519)
 	if err != nil {
 		slog.Error("failed to init output", "error", err, "project_id", t.ProjectID)
-		if err := h.saveTaskStateLog(&types.TaskStateLog{
-			TaskID:    s.TaskID,
-			State:     types.TaskStateFailed,
-			Comment:   err.Error(),
-			CreatedAt: time.Now(),
-		}, t); err != nil {
-			slog.Error("failed to create failed task state", "error", err, "task_id", s.TaskID)
-			return
-		}
-		return true
+		return nil, "", err
 	}
 
-	outRes, err := output.Output(t, s.Result)
+	var outRes string
+	if so, ok := o.(output.SignedOutput); ok {
+		outRes, err = so.OutputSigned(t, s.Result, s.ProverID, s.Signature)
+	} else {
+		outRes, err = o.Output(t, s.Result)
+	}
 	if err != nil {
 		slog.Error("failed to output", "error", err, "task_id", s.TaskID)
-		if err := h.saveTaskStateLog(&types.TaskStateLog{
-			TaskID:    s.TaskID,
-			State:     types.TaskStateFailed,
-			Comment:   err.Error(),
-			CreatedAt: time.Now(),
-		}, t); err != nil {
-			slog.Error("failed to create failed task state", "error", err, "task_id", s.TaskID)
-			return
-		}
-		return true
+		return nil, "", err
 	}
+	return o, outRes, nil
+}
 
-	if err := h.saveTaskStateLog(&types.TaskStateLog{
-		TaskID:    s.TaskID,
+// completeOutput saves the outputted or output failed state of an output of the job, batchSize is 0 if the
+// output is not batched; it returns true if the job is done
+func (h *TaskStateHandler) completeOutput(job *outputJob, index int, conf *output.Config, outRes string, batchSize int, outErr error) bool {
+	t := job.task
+	comment := "output type: " + string(conf.Type)
+	if job.total > 1 {
+		comment = fmt.Sprintf("output %v of %v, type: %s", index+1, job.total, conf.Type)
+	}
+	if batchSize > 0 {
+		comment += fmt.Sprintf(", batch size: %v", batchSize)
+	}
+	l := &types.TaskStateLog{
+		TaskID:    t.ID,
+		ProjectID: t.ProjectID,
 		State:     types.TaskStateOutputted,
-		Comment:   "output type: " + string(c.Output.Type),
+		Comment:   comment,
 		Result:    []byte(outRes),
 		CreatedAt: time.Now(),
+	}
+	failure := ""
+	if outErr != nil {
+		failure = comment + ", " + outErr.Error()
+		l.State = types.TaskStateOutputFailed
+		l.Comment = failure
+		l.Result = nil
+	}
+	if err := h.saveTaskStateLog(l, t); err != nil {
+		slog.Error("failed to create output task state", "error", err, "task_id", t.ID, "state", l.State)
+	}
+	return job.complete(!conf.Optional, failure)
+}
+
+// finishOutputJob saves the failed state if the outputs failed the task
+func (h *TaskStateHandler) finishOutputJob(job *outputJob) {
+	if failure := job.failure(); failure != "" {
+		h.failTask(job.task, errors.New(failure))
+	}
+}
+
+// failTask saves the failed state of the task
+func (h *TaskStateHandler) failTask(t *types.Task, failure error) {
+	if err := h.saveTaskStateLog(&types.TaskStateLog{
+		TaskID:    t.ID,
+		ProjectID: t.ProjectID,
+		State:     types.TaskStateFailed,
+		Comment:   failure.Error(),
+		CreatedAt: time.Now(),
 	}, t); err != nil {
-		slog.Error("failed to create outputted task state", "error", err, "task_id", s.TaskID)
+		slog.Error("failed to create failed task state", "error", err, "task_id", t.ID)
+	}
+}
+
+// getBatcher returns the batcher of the project version output, it's recreated if the output config changed
+func (h *TaskStateHandler) getBatcher(projectID uint64, version string, index int, conf *output.Config) (*batcher, error) {
+	h.batchersMux.Lock()
+	defer h.batchersMux.Unlock()
+
+	key := batcherKey{projectID: projectID, version: version, index: index}
+	old, ok := h.batchers[key]
+	if ok && reflect.DeepEqual(&old.conf, conf) {
+		return old, nil
+	}
+	o, err := output.New(conf, h.operatorPrivateKeyECDSA, h.operatorPrivateKeyED25519)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBatcher(conf, o.(output.BatchOutput), h.outputBatch)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		old.drain()
+	}
+	h.batchers[key] = b
+	return b, nil
+}
+
+// outputBatch outputs the accumulated proofs and fans the result out to every task of the batch
+func (h *TaskStateHandler) outputBatch(conf *output.Config, o output.BatchOutput, items []*batchItem) {
+	tasks := make([]*types.Task, 0, len(items))
+	proofs := make([][]byte, 0, len(items))
+	for _, i := range items {
+		tasks = append(tasks, i.task)
+		proofs = append(proofs, i.proof)
+	}
+
+	outRes, err := o.OutputBatch(tasks, proofs)
+	if err != nil {
+		slog.Error("failed to output batch", "error", err, "project_id", tasks[0].ProjectID, "batch_size", len(tasks))
+	}
+	for _, i := range items {
+		// the task is finished by the last output even its state log is not saved, since the batch has been outputted
+		if h.completeOutput(i.job, i.index, conf, outRes, len(items), err) {
+			h.finishOutputJob(i.job)
+			h.finishTask(i.task.ProjectID, i.task.ID)
+		}
+	}
+	if err != nil {
+		return
+	}
+	if co, ok := o.(output.ConfirmedOutput); ok {
+		h.waitConfirmed(co, conf, tasks, outRes)
+	}
+}
+
+// waitConfirmed records the final status of the output result as a confirmed or reverted state of the tasks;
+// the tasks are marked unconfirmed if it's not confirmed in the confirm timeout of the output, and the confirmation
+// is still polled since the transaction may be mined later, until the output fails after maxConfirmAttempts as
+// the transaction may be dropped or replaced
+func (h *TaskStateHandler) waitConfirmed(o output.ConfirmedOutput, conf *output.Config, ts []*types.Task, outRes string) {
+	timeout, err := conf.GetConfirmTimeout()
+	if err != nil {
+		slog.Error("failed to get output confirm timeout", "error", err, "output_result", outRes)
 		return
 	}
+
+	var receipt *output.Receipt
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		receipt, err = o.WaitConfirmed(ctx, outRes)
+		cancel()
+		if err == nil {
+			break
+		}
+		slog.Error("failed to wait for output confirmation", "error", err, "output_result", outRes, "attempt", attempt)
+		if attempt >= h.maxConfirmAttempts {
+			h.saveConfirmState(ts, types.TaskStateOutputFailed, fmt.Sprintf("output not confirmed after %d attempts: %v", attempt, err), nil)
+			return
+		}
+		if attempt == 1 {
+			h.saveConfirmState(ts, types.TaskStateUnconfirmed, "output not confirmed yet, still waiting: "+err.Error(), nil)
+		}
+		time.Sleep(h.confirmRetryInterval)
+	}
+
+	state := types.TaskStateConfirmed
+	comment := fmt.Sprintf("block number %v, gas used %v", receipt.BlockNumber, receipt.GasUsed)
+	if receipt.Reverted {
+		state = types.TaskStateReverted
+		comment += ", revert reason: " + receipt.RevertReason
+	}
+	result, err := json.Marshal(receipt)
+	if err != nil {
+		slog.Error("failed to marshal output receipt", "error", err, "output_result", outRes)
+	}
+	h.saveConfirmState(ts, state, comment, result)
+}
+
+func (h *TaskStateHandler) saveConfirmState(ts []*types.Task, state types.TaskState, comment string, result []byte) {
+	for _, t := range ts {
+		l := &types.TaskStateLog{
+			TaskID:    t.ID,
+			ProjectID: t.ProjectID,
+			State:     state,
+			Comment:   comment,
+			Result:    result,
+			CreatedAt: time.Now(),
+		}
+		if err := h.saveTaskStateLog(l, t); err != nil {
+			slog.Error("failed to create output confirmation task state", "error", err, "task_id", t.ID, "state", state)
+		}
+	}
+}
+
+// Verify checks the state log reported by a prover; unsigned or mis-signed logs and logs from unregistered
+// or unassigned provers are rejected, since anyone can publish them to the topic. The rejection is recorded as
+// a rejected state, which doesn't finish the task, so the assigned prover can still report
+func (h *TaskStateHandler) Verify(s *types.TaskStateLog, t *types.Task) bool {
+	switch s.State {
+	case types.TaskStateDispatched, types.TaskStateProved, types.TaskStateFailed:
+	default:
+		slog.Error("drop task state log with unexpected state", "state", s.State, "task_id", s.TaskID, "prover_id", s.ProverID)
+		return false
+	}
+	if err := s.VerifySignature(t); err != nil {
+		h.reject(s, t, errors.Wrap(err, "invalid signature"))
+		return false
+	}
+	if h.validateProver == nil {
+		return true
+	}
+	if err := h.validateProver(t.ProjectID, s.ProverID); err != nil {
+		h.reject(s, t, errors.Wrap(err, "invalid prover"))
+		return false
+	}
 	return true
 }
 
-func NewTaskStateHandler(saveTaskStateLog SaveTaskStateLog, getProject GetProject, operatorPrivateKeyECDSA, operatorPrivateKeyED25519 string) *TaskStateHandler {
+func (h *TaskStateHandler) reject(s *types.TaskStateLog, t *types.Task, err error) {
+	slog.Error("reject task state log", "error", err, "state", s.State, "task_id", t.ID, "prover_id", s.ProverID)
+	l := &types.TaskStateLog{
+		TaskID:    t.ID,
+		ProjectID: t.ProjectID,
+		State:     types.TaskStateRejected,
+		Comment:   fmt.Sprintf("%s state rejected: %v", s.State, err),
+		ProverID:  s.ProverID,
+		CreatedAt: time.Now(),
+	}
+	if err := h.saveTaskStateLog(l, t); err != nil {
+		slog.Error("failed to create rejected task state log", "error", err, "task_id", t.ID)
+	}
+}
+
+func NewTaskStateHandler(saveTaskStateLog SaveTaskStateLog, getProject GetProject, validateProver ValidateProver, finishTask FinishTask, operatorPrivateKeyECDSA, operatorPrivateKeyED25519 string) *TaskStateHandler {
 	return &TaskStateHandler{
 		saveTaskStateLog:          saveTaskStateLog,
 		getProject:                getProject,
+		validateProver:            validateProver,
+		finishTask:                finishTask,
 		operatorPrivateKeyECDSA:   operatorPrivateKeyECDSA,
 		operatorPrivateKeyED25519: operatorPrivateKeyED25519,
+		confirmRetryInterval:      time.Minute,
+		maxConfirmAttempts:        10,
+		batchers:                  map[batcherKey]*batcher{},
 	}
 }
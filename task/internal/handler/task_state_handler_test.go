@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/machinefi/sprout/output"
+	"github.com/machinefi/sprout/types"
+)
+
+func TestTaskStateHandler_Verify(t *testing.T) {
+	r := require.New(t)
+
+	saved := []*types.TaskStateLog{}
+	save := func(s *types.TaskStateLog, _ *types.Task) error {
+		saved = append(saved, s)
+		return nil
+	}
+	validateProver := func(_ uint64, proverID string) error {
+		if proverID != "prover" {
+			return errors.New("prover not assigned")
+		}
+		return nil
+	}
+	h := NewTaskStateHandler(save, nil, validateProver, nil, "", "")
+	task := &types.Task{ID: 1, ProjectID: 1}
+
+	t.Run("UnexpectedState", func(t *testing.T) {
+		r.False(h.Verify(&types.TaskStateLog{State: types.TaskStateOutputted}, task))
+	})
+	t.Run("InvalidSignature", func(t *testing.T) {
+		p := gomonkey.NewPatches()
+		defer p.Reset()
+
+		p = p.ApplyMethodReturn(&types.TaskStateLog{}, "VerifySignature", errors.New(t.Name()))
+		r.False(h.Verify(&types.TaskStateLog{State: types.TaskStateProved, ProverID: "any"}, task))
+
+		r.Len(saved, 1)
+		r.Equal(uint64(1), saved[0].TaskID)
+		r.Equal(uint64(1), saved[0].ProjectID)
+		r.Equal(types.TaskStateRejected, saved[0].State)
+		r.Equal("any", saved[0].ProverID)
+		r.Equal("proved state rejected: invalid signature: "+t.Name(), saved[0].Comment)
+		saved = saved[:0]
+	})
+
+	p := gomonkey.NewPatches()
+	defer p.Reset()
+	p = p.ApplyMethodReturn(&types.TaskStateLog{}, "VerifySignature", nil)
+
+	t.Run("ForgedProver", func(t *testing.T) {
+		r.False(h.Verify(&types.TaskStateLog{TaskID: 1, ProjectID: 1, State: types.TaskStateFailed, ProverID: "forged"}, task))
+
+		// the rejection doesn't fail the task
+		r.Len(saved, 1)
+		r.Equal(types.TaskStateRejected, saved[0].State)
+		r.Equal("forged", saved[0].ProverID)
+		r.Equal("failed state rejected: invalid prover: prover not assigned", saved[0].Comment)
+		saved = saved[:0]
+	})
+	t.Run("Success", func(t *testing.T) {
+		r.True(h.Verify(&types.TaskStateLog{TaskID: 1, ProjectID: 1, State: types.TaskStateProved, ProverID: "prover"}, task))
+		r.Empty(saved)
+	})
+}
+
+type testConfirmedOutput struct {
+	errs []error
+}
+
+func (o *testConfirmedOutput) WaitConfirmed(ctx context.Context, _ string) (*output.Receipt, error) {
+	if len(o.errs) > 0 {
+		err := o.errs[0]
+		o.errs = o.errs[1:]
+		return nil, err
+	}
+	return &output.Receipt{BlockNumber: 1}, nil
+}
+
+func TestTaskStateHandler_waitConfirmed(t *testing.T) {
+	r := require.New(t)
+
+	saved := []*types.TaskStateLog{}
+	save := func(s *types.TaskStateLog, _ *types.Task) error {
+		saved = append(saved, s)
+		return nil
+	}
+	h := NewTaskStateHandler(save, nil, nil, nil, "", "")
+	h.confirmRetryInterval = time.Millisecond
+	ts := []*types.Task{{ID: 1}, {ID: 2}}
+
+	t.Run("InvalidConfirmTimeout", func(t *testing.T) {
+		h.waitConfirmed(&testConfirmedOutput{}, &output.Config{ConfirmTimeout: "any"}, ts, "tx")
+		r.Empty(saved)
+	})
+	t.Run("KeepPollingAfterTimeout", func(t *testing.T) {
+		o := &testConfirmedOutput{errs: []error{context.DeadlineExceeded, errors.New("rpc error")}}
+		h.waitConfirmed(o, &output.Config{ConfirmTimeout: "1s"}, ts, "tx")
+
+		r.Len(saved, 4)
+		r.Equal(types.TaskStateUnconfirmed, saved[0].State)
+		r.Equal(types.TaskStateUnconfirmed, saved[1].State)
+		r.Equal(types.TaskStateConfirmed, saved[2].State)
+		r.Equal(types.TaskStateConfirmed, saved[3].State)
+		for _, s := range saved {
+			r.NotEqual(types.TaskStateFailed, s.State)
+		}
+		saved = saved[:0]
+	})
+	t.Run("MaxConfirmAttempts", func(t *testing.T) {
+		h.maxConfirmAttempts = 3
+		o := &testConfirmedOutput{errs: []error{context.DeadlineExceeded, context.DeadlineExceeded, errors.New(t.Name())}}
+		h.waitConfirmed(o, &output.Config{ConfirmTimeout: "1s"}, ts, "tx")
+
+		r.Len(saved, 4)
+		r.Equal(types.TaskStateUnconfirmed, saved[0].State)
+		r.Equal(types.TaskStateUnconfirmed, saved[1].State)
+		r.Equal(types.TaskStateOutputFailed, saved[2].State)
+		r.Equal(types.TaskStateOutputFailed, saved[3].State)
+		r.Equal("output not confirmed after 3 attempts: "+t.Name(), saved[2].Comment)
+	})
+}
@@ -1,10 +1,8 @@
 package task
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
-	"encoding/binary"
 	"encoding/json"
 	"log/slog"
 	"sync"
@@ -50,9 +48,9 @@ func (r *Processor) HandleP2PData(d *p2p.Data, topic *pubsub.Topic) {
 		r.reportFail(t, err, topic)
 		return
 	}
-	c, err := p.GetDefaultConfig()
+	c, err := p.GetTaskConfig(t.ProjectVersion)
 	if err != nil {
-		slog.Error("failed to get project config", "error", err, "project_id", t.ProjectID, "project_version", p.DefaultVersion)
+		slog.Error("failed to get project config", "error", err, "project_id", t.ProjectID, "project_version", t.ProjectVersion)
 		r.reportFail(t, err, topic)
 		return
 	}
@@ -76,7 +74,7 @@ func (r *Processor) HandleP2PData(d *p2p.Data, topic *pubsub.Topic) {
 	}
 
 	slog.Debug("get a new task", "task_id", t.ID)
-	r.reportSuccess(t, types.TaskStateDispatched, nil, "", topic)
+	r.reportSuccess(t, types.TaskStateDispatched, nil, topic)
 
 	res, err := r.vmHandler.Handle(t, c.VMType, c.Code, c.CodeExpParam)
 	if err != nil {
@@ -84,74 +82,50 @@ func (r *Processor) HandleP2PData(d *p2p.Data, topic *pubsub.Topic) {
 		r.reportFail(t, err, topic)
 		return
 	}
-	signature, err := r.signProof(t, res)
-	if err != nil {
-		slog.Error("failed to sign proof", "error", err)
-		r.reportFail(t, err, topic)
-		return
-	}
-
-	r.reportSuccess(t, types.TaskStateProved, res, signature, topic)
+	r.reportSuccess(t, types.TaskStateProved, res, topic)
 }
 
-func (r *Processor) signProof(t *types.Task, res []byte) (string, error) {
-	buf := bytes.NewBuffer(nil)
-
-	if err := binary.Write(buf, binary.BigEndian, t.ID); err != nil {
-		return "", err
-	}
-	if err := binary.Write(buf, binary.BigEndian, t.ProjectID); err != nil {
-		return "", err
-	}
-	if _, err := buf.WriteString(t.ClientID); err != nil {
-		return "", err
-	}
-	if _, err := buf.Write(crypto.Keccak256Hash(t.Data...).Bytes()); err != nil {
-		return "", err
-	}
-	if _, err := buf.Write(res); err != nil {
-		return "", err
+func (r *Processor) sign(t *types.Task, l *types.TaskStateLog) error {
+	h, err := l.Hash(t)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash task state log")
 	}
-
-	h := crypto.Keccak256Hash(buf.Bytes())
 	sig, err := crypto.Sign(h.Bytes(), r.proverPrivateKey)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to sign proof")
+		return errors.Wrap(err, "failed to sign task state log")
 	}
-	return hexutil.Encode(sig), nil
+	l.Signature = hexutil.Encode(sig)
+	return nil
 }
 
 func (r *Processor) reportFail(t *types.Task, err error, topic *pubsub.Topic) {
-	d, err := json.Marshal(&p2p.Data{
-		TaskStateLog: &types.TaskStateLog{
-			TaskID:    t.ID,
-			ProjectID: t.ProjectID,
-			State:     types.TaskStateFailed,
-			Comment:   err.Error(),
-			CreatedAt: time.Now(),
-		},
-	})
-	if err != nil {
-		slog.Error("failed to marshal p2p task state log data to json", "error", err, "task_id", t.ID)
-		return
-	}
-	if err := topic.Publish(context.Background(), d); err != nil {
-		slog.Error("failed to publish task state log data to p2p network", "error", err, "task_id", t.ID)
-	}
+	r.report(t, &types.TaskStateLog{
+		TaskID:    t.ID,
+		ProjectID: t.ProjectID,
+		State:     types.TaskStateFailed,
+		Comment:   err.Error(),
+		ProverID:  r.proverID,
+		CreatedAt: time.Now(),
+	}, topic)
+}
+
+func (r *Processor) reportSuccess(t *types.Task, state types.TaskState, result []byte, topic *pubsub.Topic) {
+	r.report(t, &types.TaskStateLog{
+		TaskID:    t.ID,
+		ProjectID: t.ProjectID,
+		State:     state,
+		Result:    result,
+		ProverID:  r.proverID,
+		CreatedAt: time.Now(),
+	}, topic)
 }
 
-func (r *Processor) reportSuccess(t *types.Task, state types.TaskState, result []byte, signature string, topic *pubsub.Topic) {
-	d, err := json.Marshal(&p2p.Data{
-		TaskStateLog: &types.TaskStateLog{
-			TaskID:    t.ID,
-			ProjectID: t.ProjectID,
-			State:     state,
-			Result:    result,
-			Signature: signature,
-			ProverID:  r.proverID,
-			CreatedAt: time.Now(),
-		},
-	})
+func (r *Processor) report(t *types.Task, l *types.TaskStateLog, topic *pubsub.Topic) {
+	if err := r.sign(t, l); err != nil {
+		slog.Error("failed to sign task state log", "error", err, "task_id", t.ID)
+		return
+	}
+	d, err := json.Marshal(&p2p.Data{TaskStateLog: l})
 	if err != nil {
 		slog.Error("failed to marshal p2p task state log data to json", "error", err, "task_id", t.ID)
 		return
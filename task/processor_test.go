@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/crypto"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
@@ -17,7 +18,9 @@ import (
 )
 
 func TestProcessor_ReportFail(t *testing.T) {
-	processor := &Processor{}
+	sk, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	processor := &Processor{proverPrivateKey: sk}
 
 	t.Run("MarshalFailed", func(t *testing.T) {
 		p := NewPatches()
@@ -37,13 +40,15 @@ func TestProcessor_ReportFail(t *testing.T) {
 }
 
 func TestProcessor_ReportSuccess(t *testing.T) {
-	processor := &Processor{}
+	sk, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	processor := &Processor{proverPrivateKey: sk}
 
 	t.Run("MarshalFailed", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
 		p = testutil.JsonMarshal(p, []byte("any"), errors.New(t.Name()))
-		processor.reportSuccess(&types.Task{}, types.TaskStatePacked, nil, "", nil)
+		processor.reportSuccess(&types.Task{}, types.TaskStatePacked, nil, nil)
 	})
 
 	t.Run("PublishFailed", func(t *testing.T) {
@@ -52,11 +57,63 @@ func TestProcessor_ReportSuccess(t *testing.T) {
 		p = testutil.JsonMarshal(p, []byte("any"), nil)
 
 		p = testutil.TopicPublish(p, errors.New(t.Name()))
-		processor.reportSuccess(&types.Task{}, types.TaskStatePacked, nil, "", nil)
+		processor.reportSuccess(&types.Task{}, types.TaskStatePacked, nil, nil)
 	})
 
 }
 
+func TestProcessor_Sign(t *testing.T) {
+	r := require.New(t)
+
+	sk, err := crypto.GenerateKey()
+	r.NoError(err)
+	proverID := crypto.PubkeyToAddress(sk.PublicKey).String()
+	processor := &Processor{proverPrivateKey: sk, proverID: proverID}
+	task := &types.Task{ID: 1, ProjectID: 2, ClientID: "client", Data: [][]byte{[]byte("data")}}
+
+	newLog := func() *types.TaskStateLog {
+		l := &types.TaskStateLog{TaskID: task.ID, ProjectID: task.ProjectID, State: types.TaskStateProved, Result: []byte("proof"), ProverID: proverID}
+		r.NoError(processor.sign(task, l))
+		return l
+	}
+
+	t.Run("Verified", func(t *testing.T) {
+		r.NoError(newLog().VerifySignature(task))
+	})
+	t.Run("Unsigned", func(t *testing.T) {
+		l := newLog()
+		l.Signature = ""
+		r.Error(l.VerifySignature(task))
+	})
+	t.Run("ProverUnmatched", func(t *testing.T) {
+		other, err := crypto.GenerateKey()
+		r.NoError(err)
+		l := newLog()
+		l.ProverID = crypto.PubkeyToAddress(other.PublicKey).String()
+		r.Error(l.VerifySignature(task))
+	})
+	t.Run("ResultTampered", func(t *testing.T) {
+		l := newLog()
+		l.Result = []byte("forged")
+		r.Error(l.VerifySignature(task))
+	})
+	t.Run("StateTampered", func(t *testing.T) {
+		l := newLog()
+		l.State = types.TaskStateFailed
+		r.Error(l.VerifySignature(task))
+	})
+	t.Run("CommentTampered", func(t *testing.T) {
+		l := newLog()
+		l.Comment = "forged"
+		r.Error(l.VerifySignature(task))
+	})
+	t.Run("InvalidProverID", func(t *testing.T) {
+		l := newLog()
+		l.ProverID = "any"
+		r.Error(l.VerifySignature(task))
+	})
+}
+
 func TestProcessor_HandleP2PData(t *testing.T) {
 	r := require.New(t)
 	processor := &Processor{
@@ -103,6 +160,23 @@ func TestProcessor_HandleP2PData(t *testing.T) {
 	}
 	r.NoError(testProject.Validate())
 
+	t.Run("VersionNotExist", func(t *testing.T) {
+		p := NewPatches()
+		defer p.Reset()
+
+		p = p.ApplyMethodReturn(&project.Manager{}, "Get", testProject, nil)
+		p = p.ApplyMethodFunc(&vm.Handler{}, "Handle", func(*types.Task, vm.Type, string, string) ([]byte, error) {
+			r.FailNow("vm should not handle the task of unknown version")
+			return nil, nil
+		})
+		var failure error
+		p = p.ApplyPrivateMethod(&Processor{}, "reportFail", func(_ *Processor, _ *types.Task, err error, _ *pubsub.Topic) {
+			failure = err
+		})
+		processor.HandleP2PData(&p2p.Data{Task: &types.Task{ID: 1, ProjectID: 1, ProjectVersion: "0.2"}}, nil)
+		r.ErrorIs(failure, project.ErrVersionNotExist)
+	})
+
 	t.Run("ProofFailed", func(t *testing.T) {
 		p := NewPatches()
 		defer p.Reset()
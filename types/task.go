@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/pkg/errors"
@@ -62,6 +63,12 @@ const (
 	_
 	TaskStateOutputted
 	TaskStateFailed
+	TaskStateRetried
+	TaskStateConfirmed
+	TaskStateReverted
+	TaskStateOutputFailed
+	TaskStateUnconfirmed
+	TaskStateRejected // the state log of a prover is rejected, it doesn't finish the task
 )
 
 type TaskStateLog struct {
@@ -75,42 +82,58 @@ type TaskStateLog struct {
 	CreatedAt time.Time
 }
 
-func (l *TaskStateLog) VerifySignature(pubkey string, task *Task) error {
-	proverPubKey, err := hexutil.Decode(pubkey)
-	if err != nil {
-		return errors.Wrap(err, "failed to decode prover pubkey")
-	}
-
-	sig, err := hexutil.Decode(task.Signature)
-	if err != nil {
-		return errors.Wrap(err, "failed to decode task signature")
-	}
-
+// Hash returns the digest the prover signs, it binds the state, comment and result to the task
+func (l *TaskStateLog) Hash(task *Task) (common.Hash, error) {
 	buf := bytes.NewBuffer(nil)
 
-	if err = binary.Write(buf, binary.BigEndian, task.ID); err != nil {
-		return err
+	if err := binary.Write(buf, binary.BigEndian, task.ID); err != nil {
+		return common.Hash{}, err
 	}
-	if err = binary.Write(buf, binary.BigEndian, task.ProjectID); err != nil {
-		return err
+	if err := binary.Write(buf, binary.BigEndian, task.ProjectID); err != nil {
+		return common.Hash{}, err
 	}
-	if _, err = buf.WriteString(task.ClientID); err != nil {
-		return err
+	if _, err := buf.WriteString(task.ClientID); err != nil {
+		return common.Hash{}, err
 	}
-	if _, err = buf.Write(crypto.Keccak256Hash(task.Data...).Bytes()); err != nil {
-		return err
+	if _, err := buf.Write(crypto.Keccak256Hash(task.Data...).Bytes()); err != nil {
+		return common.Hash{}, err
 	}
-	if _, err = buf.Write(l.Result); err != nil {
-		return err
+	if err := buf.WriteByte(byte(l.State)); err != nil {
+		return common.Hash{}, err
+	}
+	if _, err := buf.Write(crypto.Keccak256Hash([]byte(l.Comment)).Bytes()); err != nil {
+		return common.Hash{}, err
+	}
+	if _, err := buf.Write(l.Result); err != nil {
+		return common.Hash{}, err
 	}
 
-	h := crypto.Keccak256Hash(buf.Bytes())
-	sigpk, err := crypto.Ecrecover(h.Bytes(), sig)
+	return crypto.Keccak256Hash(buf.Bytes()), nil
+}
+
+// VerifySignature checks the log is signed by the prover it claims, the prover id is the hex address of prover key
+func (l *TaskStateLog) VerifySignature(task *Task) error {
+	if l.Signature == "" {
+		return errors.New("task state log unsigned")
+	}
+	if !common.IsHexAddress(l.ProverID) {
+		return errors.Errorf("invalid prover id %s", l.ProverID)
+	}
+
+	sig, err := hexutil.Decode(l.Signature)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode task state log signature")
+	}
+	h, err := l.Hash(task)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash task state log")
+	}
+	sigpk, err := crypto.SigToPub(h.Bytes(), sig)
 	if err != nil {
 		return errors.Wrap(err, "failed to recover public key")
 	}
-	if !bytes.Equal(sigpk, proverPubKey) {
-		return errors.New("proof signature unmatched")
+	if crypto.PubkeyToAddress(*sigpk) != common.HexToAddress(l.ProverID) {
+		return errors.New("task state log signature unmatched")
 	}
 	return nil
 }
@@ -127,6 +150,18 @@ func (s TaskState) String() string {
 		return "outputted"
 	case TaskStateFailed:
 		return "failed"
+	case TaskStateRetried:
+		return "retried"
+	case TaskStateConfirmed:
+		return "confirmed"
+	case TaskStateReverted:
+		return "reverted"
+	case TaskStateOutputFailed:
+		return "outputFailed"
+	case TaskStateUnconfirmed:
+		return "unconfirmed"
+	case TaskStateRejected:
+		return "rejected"
 	default:
 		return "invalid"
 	}
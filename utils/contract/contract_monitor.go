@@ -10,6 +10,7 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/pkg/errors"
@@ -20,14 +21,18 @@ import (
 
 const (
 	ProjectUpsertedTopic = "ProjectUpserted(uint64,string,bytes32)"
+	ProjectPausedTopic   = "ProjectPaused(uint64)"
+	ProjectUnpausedTopic = "ProjectUnpaused(uint64)"
 	ProverUpsertedTopic  = "ProverUpserted(string)"
 )
 
 type Project struct {
-	Uri         string
-	Hash        [32]byte
-	ID          uint64
-	BlockNumber uint64
+	Uri                   string
+	Hash                  [32]byte
+	ID                    uint64
+	Paused                bool
+	RequestedProverAmount uint64 // the project registrar doesn't expose it, 0 means one prover
+	BlockNumber           uint64
 }
 
 type Prover struct {
@@ -36,12 +41,15 @@ type Prover struct {
 }
 
 func ListAndWatchProject(chainEndpoint, contractAddress string) (<-chan *Project, error) {
-	ch := make(chan *Project, 10)
 	client, err := ethclient.Dial(chainEndpoint)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to dial chain endpoint")
 	}
+	return ListAndWatchProjectByClient(client, contractAddress)
+}
 
+// ListAndWatchProjectByClient sends the projects at the latest block, then the projects upserted after it
+func ListAndWatchProjectByClient(client *ethclient.Client, contractAddress string) (<-chan *Project, error) {
 	instance, err := contracts.NewContracts(common.HexToAddress(contractAddress), client)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to new project contract instance")
@@ -51,39 +59,79 @@ func ListAndWatchProject(chainEndpoint, contractAddress string) (<-chan *Project
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to query the latest block number")
 	}
-	watchProject(ch, client, instance, 3*time.Second, contractAddress, ProjectUpsertedTopic, 1000, latestBlockNumber)
-	if err := listProject(ch, instance, latestBlockNumber); err != nil {
+	ps, err := listProject(instance, latestBlockNumber)
+	if err != nil {
 		return nil, err
 	}
+
+	ch := make(chan *Project, 10)
+	go func() {
+		for _, p := range ps {
+			ch <- p
+		}
+		watchProject(ch, client, instance, 3*time.Second, contractAddress, []string{ProjectUpsertedTopic, ProjectPausedTopic, ProjectUnpausedTopic}, 1000, latestBlockNumber)
+	}()
 	return ch, nil
 }
 
-func listProject(ch chan<- *Project, instance *contracts.Contracts, targetBlockNumber uint64) error {
-	emptyHash := [32]byte{}
+// ListProject returns the projects at the latest block
+func ListProject(client *ethclient.Client, contractAddress string) ([]*Project, error) {
+	instance, err := contracts.NewContracts(common.HexToAddress(contractAddress), client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to new project contract instance")
+	}
+	latestBlockNumber, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query the latest block number")
+	}
+	return listProject(instance, latestBlockNumber)
+}
+
+func listProject(instance *contracts.Contracts, targetBlockNumber uint64) ([]*Project, error) {
+	ps := []*Project{}
 	for projectID := uint64(1); ; projectID++ {
-		mp, err := instance.Projects(&bind.CallOpts{
-			BlockNumber: new(big.Int).SetUint64(targetBlockNumber),
-		}, projectID)
+		p, err := getProject(instance, projectID, targetBlockNumber)
 		if err != nil {
-			return errors.Wrapf(err, "failed to get project meta from chain, project_id %v", projectID)
+			return nil, err
 		}
-		if mp.Uri == "" || bytes.Equal(mp.Hash[:], emptyHash[:]) {
-			return nil
-		}
-		ch <- &Project{
-			Uri:         mp.Uri,
-			Hash:        mp.Hash,
-			ID:          projectID,
-			BlockNumber: targetBlockNumber,
+		if p == nil {
+			return ps, nil
 		}
+		ps = append(ps, p)
 	}
 }
 
-func watchProject(ch chan<- *Project, client *ethclient.Client, instance *contracts.Contracts, interval time.Duration, contractAddress, topic string, step, startBlockNumber uint64) {
+// getProject returns the project snapshot at the target block, nil means the project not exist
+func getProject(instance *contracts.Contracts, projectID, targetBlockNumber uint64) (*Project, error) {
+	emptyHash := [32]byte{}
+	opts := &bind.CallOpts{
+		BlockNumber: new(big.Int).SetUint64(targetBlockNumber),
+	}
+	mp, err := instance.Projects(opts, projectID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get project meta from chain, project_id %v", projectID)
+	}
+	if mp.Uri == "" || bytes.Equal(mp.Hash[:], emptyHash[:]) {
+		return nil, nil
+	}
+	return &Project{
+		Uri:         mp.Uri,
+		Hash:        mp.Hash,
+		ID:          projectID,
+		Paused:      mp.Paused,
+		BlockNumber: targetBlockNumber,
+	}, nil
+}
+
+func watchProject(ch chan<- *Project, client *ethclient.Client, instance *contracts.Contracts, interval time.Duration, contractAddress string, topics []string, step, startBlockNumber uint64) {
 	queriedBlockNumber := startBlockNumber
+	topicHashes := []common.Hash{}
+	for _, t := range topics {
+		topicHashes = append(topicHashes, crypto.Keccak256Hash([]byte(t)))
+	}
 	query := ethereum.FilterQuery{
 		Addresses: []common.Address{common.HexToAddress(contractAddress)},
-		Topics:    [][]common.Hash{{crypto.Keccak256Hash([]byte(topic))}},
+		Topics:    [][]common.Hash{topicHashes},
 	}
 	ticker := time.NewTicker(interval)
 	go func() {
@@ -110,23 +158,54 @@ func watchProject(ch chan<- *Project, client *ethclient.Client, instance *contra
 				continue
 			}
 			for i := range logs {
-				ev, err := instance.ParseProjectUpserted(logs[i])
+				projectID, err := parseProjectID(instance, logs[i])
 				if err != nil {
-					slog.Error("failed to parse project upserted event", "error", err)
+					slog.Error("failed to parse project event", "error", err)
 					continue
 				}
-				ch <- &Project{
-					Uri:         ev.Uri,
-					Hash:        ev.Hash,
-					ID:          ev.ProjectId,
-					BlockNumber: logs[i].BlockNumber,
+				p, err := getProject(instance, projectID, logs[i].BlockNumber)
+				if err != nil {
+					slog.Error("failed to get project", "error", err, "project_id", projectID)
+					continue
 				}
+				if p == nil {
+					continue
+				}
+				ch <- p
 			}
 			queriedBlockNumber = to
 		}
 	}()
 }
 
+func parseProjectID(instance *contracts.Contracts, l types.Log) (uint64, error) {
+	if len(l.Topics) == 0 {
+		return 0, errors.New("missing event topic")
+	}
+	switch l.Topics[0] {
+	case crypto.Keccak256Hash([]byte(ProjectUpsertedTopic)):
+		ev, err := instance.ParseProjectUpserted(l)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to parse project upserted event")
+		}
+		return ev.ProjectId, nil
+	case crypto.Keccak256Hash([]byte(ProjectPausedTopic)):
+		ev, err := instance.ParseProjectPaused(l)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to parse project paused event")
+		}
+		return ev.ProjectId, nil
+	case crypto.Keccak256Hash([]byte(ProjectUnpausedTopic)):
+		ev, err := instance.ParseProjectUnpaused(l)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to parse project unpaused event")
+		}
+		return ev.ProjectId, nil
+	default:
+		return 0, errors.Errorf("unknown event topic %s", l.Topics[0])
+	}
+}
+
 func ListAndWatchProver(chainEndpoint, contractAddress string) (<-chan *Prover, error) {
 	ch := make(chan *Prover, 10)
 	client, err := ethclient.Dial(chainEndpoint)
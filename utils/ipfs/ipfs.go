@@ -2,6 +2,7 @@ package ipfs
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 
@@ -45,3 +46,16 @@ func (s *IPFS) Cat(cid string) ([]byte, error) {
 
 	return io.ReadAll(reader)
 }
+
+// CatReader returns the reader of the content, the request is canceled with the context
+func (s *IPFS) CatReader(ctx context.Context, cid string) (io.ReadCloser, error) {
+	resp, err := s.sh.Request("cat", cid).Send(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read content from ipfs: %s", cid)
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, errors.Wrapf(resp.Error, "failed to read content from ipfs: %s", cid)
+	}
+	return resp.Output, nil
+}
@@ -2,34 +2,356 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"log/slog"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+// PoolConfig limits the vm instances kept in Mgr
+type PoolConfig struct {
+	MinIdle        int           // idle instances of a project kept from the idle eviction
+	MaxProject     int           // instances of all the codes of a project, 0 means no limit
+	MaxServer      int           // instances on a vm server, 0 means no limit
+	IdleTimeout    time.Duration // idle instances are released after it, 0 means never
+	AcquireTimeout time.Duration // a task waits for an instance at most for it, 0 means no limit
+}
+
+var DefaultPoolConfig = PoolConfig{
+	MinIdle:        1,
+	MaxProject:     4,
+	MaxServer:      16,
+	IdleTimeout:    10 * time.Minute,
+	AcquireTimeout: 5 * time.Minute,
+}
+
+type poolKey struct {
+	projectID uint64
+	endpoint  string
+	codeHash  [32]byte
+}
+
+// CodeHash identifies the code a vm instance is created with
+func CodeHash(code string, expParam string) [32]byte {
+	h := sha256.New()
+	h.Write([]byte(code))
+	h.Write([]byte{0})
+	h.Write([]byte(expParam))
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+type pool struct {
+	idle  []*Instance // the most recently released last
+	total int         // idle and acquired instances
+}
+
+// Mgr pools the vm instances of the projects, every instance has its own grpc connection as the vm server frees
+// the instance when the connection is closed; the connection of an endpoint can't be shared until the vm runtime
+// proto has a rpc releasing the instance
 type Mgr struct {
-	mux  sync.Mutex
-	idle map[uint64]*Instance
+	conf     PoolConfig
+	mux      sync.Mutex
+	pools    map[poolKey]*pool
+	projects map[uint64]int // instances of all the codes of a project
+	servers  map[string]int
+	changed  chan struct{}
+	closed   chan struct{}
 }
 
-func (m *Mgr) Acquire(projectID uint64, endpoint string, code string, expParam string) (*Instance, error) {
+// Acquire takes an idle instance of the project code or creates one, it waits for a released instance when the
+// project or vm server limit is reached
+func (m *Mgr) Acquire(ctx context.Context, projectID uint64, endpoint string, code string, expParam string) (*Instance, error) {
+	key := poolKey{projectID: projectID, endpoint: endpoint, codeHash: CodeHash(code, expParam)}
+	for {
+		m.mux.Lock()
+		select {
+		case <-m.closed:
+			m.mux.Unlock()
+			return nil, errors.New("vm instance manager closed")
+		default:
+		}
+		p := m.pool(key)
+		if n := len(p.idle); n > 0 {
+			i := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			m.mux.Unlock()
+			return i, nil
+		}
+		if evicted, ok := m.reserve(key); ok {
+			m.mux.Unlock()
+			release(evicted)
+			i, err := NewInstance(ctx, endpoint, projectID, code, expParam)
+			if err != nil {
+				m.unreserve(key, p)
+				return nil, err
+			}
+			i.pool = p
+			return i, nil
+		}
+		changed := m.changed
+		m.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "failed to wait for vm instance")
+		case <-changed:
+		}
+	}
+}
+
+// Release returns the instance to the pool of its project code, it's released if the code is invalidated
+func (m *Mgr) Release(i *Instance) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 
-	if i, ok := m.idle[projectID]; ok {
-		return i, nil
+	// the pool of an invalidated code is detached, even if a pool of the same code is created again
+	ok := m.pools[i.key] == i.pool
+	select {
+	case <-m.closed:
+		ok = false
+	default:
+	}
+	if !ok {
+		m.drop(i.key, i.pool, 1)
+		m.notify()
+		i.Release()
+		return
+	}
+	i.releasedAt = time.Now()
+	i.pool.idle = append(i.pool.idle, i)
+	m.notify()
+}
+
+// Prewarm creates the idle instances of the project code up to MinIdle, at least one, within the limits
+func (m *Mgr) Prewarm(ctx context.Context, projectID uint64, endpoint string, code string, expParam string) error {
+	key := poolKey{projectID: projectID, endpoint: endpoint, codeHash: CodeHash(code, expParam)}
+
+	n := max(m.conf.MinIdle, 1)
+	for k := 0; k < n; k++ {
+		m.mux.Lock()
+		p := m.pool(key)
+		if len(p.idle) >= n {
+			m.mux.Unlock()
+			return nil
+		}
+		evicted, ok := m.reserve(key)
+		if !ok {
+			m.mux.Unlock()
+			if k == 0 {
+				return errors.New("vm instance limit reached")
+			}
+			return nil
+		}
+		m.mux.Unlock()
+		release(evicted)
+		i, err := NewInstance(ctx, endpoint, projectID, code, expParam)
+		if err != nil {
+			m.unreserve(key, p)
+			return err
+		}
+		i.pool = p
+		m.Release(i)
+	}
+	return nil
+}
+
+// Invalidate closes the idle instances of the project whose code hash is not kept, the acquired ones are closed
+// on Release; it returns the number of the closed idle instances
+func (m *Mgr) Invalidate(projectID uint64, keep ...[32]byte) int {
+	kept := make(map[[32]byte]bool, len(keep))
+	for _, h := range keep {
+		kept[h] = true
+	}
+
+	m.mux.Lock()
+	var stale []*Instance
+	for key, p := range m.pools {
+		if key.projectID != projectID || kept[key.codeHash] {
+			continue
+		}
+		stale = append(stale, p.idle...)
+		// the acquired instances stay counted in the detached pool until they are released
+		m.drop(key, p, len(p.idle))
+		p.idle = nil
+		delete(m.pools, key)
+	}
+	if len(stale) > 0 {
+		m.notify()
+	}
+	m.mux.Unlock()
+
+	release(stale)
+	return len(stale)
+}
+
+// Close releases the idle instances, acquired instances are released on Release
+func (m *Mgr) Close() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	select {
+	case <-m.closed:
+		return
+	default:
+	}
+	close(m.closed)
+	for _, p := range m.pools {
+		release(p.idle)
+	}
+	m.pools = map[poolKey]*pool{}
+	m.notify()
+}
+
+func (m *Mgr) pool(key poolKey) *pool {
+	p, ok := m.pools[key]
+	if !ok {
+		p = &pool{}
+		m.pools[key] = p
 	}
+	return p
+}
 
-	return NewInstance(context.Background(), endpoint, projectID, code, expParam)
+// reserve counts a new instance of the project code in; when the project is full, the least recently used idle
+// instance of its other codes is evicted, and when the vm server is full, the one of the other codes on the server
+func (m *Mgr) reserve(key poolKey) ([]*Instance, bool) {
+	var evicted []*Instance
+	if m.conf.MaxProject > 0 && m.projects[key.projectID] >= m.conf.MaxProject {
+		i := m.leastRecentlyUsed(func(k poolKey) bool { return k != key && k.projectID == key.projectID })
+		if i == nil {
+			return nil, false
+		}
+		evicted = append(evicted, i)
+	}
+	if m.conf.MaxServer > 0 && m.servers[key.endpoint] >= m.conf.MaxServer &&
+		(len(evicted) == 0 || evicted[0].key.endpoint != key.endpoint) {
+		i := m.leastRecentlyUsed(func(k poolKey) bool { return k != key && k.endpoint == key.endpoint })
+		if i == nil {
+			return nil, false
+		}
+		evicted = append(evicted, i)
+	}
+	for _, i := range evicted {
+		m.remove(i)
+	}
+	m.pools[key].total++
+	m.projects[key.projectID]++
+	m.servers[key.endpoint]++
+	return evicted, true
 }
 
-func (m *Mgr) Release(projectID uint64, i *Instance) {
+func (m *Mgr) unreserve(key poolKey, p *pool) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
 
-	m.idle[projectID] = i
+	m.drop(key, p, 1)
+	m.notify()
+}
+
+// drop counts n instances of the pool out
+func (m *Mgr) drop(key poolKey, p *pool, n int) {
+	p.total -= n
+	m.projects[key.projectID] -= n
+	if m.projects[key.projectID] <= 0 {
+		delete(m.projects, key.projectID)
+	}
+	m.servers[key.endpoint] -= n
 }
 
-func NewMgr() *Mgr {
-	return &Mgr{
-		idle: make(map[uint64]*Instance),
+func (m *Mgr) leastRecentlyUsed(match func(poolKey) bool) *Instance {
+	var lru *Instance
+	for key, p := range m.pools {
+		if len(p.idle) == 0 || !match(key) {
+			continue
+		}
+		if i := p.idle[0]; lru == nil || i.releasedAt.Before(lru.releasedAt) {
+			lru = i
+		}
+	}
+	return lru
+}
+
+// remove drops the idle instance from its pool
+func (m *Mgr) remove(i *Instance) {
+	p := i.pool
+	for k, idle := range p.idle {
+		if idle == i {
+			p.idle = append(p.idle[:k], p.idle[k+1:]...)
+			break
+		}
+	}
+	m.drop(i.key, p, 1)
+	if p.total == 0 && m.pools[i.key] == p {
+		delete(m.pools, i.key)
+	}
+}
+
+// notify wakes up the waiting Acquire calls
+func (m *Mgr) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *Mgr) evictIdle() {
+	m.mux.Lock()
+	deadline := time.Now().Add(-m.conf.IdleTimeout)
+	var evicted []*Instance
+	for _, p := range m.pools {
+		for len(p.idle) > m.conf.MinIdle && p.idle[0].releasedAt.Before(deadline) {
+			i := p.idle[0]
+			m.remove(i)
+			evicted = append(evicted, i)
+		}
+	}
+	if len(evicted) > 0 {
+		m.notify()
+	}
+	m.mux.Unlock()
+
+	release(evicted)
+	if len(evicted) > 0 {
+		slog.Debug("idle vm instances evicted", "count", len(evicted))
+	}
+}
+
+func (m *Mgr) runEvictIdle() {
+	interval := max(m.conf.IdleTimeout/2, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.closed:
+			return
+		case <-ticker.C:
+			m.evictIdle()
+		}
+	}
+}
+
+func release(is []*Instance) {
+	for _, i := range is {
+		i.Release()
+	}
+}
+
+func NewMgr(conf *PoolConfig) *Mgr {
+	if conf == nil {
+		conf = &DefaultPoolConfig
+	}
+	m := &Mgr{
+		conf:     *conf,
+		pools:    make(map[poolKey]*pool),
+		projects: make(map[uint64]int),
+		servers:  make(map[string]int),
+		changed:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	if m.conf.IdleTimeout > 0 {
+		go m.runEvictIdle()
 	}
+	return m
 }
@@ -1,28 +1,295 @@
 package server_test
 
 import (
+	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/agiledragon/gomonkey/v2"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 
+	"github.com/machinefi/sprout/vm/proto"
 	"github.com/machinefi/sprout/vm/server"
 )
 
 func TestMgr(t *testing.T) {
 	r := require.New(t)
-	m := server.NewMgr()
+
 	p := gomonkey.NewPatches()
 	defer p.Reset()
 
-	p = p.ApplyFuncReturn(server.NewInstance, &server.Instance{}, nil)
+	dialed, created, closed := int32(0), int32(0), int32(0)
+	var createErr error
+	p = p.ApplyFunc(grpc.Dial, func(string, ...grpc.DialOption) (*grpc.ClientConn, error) {
+		atomic.AddInt32(&dialed, 1)
+		return &grpc.ClientConn{}, nil
+	})
+	// the vm server frees the instance when its connection is closed
+	p = p.ApplyMethod(&grpc.ClientConn{}, "Close", func(*grpc.ClientConn) error {
+		atomic.AddInt32(&closed, 1)
+		return nil
+	})
+	p = p.ApplyFuncReturn(proto.NewVmRuntimeClient, &MockClient{})
+	p = p.ApplyMethod(&MockClient{}, "Create", func(*MockClient, context.Context, *proto.CreateRequest, ...grpc.CallOption) (*proto.CreateResponse, error) {
+		if createErr != nil {
+			return nil, createErr
+		}
+		atomic.AddInt32(&created, 1)
+		return &proto.CreateResponse{}, nil
+	})
+
+	ctx := context.Background()
+
+	t.Run("Reuse", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxProject: 2})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		m.Release(i)
+
+		i2, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.Same(i, i2)
+	})
+
+	t.Run("ConnectionPerInstance", func(t *testing.T) {
+		atomic.StoreInt32(&dialed, 0)
+		atomic.StoreInt32(&created, 0)
+		m := server.NewMgr(&server.PoolConfig{})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		i2, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.NotSame(i, i2)
+		_, err = m.Acquire(ctx, 2, "any", "any", "any")
+		r.NoError(err)
+		r.Equal(int32(3), atomic.LoadInt32(&dialed))
+		r.Equal(int32(3), atomic.LoadInt32(&created))
+	})
+
+	t.Run("MaxProject", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxProject: 1})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = m.Acquire(timeout, 1, "any", "any", "any")
+		r.ErrorIs(err, context.DeadlineExceeded)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			m.Release(i)
+		}()
+		i2, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.Same(i, i2)
+	})
+
+	t.Run("MaxServer", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxServer: 1})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = m.Acquire(timeout, 2, "any", "any", "any")
+		r.ErrorIs(err, context.DeadlineExceeded)
+
+		_, err = m.Acquire(ctx, 3, "other", "any", "any")
+		r.NoError(err)
+
+		atomic.StoreInt32(&closed, 0)
+		m.Release(i)
+		i2, err := m.Acquire(ctx, 2, "any", "any", "any")
+		r.NoError(err)
+		r.NotSame(i, i2)
+		// the least recently used instance is released at the vm server
+		r.Equal(int32(1), atomic.LoadInt32(&closed))
+	})
+
+	t.Run("FailedToCreate", func(t *testing.T) {
+		createErr = errors.New(t.Name())
+		defer func() { createErr = nil }()
+
+		m := server.NewMgr(&server.PoolConfig{MaxProject: 1})
+		defer m.Close()
+
+		_, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.ErrorContains(err, t.Name())
+		_, err = m.Acquire(ctx, 1, "any", "any", "any")
+		r.ErrorContains(err, t.Name())
+	})
+
+	t.Run("Prewarm", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MinIdle: 2, MaxProject: 2})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		m.Release(i)
+
+		atomic.StoreInt32(&created, 0)
+		r.NoError(m.Prewarm(ctx, 1, "any", "any", "any"))
+		r.Equal(int32(1), atomic.LoadInt32(&created))
+		r.NoError(m.Prewarm(ctx, 1, "any", "any", "any"))
+		r.Equal(int32(1), atomic.LoadInt32(&created))
+
+		_, err = m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		_, err = m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.Equal(int32(1), atomic.LoadInt32(&created))
+	})
+
+	t.Run("CodeChanged", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxServer: 2})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "v1", "any")
+		r.NoError(err)
+		m.Release(i)
+
+		i2, err := m.Acquire(ctx, 1, "any", "v2", "any")
+		r.NoError(err)
+		r.NotSame(i, i2)
+		i3, err := m.Acquire(ctx, 1, "any", "v2", "other")
+		r.NoError(err)
+		r.NotSame(i2, i3)
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxServer: 3})
+		defer m.Close()
+
+		v1, err := m.Acquire(ctx, 1, "any", "v1", "any")
+		r.NoError(err)
+		v1Acquired, err := m.Acquire(ctx, 1, "any", "v1", "any")
+		r.NoError(err)
+		v2, err := m.Acquire(ctx, 1, "any", "v2", "any")
+		r.NoError(err)
+		m.Release(v1)
+		m.Release(v2)
+
+		atomic.StoreInt32(&closed, 0)
+		r.Equal(1, m.Invalidate(1, server.CodeHash("v2", "any")))
+		r.Equal(0, m.Invalidate(2))
+		r.Equal(int32(1), atomic.LoadInt32(&closed))
+
+		i, err := m.Acquire(ctx, 1, "any", "v2", "any")
+		r.NoError(err)
+		r.Same(v2, i)
+		m.Release(i)
+
+		// the server slots of the closed instances are freed
+		m.Release(v1Acquired)
+		r.Equal(int32(2), atomic.LoadInt32(&closed))
+		atomic.StoreInt32(&created, 0)
+		for id := uint64(2); id < 4; id++ {
+			_, err = m.Acquire(ctx, id, "any", "any", "any")
+			r.NoError(err)
+		}
+		r.Equal(int32(2), atomic.LoadInt32(&created))
+
+		i, err = m.Acquire(ctx, 1, "any", "v1", "any")
+		r.NoError(err)
+		r.NotSame(v1, i)
+		r.NotSame(v1Acquired, i)
+	})
+
+	t.Run("MaxProjectOfAllCodes", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxProject: 1})
+		defer m.Close()
+
+		v1, err := m.Acquire(ctx, 1, "any", "v1", "any")
+		r.NoError(err)
+
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = m.Acquire(timeout, 1, "any", "v2", "any")
+		r.ErrorIs(err, context.DeadlineExceeded)
+
+		// the idle instance of the other code is evicted
+		atomic.StoreInt32(&closed, 0)
+		m.Release(v1)
+		v2, err := m.Acquire(ctx, 1, "any", "v2", "any")
+		r.NoError(err)
+		r.NotSame(v1, v2)
+		r.Equal(int32(1), atomic.LoadInt32(&closed))
+	})
+
+	t.Run("InvalidateAcquired", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MaxProject: 1})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.Equal(0, m.Invalidate(1))
+
+		// the acquired instance is still counted in
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = m.Acquire(timeout, 1, "any", "any", "any")
+		r.ErrorIs(err, context.DeadlineExceeded)
+
+		// it's released instead of being returned to the pool of the same code created again
+		atomic.StoreInt32(&closed, 0)
+		m.Release(i)
+		r.Equal(int32(1), atomic.LoadInt32(&closed))
+		i2, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.NotSame(i, i2)
+	})
+
+	t.Run("EvictIdle", func(t *testing.T) {
+		m := server.NewMgr(&server.PoolConfig{MinIdle: 1, IdleTimeout: time.Second})
+		defer m.Close()
+
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		i2, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		m.Release(i)
+		m.Release(i2)
+
+		atomic.StoreInt32(&closed, 0)
+		time.Sleep(2500 * time.Millisecond)
+		r.Equal(int32(1), atomic.LoadInt32(&closed))
+		i3, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.Same(i2, i3)
+
+		atomic.StoreInt32(&created, 0)
+		_, err = m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		r.Equal(int32(1), atomic.LoadInt32(&created))
+	})
 
-	i, err := m.Acquire(1, "any", "any", "any")
-	r.NoError(err)
+	t.Run("Closed", func(t *testing.T) {
+		m := server.NewMgr(nil)
+		i, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		i2, err := m.Acquire(ctx, 1, "any", "any", "any")
+		r.NoError(err)
+		m.Release(i2)
 
-	m.Release(1, i)
+		atomic.StoreInt32(&closed, 0)
+		m.Close()
+		r.Equal(int32(1), atomic.LoadInt32(&closed))
+		m.Release(i)
+		r.Equal(int32(2), atomic.LoadInt32(&closed))
 
-	i2, err := m.Acquire(1, "any", "any", "any")
-	r.NoError(err)
-	r.Equal(i, i2)
+		_, err = m.Acquire(ctx, 1, "any", "any", "any")
+		r.ErrorContains(err, "closed")
+	})
 }
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
@@ -13,15 +14,28 @@ import (
 )
 
 type Instance struct {
-	conn *grpc.ClientConn
-	resp *proto.CreateResponse
+	conn       *grpc.ClientConn
+	resp       *proto.CreateResponse
+	key        poolKey
+	pool       *pool // the pool of Mgr the instance is counted in
+	releasedAt time.Time
 }
 
+// NewInstance creates the vm instance on its own connection to the vm server, Release closes the connection
 func NewInstance(ctx context.Context, endpoint string, projectID uint64, executeBinary string, expParam string) (*Instance, error) {
 	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to dial vm server")
 	}
+	i, err := newInstance(ctx, conn, endpoint, projectID, executeBinary, expParam)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return i, nil
+}
+
+func newInstance(ctx context.Context, conn *grpc.ClientConn, endpoint string, projectID uint64, executeBinary string, expParam string) (*Instance, error) {
 	cli := proto.NewVmRuntimeClient(conn)
 
 	req := &proto.CreateRequest{
@@ -33,7 +47,11 @@ func NewInstance(ctx context.Context, endpoint string, projectID uint64, execute
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create vm instance")
 	}
-	return &Instance{conn: conn, resp: resp}, nil
+	return &Instance{
+		conn: conn,
+		resp: resp,
+		key:  poolKey{projectID: projectID, endpoint: endpoint, codeHash: CodeHash(executeBinary, expParam)},
+	}, nil
 }
 
 func (i *Instance) Execute(ctx context.Context, task *types.Task) ([]byte, error) {
@@ -57,6 +75,9 @@ func (i *Instance) Execute(ctx context.Context, task *types.Task) ([]byte, error
 	return resp.Result, nil
 }
 
+// Release closes the connection of the instance, the vm server frees the instance with it
 func (i *Instance) Release() {
-	i.conn.Close()
+	if err := i.conn.Close(); err != nil {
+		slog.Error("failed to close vm instance connection", "error", err, "project_id", i.key.projectID)
+	}
 }
@@ -43,6 +43,7 @@ func TestNewInstance(t *testing.T) {
 		p = p.ApplyFuncReturn(grpc.Dial, &grpc.ClientConn{}, nil)
 		p = p.ApplyFuncReturn(proto.NewVmRuntimeClient, &MockClient{})
 		p = p.ApplyMethodReturn(&MockClient{}, "Create", nil, errors.New(t.Name()))
+		p = p.ApplyMethodReturn(&grpc.ClientConn{}, "Close", nil)
 
 		_, err := server.NewInstance(context.Background(), "any", 100, "any", "any")
 		r.ErrorContains(err, t.Name())
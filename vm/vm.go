@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -23,6 +24,7 @@ const (
 type Handler struct {
 	vmServerEndpoints map[Type]string
 	instanceMgr       *server.Mgr
+	acquireTimeout    time.Duration
 }
 
 func (r *Handler) Handle(task *types.Task, vmtype Type, code string, expParam string) ([]byte, error) {
@@ -31,12 +33,18 @@ func (r *Handler) Handle(task *types.Task, vmtype Type, code string, expParam st
 		return nil, errors.New("unsupported vm type")
 	}
 
-	ins, err := r.instanceMgr.Acquire(task.ProjectID, endpoint, code, expParam)
+	ctx := context.Background()
+	if r.acquireTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.acquireTimeout)
+		defer cancel()
+	}
+	ins, err := r.instanceMgr.Acquire(ctx, task.ProjectID, endpoint, code, expParam)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get instance")
 	}
 	slog.Debug(fmt.Sprintf("acquire %s instance success", vmtype))
-	defer r.instanceMgr.Release(task.ProjectID, ins)
+	defer r.instanceMgr.Release(ins)
 
 	res, err := ins.Execute(context.Background(), task)
 	if err != nil {
@@ -45,9 +53,32 @@ func (r *Handler) Handle(task *types.Task, vmtype Type, code string, expParam st
 	return res, nil
 }
 
-func NewHandler(vmServerEndpoints map[Type]string) *Handler {
+// Prewarm creates the vm instances of the project code ahead of the tasks
+func (r *Handler) Prewarm(projectID uint64, vmtype Type, code string, expParam string) error {
+	endpoint, ok := r.vmServerEndpoints[vmtype]
+	if !ok {
+		return errors.New("unsupported vm type")
+	}
+
+	if err := r.instanceMgr.Prewarm(context.Background(), projectID, endpoint, code, expParam); err != nil {
+		return errors.Wrap(err, "failed to prewarm instance")
+	}
+	return nil
+}
+
+// Invalidate closes the vm instances of the project whose code is not kept, see server.CodeHash
+func (r *Handler) Invalidate(projectID uint64, keep ...[32]byte) int {
+	return r.instanceMgr.Invalidate(projectID, keep...)
+}
+
+// NewHandler creates the handler, the vm instances are pooled by the pool config, nil means server.DefaultPoolConfig
+func NewHandler(vmServerEndpoints map[Type]string, poolConf *server.PoolConfig) *Handler {
+	if poolConf == nil {
+		poolConf = &server.DefaultPoolConfig
+	}
 	return &Handler{
 		vmServerEndpoints: vmServerEndpoints,
-		instanceMgr:       server.NewMgr(),
+		instanceMgr:       server.NewMgr(poolConf),
+		acquireTimeout:    poolConf.AcquireTimeout,
 	}
 }
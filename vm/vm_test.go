@@ -1,8 +1,10 @@
 package vm
 
 import (
+	"context"
 	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/pkg/errors"
@@ -21,6 +23,7 @@ func TestHandler_Handle(t *testing.T) {
 			Halo2:  "any",
 			ZKwasm: "any",
 		},
+		nil,
 	)
 
 	t.Run("MissingMessages", func(t *testing.T) {
@@ -42,12 +45,25 @@ func TestHandler_Handle(t *testing.T) {
 		r.ErrorContains(err, t.Name())
 	})
 
+	t.Run("AcquireTimeout", func(t *testing.T) {
+		p := gomonkey.NewPatches()
+		defer p.Reset()
+
+		p = p.ApplyMethod(&server.Mgr{}, "Acquire", func(_ *server.Mgr, ctx context.Context, _ uint64, _, _, _ string) (*server.Instance, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		h := NewHandler(map[Type]string{ZKwasm: "any"}, &server.PoolConfig{AcquireTimeout: 10 * time.Millisecond})
+		_, err := h.Handle(&types.Task{}, ZKwasm, "any", "any")
+		r.ErrorIs(err, context.DeadlineExceeded)
+	})
+
 	t.Run("FailedToExecuteMessage", func(t *testing.T) {
 		p := gomonkey.NewPatches()
 		defer p.Reset()
 
 		p = p.ApplyMethodReturn(&server.Mgr{}, "Acquire", &server.Instance{}, nil)
-		p = p.ApplyMethod(&server.Mgr{}, "Release", func(*server.Mgr, uint64, *server.Instance) {})
+		p = p.ApplyMethod(&server.Mgr{}, "Release", func(*server.Mgr, *server.Instance) {})
 		p = p.ApplyMethodReturn(&server.Instance{}, "Execute", nil, errors.New(t.Name()))
 
 		_, err := h.Handle(&types.Task{}, ZKwasm, "any", "any")
@@ -59,7 +75,7 @@ func TestHandler_Handle(t *testing.T) {
 		defer p.Reset()
 
 		p = p.ApplyMethodReturn(&server.Mgr{}, "Acquire", &server.Instance{}, nil)
-		p = p.ApplyMethod(&server.Mgr{}, "Release", func(*server.Mgr, uint64, *server.Instance) {})
+		p = p.ApplyMethod(&server.Mgr{}, "Release", func(*server.Mgr, *server.Instance) {})
 		p = p.ApplyMethodReturn(&server.Instance{}, "Execute", []byte("any"), nil)
 		p = p.ApplyFuncReturn(hex.DecodeString, []byte("any"), nil)
 
@@ -67,3 +83,41 @@ func TestHandler_Handle(t *testing.T) {
 		r.NoError(err)
 	})
 }
+
+func TestHandler_Prewarm(t *testing.T) {
+	r := require.New(t)
+
+	h := NewHandler(map[Type]string{Risc0: "any"}, nil)
+
+	t.Run("UnsupportedVMType", func(t *testing.T) {
+		r.Error(h.Prewarm(1, Halo2, "any", "any"))
+	})
+
+	t.Run("FailedToPrewarmInstance", func(t *testing.T) {
+		p := gomonkey.NewPatches()
+		defer p.Reset()
+
+		p = p.ApplyMethodReturn(&server.Mgr{}, "Prewarm", errors.New(t.Name()))
+		r.ErrorContains(h.Prewarm(1, Risc0, "any", "any"), t.Name())
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		p := gomonkey.NewPatches()
+		defer p.Reset()
+
+		p = p.ApplyMethodReturn(&server.Mgr{}, "Prewarm", nil)
+		r.NoError(h.Prewarm(1, Risc0, "any", "any"))
+	})
+}
+
+func TestHandler_Invalidate(t *testing.T) {
+	r := require.New(t)
+
+	h := NewHandler(map[Type]string{Risc0: "any"}, nil)
+
+	p := gomonkey.NewPatches()
+	defer p.Reset()
+
+	p = p.ApplyMethodReturn(&server.Mgr{}, "Invalidate", 1)
+	r.Equal(1, h.Invalidate(1, server.CodeHash("any", "any")))
+}